@@ -42,6 +42,7 @@ func (b *ArrayBuilder) Build(builder *Builder) (uint32, error) {
 	if len(b.values) > int(^uint32(0)) {
 		return 0, fmt.Errorf("array length exceeds u32")
 	}
+	dedupWithWorkspace(builder, b.workspace)
 	length := uint32(len(b.values))
 	entries := getArrayEntrySliceWithWorkspace(len(b.values), b.workspace)
 	for i, v := range b.values {
@@ -69,24 +69,39 @@ func ArrAppendDocument(doc []byte, values ...Value) ([]byte, error) {
 }
 
 // ArrSliceDocument returns a new array document containing values[start:end].
+// Nodes of doc that line up with the slice are shared; see ArraySliceNode.
 func ArrSliceDocument(doc []byte, start, end uint32) ([]byte, error) {
-	rootOff, length, builder, err := arrayDocumentBase(doc)
+	rootOff, _, builder, err := arrayDocumentBase(doc)
 	if err != nil {
 		return nil, err
 	}
-	if start > end || end > length {
-		return nil, fmt.Errorf("array slice [%d:%d] out of range", start, end)
-	}
-	values, err := arrayDenseValues(doc, rootOff, length)
+	newRoot, err := ArraySliceNode(builder, rootOff, start, end)
 	if err != nil {
 		return nil, err
 	}
-	sliced := values[start:end]
-	newRoot, err := buildArrayFromValues(builder, sliced)
+	return builder.BytesWithTrailer(newRoot, rootOff), nil
+}
+
+// ArraySliceNode writes an array holding values[start:end] of the array at
+// rootOff and returns its root offset. When start is a multiple of 16, whole
+// leaves and branches of the source are shared and only the edge nodes along
+// end and a new root are written. Otherwise leaves are re-encoded, but value
+// nodes are still shared.
+func ArraySliceNode(builder *Builder, rootOff uint32, start, end uint32) (uint32, error) {
+	if builder == nil {
+		return 0, fmt.Errorf("nil builder")
+	}
+	length, err := arrayRootLength(builder.buf, rootOff)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	return builder.BytesWithTrailer(newRoot, rootOff), nil
+	if start > end || end > length {
+		return 0, fmt.Errorf("array slice [%d:%d] out of range", start, end)
+	}
+	if start == 0 && end == length {
+		return rootOff, nil
+	}
+	return rebuildArray(builder, rootOff, length, []arraySpan{{start: 0, end: end - start, from: start}})
 }
 
 func arrayDocumentBase(doc []byte) (uint32, uint32, *Builder, error) {
@@ -131,27 +146,6 @@ func arrayDenseValues(doc []byte, rootOff uint32, length uint32) ([]Value, error
 	return values, nil
 }
 
-func buildArrayFromValues(builder *Builder, values []Value) (uint32, error) {
-	if builder == nil {
-		return 0, fmt.Errorf("nil builder")
-	}
-	if len(values) > int(^uint32(0)) {
-		return 0, fmt.Errorf("array length exceeds u32")
-	}
-	length := uint32(len(values))
-	entries := getArrayEntrySlice(len(values))
-	for i, v := range values {
-		entries[i] = arrayEntry{index: uint32(i), value: v}
-	}
-	shift := arrayRootShift(length)
-	root, err := buildArrayNode(entries, shift, length, true, nil)
-	putArrayEntrySlice(entries)
-	if err != nil {
-		return 0, err
-	}
-	return encodeArrayNode(builder, root, nil)
-}
-
 func arrayRootLength(doc []byte, rootOff uint32) (uint32, error) {
 	h, node, err := NodeSliceAt(doc, rootOff)
 	if err != nil {
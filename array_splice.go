@@ -0,0 +1,334 @@
+package tron
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ArraySpliceNode removes deleteCount values starting at start from the array
+// at rootOff, inserts values in their place, and returns the new root offset.
+//
+// Subtrees that hold the same values at the same indices in the result are
+// reused rather than rewritten. Every subtree before start is kept, and when
+// the splice does not change the length the subtrees after it are kept too.
+// When the length changes, every value after the splice moves to a new index,
+// so all leaves and branches from start to the end of the array are rebuilt:
+// the cost is O(length - start), and splicing near the front of a large array
+// rewrites almost all of it.
+func ArraySpliceNode(builder *Builder, rootOff uint32, start, deleteCount uint32, values ...Value) (uint32, error) {
+	if builder == nil {
+		return 0, fmt.Errorf("nil builder")
+	}
+	length, err := arrayRootLength(builder.buf, rootOff)
+	if err != nil {
+		return 0, err
+	}
+	if start > length || deleteCount > length-start {
+		return 0, fmt.Errorf("array splice [%d:%d] out of range", start, uint64(start)+uint64(deleteCount))
+	}
+	if uint64(length)-uint64(deleteCount)+uint64(len(values)) > uint64(^uint32(0)) {
+		return 0, fmt.Errorf("array length exceeds u32")
+	}
+	if deleteCount == 0 && len(values) == 0 {
+		return rootOff, nil
+	}
+	addrs := make([]uint32, len(values))
+	for i, v := range values {
+		addr, err := valueAddress(builder, v)
+		if err != nil {
+			return 0, err
+		}
+		addrs[i] = addr
+	}
+	insertEnd := start + uint32(len(addrs))
+	spans := []arraySpan{
+		{start: 0, end: start, from: 0},
+		{start: start, end: insertEnd, addrs: addrs},
+		{start: insertEnd, end: insertEnd + length - start - deleteCount, from: start + deleteCount},
+	}
+	return rebuildArray(builder, rootOff, length, spans)
+}
+
+// ArrSpliceDocument removes deleteCount values starting at start from a
+// top-level array document and inserts values in their place.
+func ArrSpliceDocument(doc []byte, start, deleteCount uint32, values ...Value) ([]byte, error) {
+	rootOff, _, builder, err := arrayDocumentBase(doc)
+	if err != nil {
+		return nil, err
+	}
+	newRoot, err := ArraySpliceNode(builder, rootOff, start, deleteCount, values...)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BytesWithTrailer(newRoot, rootOff), nil
+}
+
+// ArrInsertDocument inserts values before index in a top-level array document.
+// An index equal to the length appends.
+func ArrInsertDocument(doc []byte, index uint32, values ...Value) ([]byte, error) {
+	return ArrSpliceDocument(doc, index, 0, values...)
+}
+
+// ArrRemoveDocument removes values[start:end] from a top-level array document.
+func ArrRemoveDocument(doc []byte, start, end uint32) ([]byte, error) {
+	if start > end {
+		return nil, fmt.Errorf("array slice [%d:%d] out of range", start, end)
+	}
+	return ArrSpliceDocument(doc, start, end-start)
+}
+
+// ArrSplice removes deleteCount values starting at start from the array at
+// arrOff, inserts values in their place, and returns the new array offset.
+func (tx *Txn) ArrSplice(arrOff uint32, start, deleteCount uint32, values ...Value) (uint32, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	off, err := ArraySpliceNode(tx.doc.builder, arrOff, start, deleteCount, values...)
+	if err != nil {
+		return 0, tx.fail(err)
+	}
+	return off, nil
+}
+
+// arraySpan maps the new indices [start, end) either to explicit value
+// addresses or, when addrs is nil, to the old indices beginning at from.
+type arraySpan struct {
+	start, end uint32
+	from       uint32
+	addrs      []uint32
+}
+
+// arrayRebuilder writes a new array root whose values are described by spans
+// over an existing array, reusing old subtrees that line up with new ones.
+type arrayRebuilder struct {
+	builder   *Builder
+	root      uint32
+	rootShift uint8
+	length    uint32
+	spans     []arraySpan
+	newLength uint32
+	newShift  uint8
+
+	// cached old leaf, indexed by slot
+	leafBase  uint32
+	leafValid bool
+	leafAddrs [16]uint32
+	leafMask  uint16
+}
+
+func rebuildArray(builder *Builder, rootOff uint32, length uint32, spans []arraySpan) (uint32, error) {
+	live := spans[:0]
+	for _, s := range spans {
+		if s.end > s.start {
+			live = append(live, s)
+		}
+	}
+	h, node, err := NodeSliceAt(builder.buf, rootOff)
+	if err != nil {
+		return 0, err
+	}
+	var rootShift uint8
+	if h.Kind == NodeBranch {
+		branch, err := ParseArrayBranchNode(node)
+		if err != nil {
+			return 0, err
+		}
+		rootShift = branch.Shift
+		releaseArrayBranchNode(&branch)
+	}
+	var newLength uint32
+	if len(live) > 0 {
+		newLength = live[len(live)-1].end
+	}
+	rb := arrayRebuilder{
+		builder:   builder,
+		root:      rootOff,
+		rootShift: rootShift,
+		length:    length,
+		spans:     live,
+		newLength: newLength,
+		newShift:  arrayRootShift(newLength),
+	}
+	off, _, err := rb.build(rb.newShift, 0)
+	return off, err
+}
+
+// build writes the node covering new indices from base at shift. It reports
+// false when the subtree holds no values and was omitted.
+func (rb *arrayRebuilder) build(shift uint8, base uint32) (uint32, bool, error) {
+	isRoot := shift == rb.newShift
+	width := uint64(1) << (shift + 4)
+	end := rb.newLength
+	if uint64(base)+width < uint64(end) {
+		end = base + uint32(width)
+	}
+	if !isRoot {
+		if off, present, ok, err := rb.reuse(shift, base, end, width); ok || err != nil {
+			return off, present, err
+		}
+	}
+	if shift == 0 {
+		var bitmap uint16
+		addrs := make([]uint32, 0, 16)
+		for i := base; i < end; i++ {
+			addr, ok, err := rb.addrAt(i)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				bitmap |= 1 << (i - base)
+				addrs = append(addrs, addr)
+			}
+		}
+		if bitmap == 0 && !isRoot {
+			return 0, false, nil
+		}
+		leaf := ArrayLeafNode{
+			Header:     NodeHeader{Kind: NodeLeaf, KeyType: KeyArr, IsRoot: isRoot},
+			Bitmap:     bitmap,
+			ValueAddrs: addrs,
+		}
+		if isRoot {
+			leaf.Length = rb.newLength
+		}
+		off, err := appendArrayLeafNode(rb.builder, leaf)
+		return off, err == nil, err
+	}
+	var bitmap uint16
+	children := make([]uint32, 0, 16)
+	step := uint32(width >> 4)
+	for slot := uint32(0); slot < 16; slot++ {
+		childBase := base + slot*step
+		if childBase >= end {
+			break
+		}
+		off, present, err := rb.build(shift-4, childBase)
+		if err != nil {
+			return 0, false, err
+		}
+		if present {
+			bitmap |= 1 << slot
+			children = append(children, off)
+		}
+	}
+	if bitmap == 0 && !isRoot {
+		return 0, false, nil
+	}
+	branch := ArrayBranchNode{
+		Header:   NodeHeader{Kind: NodeBranch, KeyType: KeyArr, IsRoot: isRoot},
+		Shift:    shift,
+		Bitmap:   bitmap,
+		Children: children,
+	}
+	if isRoot {
+		branch.Length = rb.newLength
+	}
+	off, err := appendArrayBranchNode(rb.builder, branch)
+	return off, err == nil, err
+}
+
+// reuse looks for an old non-root node that holds exactly the values of the
+// new subtree covering [base, end). ok reports whether such a node, or an
+// old hole, could stand in for the subtree.
+func (rb *arrayRebuilder) reuse(shift uint8, base, end uint32, width uint64) (off uint32, present bool, ok bool, err error) {
+	if shift >= rb.rootShift {
+		return 0, false, false, nil
+	}
+	s := rb.span(base)
+	if s.addrs != nil || end > s.end {
+		return 0, false, false, nil
+	}
+	from := s.from + (base - s.start)
+	if uint64(from)%width != 0 {
+		return 0, false, false, nil
+	}
+	// A subtree cut short by the end of the new array can only be reused
+	// when the old one ends at the same place.
+	if uint64(base)+width > uint64(end) && s.from+(s.end-s.start) != rb.length {
+		return 0, false, false, nil
+	}
+	off, present, err = rb.oldNode(shift, from)
+	return off, present, err == nil, err
+}
+
+func (rb *arrayRebuilder) span(index uint32) arraySpan {
+	i := sort.Search(len(rb.spans), func(i int) bool { return rb.spans[i].end > index })
+	return rb.spans[i]
+}
+
+// addrAt returns the value address for new index i, or false for a hole.
+func (rb *arrayRebuilder) addrAt(i uint32) (uint32, bool, error) {
+	s := rb.span(i)
+	if s.addrs != nil {
+		return s.addrs[i-s.start], true, nil
+	}
+	old := s.from + (i - s.start)
+	leafBase := old &^ 0xF
+	if !rb.leafValid || rb.leafBase != leafBase {
+		if err := rb.loadLeaf(leafBase); err != nil {
+			return 0, false, err
+		}
+	}
+	slot := old & 0xF
+	if (rb.leafMask>>slot)&1 == 0 {
+		return 0, false, nil
+	}
+	return rb.leafAddrs[slot], true, nil
+}
+
+func (rb *arrayRebuilder) loadLeaf(base uint32) error {
+	rb.leafBase = base
+	rb.leafValid = true
+	rb.leafMask = 0
+	off, present, err := rb.oldNode(0, base)
+	if err != nil || !present {
+		return err
+	}
+	_, node, err := NodeSliceAt(rb.builder.buf, off)
+	if err != nil {
+		return err
+	}
+	leaf, err := ParseArrayLeafNode(node)
+	if err != nil {
+		return err
+	}
+	defer releaseArrayLeafNode(&leaf)
+	i := 0
+	for slot := 0; slot < 16; slot++ {
+		if (leaf.Bitmap>>slot)&1 == 0 {
+			continue
+		}
+		rb.leafAddrs[slot] = leaf.ValueAddrs[i]
+		i++
+	}
+	rb.leafMask = leaf.Bitmap
+	return nil
+}
+
+// oldNode walks the old array to the node at shift covering index. It
+// reports false when that subtree is absent.
+func (rb *arrayRebuilder) oldNode(shift uint8, index uint32) (uint32, bool, error) {
+	off := rb.root
+	for cur := rb.rootShift; cur > shift; cur -= 4 {
+		_, node, err := NodeSliceAt(rb.builder.buf, off)
+		if err != nil {
+			return 0, false, err
+		}
+		branch, err := ParseArrayBranchNode(node)
+		if err != nil {
+			return 0, false, err
+		}
+		if branch.Shift != cur {
+			releaseArrayBranchNode(&branch)
+			return 0, false, fmt.Errorf("array branch shift %d, expected %d", branch.Shift, cur)
+		}
+		slot := (index >> cur) & 0xF
+		if (branch.Bitmap>>slot)&1 == 0 {
+			releaseArrayBranchNode(&branch)
+			return 0, false, nil
+		}
+		off = branch.Children[popcount16(branch.Bitmap&(1<<slot-1))]
+		releaseArrayBranchNode(&branch)
+	}
+	return off, true, nil
+}
@@ -0,0 +1,206 @@
+package tron
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// TestArraySpliceMatchesSlice applies random splices to an array node and to
+// a reference slice and checks that they agree after every step.
+func TestArraySpliceMatchesSlice(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	builder := NewBuilder()
+	ab := NewArrayBuilder()
+	var want []int64
+	for i := range 300 {
+		ab.Append(Value{Type: TypeI64, I64: int64(i)})
+		want = append(want, int64(i))
+	}
+	root, err := ab.Build(builder)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	next := int64(1000)
+	for step := range 500 {
+		start := uint32(rng.IntN(len(want) + 1))
+		deleteCount := uint32(rng.IntN(len(want) - int(start) + 1))
+		if rng.IntN(4) != 0 {
+			deleteCount = min(deleteCount, 3)
+		}
+		var values []Value
+		var inserted []int64
+		for range rng.IntN(20) {
+			values = append(values, Value{Type: TypeI64, I64: next})
+			inserted = append(inserted, next)
+			next++
+		}
+		root, err = ArraySpliceNode(builder, root, start, deleteCount, values...)
+		if err != nil {
+			t.Fatalf("step %d: splice(%d, %d, %d values): %v", step, start, deleteCount, len(values), err)
+		}
+		want = slices.Replace(want, int(start), int(start+deleteCount), inserted...)
+		doc := builder.BytesWithTrailer(root, 0)
+		if err := Verify(doc, VerifyLimits{}); err != nil {
+			t.Fatalf("step %d: verify: %v", step, err)
+		}
+		var got []int64
+		err := ArrEach(doc, root, func(_ uint32, v Value) error {
+			got = append(got, v.I64)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("step %d: each: %v", step, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("step %d: splice(%d, %d, %d values) gave %d values, want %d", step, start, deleteCount, len(values), len(got), len(want))
+		}
+	}
+}
+
+// TestArraySpliceAppendedBytes pins the documented cost: an insert at the
+// front of a large array rewrites its leaves and branches but none of its
+// values, while an insert at the end rewrites only the rightmost path.
+func TestArraySpliceAppendedBytes(t *testing.T) {
+	const n = 4096
+	builder := NewBuilder()
+	ab := NewArrayBuilder()
+	values := NewBuilder()
+	for i := range n {
+		v := Value{Type: TypeI64, I64: int64(i) + 1<<40}
+		ab.Append(v)
+		if _, err := valueAddress(values, v); err != nil {
+			t.Fatalf("value %d: %v", i, err)
+		}
+	}
+	root, err := ab.Build(builder)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	structure := len(builder.buf) - len(values.buf)
+
+	before := len(builder.buf)
+	if _, err := ArraySpliceNode(builder, root, 0, 0, Value{Type: TypeI64, I64: -1}); err != nil {
+		t.Fatalf("front insert: %v", err)
+	}
+	front := len(builder.buf) - before
+	if front < structure/2 || front > structure+64 {
+		t.Fatalf("front insert appended %d bytes, want about the %d bytes of array nodes", front, structure)
+	}
+
+	before = len(builder.buf)
+	if _, err := ArraySpliceNode(builder, root, n, 0, Value{Type: TypeI64, I64: -2}); err != nil {
+		t.Fatalf("back insert: %v", err)
+	}
+	if back := len(builder.buf) - before; back > 256 {
+		t.Fatalf("back insert appended %d bytes, want at most 256", back)
+	}
+}
+
+// TestArraySliceSparse slices a sparse array at and across leaf and branch
+// boundaries, where the slice needs a smaller root shift than its source, and
+// checks that holes stay holes.
+func TestArraySliceSparse(t *testing.T) {
+	const length = 4200
+	builder := NewBuilder()
+	root, err := NewArrayBuilder().Build(builder)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	present := map[uint32]bool{}
+	for i := uint32(0); i < length; i++ {
+		if i%7 == 3 || (i >= 250 && i < 262) || i == 4095 || i == 4096 {
+			present[i] = true
+		}
+	}
+	for i := uint32(0); i < length; i++ {
+		if !present[i] {
+			continue
+		}
+		root, err = ArraySetNode(builder, root, i, Value{Type: TypeI64, I64: int64(i)}, length)
+		if err != nil {
+			t.Fatalf("set %d: %v", i, err)
+		}
+	}
+	bounds := []uint32{0, 1, 3, 15, 16, 17, 255, 256, 257, 4095, 4096, 4097, length}
+	for _, start := range bounds {
+		for _, end := range bounds {
+			if start > end {
+				continue
+			}
+			off, err := ArraySliceNode(builder, root, start, end)
+			if err != nil {
+				t.Fatalf("slice [%d:%d]: %v", start, end, err)
+			}
+			doc := builder.BytesWithTrailer(off, 0)
+			if err := Verify(doc, VerifyLimits{}); err != nil {
+				t.Fatalf("slice [%d:%d]: verify: %v", start, end, err)
+			}
+			if got, err := ArrayRootLength(doc, off); err != nil || got != end-start {
+				t.Fatalf("slice [%d:%d]: length %d, %v", start, end, got, err)
+			}
+			h, node, err := NodeSliceAt(doc, off)
+			if err != nil {
+				t.Fatalf("slice [%d:%d]: root: %v", start, end, err)
+			}
+			if h.Kind == NodeBranch {
+				branch, err := ParseArrayBranchNode(node)
+				if err != nil {
+					t.Fatalf("slice [%d:%d]: branch: %v", start, end, err)
+				}
+				if want := arrayRootShift(end - start); branch.Shift != want {
+					t.Fatalf("slice [%d:%d]: root shift %d, want %d", start, end, branch.Shift, want)
+				}
+			} else if end-start > 16 {
+				t.Fatalf("slice [%d:%d]: leaf root for %d values", start, end, end-start)
+			}
+			var got []uint32
+			err = ArrEach(doc, off, func(index uint32, v Value) error {
+				if v.I64 != int64(start+index) {
+					t.Fatalf("slice [%d:%d]: index %d holds %d", start, end, index, v.I64)
+				}
+				got = append(got, start+index)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("slice [%d:%d]: each: %v", start, end, err)
+			}
+			var want []uint32
+			for i := start; i < end; i++ {
+				if present[i] {
+					want = append(want, i)
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("slice [%d:%d]: present %v, want %v", start, end, got, want)
+			}
+		}
+	}
+	if _, err := ArraySliceNode(builder, root, 5, 4); err == nil {
+		t.Fatalf("accepted start after end")
+	}
+	if _, err := ArraySliceNode(builder, root, 0, length+1); err == nil {
+		t.Fatalf("accepted end past the length")
+	}
+}
+
+func TestArrSliceDocumentHoles(t *testing.T) {
+	builder := NewBuilder()
+	root, err := NewArrayBuilder().Build(builder)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	root, err = ArraySetNode(builder, root, 40, Value{Type: TypeI64, I64: 1}, 41)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	doc := builder.BytesWithTrailer(root, 0)
+	sliced, err := ArrSliceDocument(doc, 30, 41)
+	if err != nil {
+		t.Fatalf("slice: %v", err)
+	}
+	assertDocEqual(t, sliced, `[null,null,null,null,null,null,null,null,null,null,1]`)
+	if _, ok, err := ArrGet(sliced, mustRoot(t, sliced).Offset, 0); err != nil || ok {
+		t.Fatalf("hole became a value: ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,415 @@
+package tron
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborCheck validates CBOR input before conversion. Limits are set to the
+// widest the decoder allows, matching FromJSON, which has none.
+var cborCheck = func() cbor.DecMode {
+	dm, err := cbor.DecOptions{
+		MaxNestedLevels:  65535,
+		MaxArrayElements: math.MaxInt32,
+		MaxMapPairs:      math.MaxInt32,
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return dm
+}()
+
+// FromCBOR converts a single CBOR data item into a TRON document.
+//
+// Byte strings become bin values and text strings txt. Integers become i64;
+// integers and bignums (tags 2 and 3) beyond the i64 range become f64, as in
+// FromJSON. Floats of every width become f64, and undefined becomes nil.
+// Other tags, including the date/time tags 0 and 1, are dropped and their
+// content converted as if untagged. Other simple values are rejected.
+//
+// Map keys must be text strings or integers; integer keys are stored as their
+// decimal text. Other key types are rejected. When keys repeat, including an
+// integer key and a text key with the same text, the last value wins.
+func FromCBOR(data []byte) ([]byte, error) {
+	if err := cborCheck.Wellformed(data); err != nil {
+		return nil, err
+	}
+	builder := NewBuilder()
+	d := cborDecoder{data: data, builder: builder, workspace: newEncodeWorkspace()}
+	val, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	switch val.Type {
+	case TypeArr, TypeMap:
+		return builder.BytesWithTrailer(val.Offset, 0), nil
+	default:
+		return EncodeScalarDocument(val)
+	}
+}
+
+// cborDecoder walks a well-formed CBOR data item and appends nodes to
+// builder.
+type cborDecoder struct {
+	data      []byte
+	off       int
+	builder   *Builder
+	workspace *encodeWorkspace
+}
+
+const (
+	cborUint   = 0
+	cborNeg    = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// head reads an initial byte and its argument. For major type 7 the argument
+// of a float is its raw bits.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64) {
+	ib := d.data[d.off]
+	d.off++
+	major, info = ib>>5, ib&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24:
+		arg = uint64(d.data[d.off])
+		d.off++
+	case info == 25:
+		arg = uint64(binary.BigEndian.Uint16(d.data[d.off:]))
+		d.off += 2
+	case info == 26:
+		arg = uint64(binary.BigEndian.Uint32(d.data[d.off:]))
+		d.off += 4
+	case info == 27:
+		arg = binary.BigEndian.Uint64(d.data[d.off:])
+		d.off += 8
+	}
+	return major, info, arg
+}
+
+func (d *cborDecoder) atBreak() bool {
+	if d.data[d.off] == cborBreak {
+		d.off++
+		return true
+	}
+	return false
+}
+
+// str returns the bytes of a string whose head has been read, joining the
+// chunks of an indefinite-length string.
+func (d *cborDecoder) str(info byte, n uint64) []byte {
+	if info != cborIndefinite {
+		b := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		return b
+	}
+	var out []byte
+	for !d.atBreak() {
+		_, _, n := d.head()
+		out = append(out, d.data[d.off:d.off+int(n)]...)
+		d.off += int(n)
+	}
+	if out == nil {
+		out = []byte{}
+	}
+	return out
+}
+
+func (d *cborDecoder) value() (Value, error) {
+	major, info, arg := d.head()
+	switch major {
+	case cborUint:
+		if arg > math.MaxInt64 {
+			return Value{Type: TypeF64, F64: float64(arg)}, nil
+		}
+		return Value{Type: TypeI64, I64: int64(arg)}, nil
+	case cborNeg:
+		if arg > math.MaxInt64 {
+			return Value{Type: TypeF64, F64: -1 - float64(arg)}, nil
+		}
+		return Value{Type: TypeI64, I64: -1 - int64(arg)}, nil
+	case cborBytes:
+		return Value{Type: TypeBin, Bytes: d.str(info, arg)}, nil
+	case cborText:
+		b := d.str(info, arg)
+		if !utf8.Valid(b) {
+			return Value{}, fmt.Errorf("invalid utf-8 in cbor text string")
+		}
+		return Value{Type: TypeTxt, Bytes: b}, nil
+	case cborArray:
+		ab := newArrayBuilderWithWorkspace(d.workspace)
+		for i := uint64(0); info == cborIndefinite || i < arg; i++ {
+			if info == cborIndefinite && d.atBreak() {
+				break
+			}
+			val, err := d.value()
+			if err != nil {
+				return Value{}, err
+			}
+			ab.Append(val)
+		}
+		off, err := ab.Build(d.builder)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeArr, Offset: off}, nil
+	case cborMap:
+		mb := newMapBuilderWithWorkspace(d.workspace)
+		for i := uint64(0); info == cborIndefinite || i < arg; i++ {
+			if info == cborIndefinite && d.atBreak() {
+				break
+			}
+			key, err := d.key()
+			if err != nil {
+				return Value{}, err
+			}
+			val, err := d.value()
+			if err != nil {
+				return Value{}, err
+			}
+			mb.Set(key, val)
+		}
+		off, err := mb.Build(d.builder)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeMap, Offset: off}, nil
+	case cborTag:
+		if arg == 2 || arg == 3 {
+			return d.bignum(arg == 3)
+		}
+		return d.value()
+	default:
+		return cborSimpleValue(info, arg)
+	}
+}
+
+func (d *cborDecoder) bignum(negative bool) (Value, error) {
+	major, info, n := d.head()
+	if major != cborBytes {
+		return Value{}, fmt.Errorf("cbor bignum tag must wrap a byte string, got major type %d at offset %d", major, d.off-1)
+	}
+	b := new(big.Int).SetBytes(d.str(info, n))
+	if negative {
+		b.Neg(b.Add(b, big.NewInt(1)))
+	}
+	if b.IsInt64() {
+		return Value{Type: TypeI64, I64: b.Int64()}, nil
+	}
+	f, _ := new(big.Float).SetInt(b).Float64()
+	return Value{Type: TypeF64, F64: f}, nil
+}
+
+func (d *cborDecoder) key() ([]byte, error) {
+	major, info, arg := d.head()
+	// Tags on keys are dropped as they are on values; bignum keys are
+	// rejected below.
+	for major == cborTag && arg != 2 && arg != 3 {
+		major, info, arg = d.head()
+	}
+	switch major {
+	case cborText:
+		b := d.str(info, arg)
+		if !utf8.Valid(b) {
+			return nil, fmt.Errorf("invalid utf-8 in cbor map key")
+		}
+		return b, nil
+	case cborUint:
+		return strconv.AppendUint(nil, arg, 10), nil
+	case cborNeg:
+		n := new(big.Int).SetUint64(arg)
+		return n.Neg(n.Add(n, big.NewInt(1))).Append(nil, 10), nil
+	default:
+		return nil, fmt.Errorf("unsupported cbor map key type %d at offset %d", major, d.off-1)
+	}
+}
+
+func cborSimpleValue(info byte, arg uint64) (Value, error) {
+	switch info {
+	case 20:
+		return Value{Type: TypeBit, Bool: false}, nil
+	case 21:
+		return Value{Type: TypeBit, Bool: true}, nil
+	case 22, 23:
+		return Value{Type: TypeNil}, nil
+	case 25:
+		return Value{Type: TypeF64, F64: halfToFloat64(uint16(arg))}, nil
+	case 26:
+		return Value{Type: TypeF64, F64: float64(math.Float32frombits(uint32(arg)))}, nil
+	case 27:
+		return Value{Type: TypeF64, F64: math.Float64frombits(arg)}, nil
+	default:
+		return Value{}, fmt.Errorf("unsupported cbor simple value %d", arg)
+	}
+}
+
+// halfToFloat64 widens an IEEE 754 half-precision float.
+func halfToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// ToCBOR encodes a TRON document as CBOR.
+func ToCBOR(doc []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteCBOR(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteCBOR writes doc as a single CBOR data item to w through a buffer,
+// flushing before it returns.
+//
+// Bin values become byte strings and txt values text strings. Maps and arrays
+// use definite lengths; map keys are text strings in stored order, and array
+// holes are written as null. An f64 is written as a 32-bit float when that
+// holds it exactly and as a 64-bit float otherwise.
+func WriteCBOR(w io.Writer, doc []byte) error {
+	root, err := documentRoot(doc)
+	if err != nil {
+		return err
+	}
+	cw := cborWriter{w: bufio.NewWriterSize(w, 32<<10), doc: doc}
+	if err := cw.value(root); err != nil {
+		return err
+	}
+	return cw.w.Flush()
+}
+
+type cborWriter struct {
+	w       *bufio.Writer
+	doc     []byte
+	scratch [9]byte
+}
+
+func (cw *cborWriter) head(major byte, arg uint64) {
+	b := cw.scratch[:0]
+	switch {
+	case arg < 24:
+		b = append(b, major<<5|byte(arg))
+	case arg <= math.MaxUint8:
+		b = append(b, major<<5|24, byte(arg))
+	case arg <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		b = binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(arg))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, major<<5|27), arg)
+	}
+	cw.w.Write(b)
+}
+
+func (cw *cborWriter) value(v Value) error {
+	switch v.Type {
+	case TypeNil:
+		cw.w.WriteByte(cborSimple<<5 | 22)
+	case TypeBit:
+		if v.Bool {
+			cw.w.WriteByte(cborSimple<<5 | 21)
+		} else {
+			cw.w.WriteByte(cborSimple<<5 | 20)
+		}
+	case TypeI64:
+		if v.I64 < 0 {
+			cw.head(cborNeg, uint64(-1-v.I64))
+		} else {
+			cw.head(cborUint, uint64(v.I64))
+		}
+	case TypeF64:
+		if f := float32(v.F64); float64(f) == v.F64 {
+			cw.w.WriteByte(cborSimple<<5 | 26)
+			cw.w.Write(binary.BigEndian.AppendUint32(cw.scratch[:0], math.Float32bits(f)))
+		} else {
+			cw.w.WriteByte(cborSimple<<5 | 27)
+			cw.w.Write(binary.BigEndian.AppendUint64(cw.scratch[:0], math.Float64bits(v.F64)))
+		}
+	case TypeTxt:
+		cw.head(cborText, uint64(len(v.Bytes)))
+		cw.w.Write(v.Bytes)
+	case TypeBin:
+		cw.head(cborBytes, uint64(len(v.Bytes)))
+		cw.w.Write(v.Bytes)
+	case TypeArr:
+		return cw.array(v.Offset)
+	case TypeMap:
+		return cw.object(v.Offset)
+	default:
+		return fmt.Errorf("unknown value type %d", v.Type)
+	}
+	return nil
+}
+
+func (cw *cborWriter) array(off uint32) error {
+	length, err := arrayRootLength(cw.doc, off)
+	if err != nil {
+		return err
+	}
+	cw.head(cborArray, uint64(length))
+	next := uint32(0)
+	err = ArrEach(cw.doc, off, func(index uint32, val Value) error {
+		if index >= length {
+			return fmt.Errorf("array index out of range: %d", index)
+		}
+		for ; next < index; next++ {
+			cw.w.WriteByte(cborSimple<<5 | 22)
+		}
+		next = index + 1
+		return cw.value(val)
+	})
+	if err != nil {
+		return err
+	}
+	for ; next < length; next++ {
+		cw.w.WriteByte(cborSimple<<5 | 22)
+	}
+	return nil
+}
+
+func (cw *cborWriter) object(off uint32) error {
+	n, err := MapLen(cw.doc, off)
+	if err != nil {
+		return err
+	}
+	cw.head(cborMap, uint64(n))
+	return MapEach(cw.doc, off, func(key []byte, val Value) error {
+		cw.head(cborText, uint64(len(key)))
+		cw.w.Write(key)
+		return cw.value(val)
+	})
+}
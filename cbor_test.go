@@ -0,0 +1,179 @@
+package tron
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+)
+
+func cborHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	inputs := []string{
+		`null`,
+		`true`,
+		`0`,
+		`-25`,
+		`4294967296`,
+		`-9223372036854775808`,
+		`9223372036854775807`,
+		`1.5`,
+		`0.1`,
+		`""`,
+		`"` + strings.Repeat("x", 300) + `"`,
+		`[]`,
+		`{}`,
+		`[1,-1,23,24,255,256,65535,65536,null,false,"é"]`,
+		`{"a":{"b":[1,{"c":null}]},"d":"text","e":[[],{}]}`,
+		`"b64:AAECAw=="`,
+	}
+	for _, in := range inputs {
+		doc := mustJSON(t, in)
+		cb, err := ToCBOR(doc)
+		if err != nil {
+			t.Fatalf("to cbor %s: %v", in, err)
+		}
+		back, err := FromCBOR(cb)
+		if err != nil {
+			t.Fatalf("from cbor %s: %v", in, err)
+		}
+		assertDocEqual(t, back, in)
+		again, err := ToCBOR(back)
+		if err != nil {
+			t.Fatalf("to cbor again %s: %v", in, err)
+		}
+		if !bytes.Equal(cb, again) {
+			t.Fatalf("%s: cbor changed on the second pass: % x then % x", in, cb, again)
+		}
+	}
+}
+
+func TestFromCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"uint64 max", "1b ffffffffffffffff", `18446744073709551615`},
+		{"nint64 min", "3b ffffffffffffffff", `-18446744073709551616`},
+		{"nint", "38 63", `-100`},
+
+		{"bignum", "c2 41 05", `5`},
+		{"bignum empty", "c2 40", `0`},
+		{"bignum i64 max", "c2 48 7fffffffffffffff", `9223372036854775807`},
+		{"bignum past i64", "c2 48 8000000000000000", `9223372036854775808`},
+		{"bignum 2^64", "c2 49 010000000000000000", `18446744073709551616`},
+		{"bignum chunked", "c2 5f 41 01 41 00 ff", `256`},
+		{"negative bignum", "c3 41 05", `-6`},
+		{"negative bignum i64 min", "c3 48 7fffffffffffffff", `-9223372036854775808`},
+		{"negative bignum past i64", "c3 48 8000000000000000", `-9223372036854775809`},
+		{"negative bignum 2^64", "c3 49 010000000000000000", `-18446744073709551617`},
+
+		{"date string tag", "c0 74 323031332d30332d32315432303a30343a30305a", `"2013-03-21T20:04:00Z"`},
+		{"epoch tag", "c1 1a 514b67b0", `1363896240`},
+		{"uri tag", "d8 20 63 616263", `"abc"`},
+		{"nested tags", "d9 d9f7 d8 20 82 01 c1 02", `[1,2]`},
+		{"tag on key and value", "a1 c0 61 61 c1 01", `{"a":1}`},
+
+		{"int keys", "a3 01 61 61 20 61 62 00 61 63", `{"1":"a","-1":"b","0":"c"}`},
+		{"big int keys", "a2 1b ffffffffffffffff f6 3b ffffffffffffffff f6", `{"18446744073709551615":null,"-18446744073709551616":null}`},
+		{"int and text key collide", "a2 01 61 61 61 31 61 62", `{"1":"b"}`},
+		{"text and int key collide", "a2 61 31 61 61 01 61 62", `{"1":"b"}`},
+
+		{"indefinite array", "9f 01 02 03 ff", `[1,2,3]`},
+		{"indefinite empty array", "9f ff", `[]`},
+		{"indefinite map", "bf 61 61 01 61 62 9f ff ff", `{"a":1,"b":[]}`},
+		{"indefinite empty map", "bf ff", `{}`},
+		{"indefinite text", "7f 62 6162 60 61 63 ff", `"abc"`},
+		{"indefinite empty text", "7f ff", `""`},
+		{"indefinite bytes", "5f 42 0001 41 02 ff", `"b64:AAEC"`},
+		{"indefinite nested", "9f bf 61 78 9f 01 ff ff 82 9f ff bf ff ff", `[{"x":[1]},[[],{}]]`},
+		{"indefinite text key", "bf 7f 61 61 61 62 ff 01 ff", `{"ab":1}`},
+
+		{"half", "f9 3e00", `1.5`},
+		{"single", "fa 3fc00000", `1.5`},
+		{"double", "fb 3fb999999999999a", `0.1`},
+		{"undefined", "f7", `null`},
+		{"simple false true", "82 f4 f5", `[false,true]`},
+	}
+	for _, tt := range tests {
+		doc, err := FromCBOR(cborHex(t, tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := Verify(doc, VerifyLimits{}); err != nil {
+			t.Fatalf("%s: verify: %v", tt.name, err)
+		}
+		assertDocEqual(t, doc, tt.want)
+	}
+}
+
+func TestFromCBORHalfFloats(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"f9 0000", 0},
+		{"f9 8000", math.Copysign(0, -1)},
+		{"f9 0001", 5.960464477539063e-8},
+		{"f9 7bff", 65504},
+		{"f9 c400", -4},
+		{"f9 7c00", math.Inf(1)},
+		{"f9 fc00", math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		doc, err := FromCBOR(cborHex(t, tt.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+		v := mustRoot(t, doc)
+		if v.Type != TypeF64 || math.Float64bits(v.F64) != math.Float64bits(tt.want) {
+			t.Fatalf("%s: got %v %v, want %v", tt.in, v.Type, v.F64, tt.want)
+		}
+	}
+	doc, err := FromCBOR(cborHex(t, "f9 7e00"))
+	if err != nil {
+		t.Fatalf("half nan: %v", err)
+	}
+	if v := mustRoot(t, doc); v.Type != TypeF64 || !math.IsNaN(v.F64) {
+		t.Fatalf("half nan: got %v %v", v.Type, v.F64)
+	}
+}
+
+func TestFromCBORErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"truncated array", "82 01"},
+		{"truncated string", "63 6161"},
+		{"trailing bytes", "01 01"},
+		{"bare break", "ff"},
+		{"unterminated indefinite array", "9f 01"},
+		{"byte string key", "a1 41 00 01"},
+		{"array key", "a1 80 01"},
+		{"float key", "a1 f9 3c00 01"},
+		{"bignum key", "a1 c2 41 01 01"},
+		{"bignum of text", "c2 61 61"},
+		{"bignum of int", "c3 01"},
+		{"invalid utf-8 text", "61 ff"},
+		{"invalid utf-8 key", "a1 61 ff 01"},
+		{"unassigned simple", "f0"},
+		{"simple in two bytes", "f8 20"},
+		{"text chunk in bytes", "5f 61 61 ff"},
+	} {
+		if _, err := FromCBOR(cborHex(t, tt.in)); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	tron "github.com/starfederation/tron-go"
+	"github.com/starfederation/tron-go/merge"
+	"github.com/starfederation/tron-go/path"
+	jsonschema "github.com/starfederation/tron-go/schema"
+)
+
+type fromJSONCmd struct {
+	Input  string `arg:"" optional:"" help:"JSON input file."`
+	Output string `short:"o" help:"Output file (default stdout)."`
+}
+
+func (c *fromJSONCmd) Run() error {
+	data, err := readInput(c.Input)
+	if err != nil {
+		return err
+	}
+	doc, err := tron.FromJSON(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputName(c.Input), err)
+	}
+	return writeOutput(c.Output, doc)
+}
+
+type toJSONCmd struct {
+	Input  string `arg:"" optional:"" help:"TRON input file."`
+	Output string `short:"o" help:"Output file (default stdout)."`
+	Pretty bool   `short:"p" help:"Indent the JSON output."`
+}
+
+func (c *toJSONCmd) Run() error {
+	doc, err := readDocument(c.Input)
+	if err != nil {
+		return err
+	}
+	out, err := documentJSON(doc, c.Pretty)
+	if err != nil {
+		return err
+	}
+	return writeOutput(c.Output, out)
+}
+
+type queryCmd struct {
+	Expression string `arg:"" help:"JMESPath expression."`
+	Input      string `arg:"" optional:"" help:"TRON or JSON input file."`
+	Output     string `short:"o" help:"Output file (default stdout)."`
+	Pretty     bool   `short:"p" help:"Indent the JSON output."`
+	TRON       bool   `name:"tron" help:"Write the result as a TRON document instead of JSON."`
+}
+
+func (c *queryCmd) Run() error {
+	doc, err := readDocument(c.Input)
+	if err != nil {
+		return err
+	}
+	val, err := path.Search(c.Expression, doc)
+	if err != nil {
+		return err
+	}
+	result, err := valueDocument(doc, val)
+	if err != nil {
+		return err
+	}
+	if c.TRON {
+		return writeOutput(c.Output, result)
+	}
+	out, err := documentJSON(result, c.Pretty)
+	if err != nil {
+		return err
+	}
+	return writeOutput(c.Output, out)
+}
+
+type patchCmd struct {
+	Patch  string `arg:"" help:"Merge patch file (TRON or JSON)."`
+	Input  string `arg:"" optional:"" help:"TRON or JSON target file."`
+	Output string `short:"o" help:"Output file (default stdout)."`
+	JSON   bool   `name:"json" help:"Write the result as JSON instead of TRON."`
+	Pretty bool   `short:"p" help:"Indent the JSON output (implies --json)."`
+}
+
+func (c *patchCmd) Run() error {
+	patch, err := readDocument(c.Patch)
+	if err != nil {
+		return err
+	}
+	doc, err := readDocument(c.Input)
+	if err != nil {
+		return err
+	}
+	result, err := merge.ApplyMergePatch(doc, patch)
+	if err != nil {
+		return err
+	}
+	if !c.JSON && !c.Pretty {
+		return writeOutput(c.Output, result)
+	}
+	out, err := documentJSON(result, c.Pretty)
+	if err != nil {
+		return err
+	}
+	return writeOutput(c.Output, out)
+}
+
+// exitStatus is returned by a command that has already reported its failure
+// and only needs main to exit with the given status.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+type validateCmd struct {
+	Schema string `arg:"" help:"JSON Schema file (TRON or JSON)."`
+	Input  string `arg:"" optional:"" help:"TRON or JSON document file."`
+	Quiet  bool   `short:"q" help:"Only report failures through the exit status."`
+}
+
+func (c *validateCmd) Run() error {
+	schemaDoc, err := readDocument(c.Schema)
+	if err != nil {
+		return err
+	}
+	doc, err := readDocument(c.Input)
+	if err != nil {
+		return err
+	}
+	sch, err := jsonschema.CompileTRON(schemaDoc)
+	if err != nil {
+		return fmt.Errorf("compile schema: %w", err)
+	}
+	if err := sch.ValidateTRON(doc); err != nil {
+		if !c.Quiet {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitStatus(1)
+	}
+	if !c.Quiet {
+		fmt.Printf("%s: valid\n", inputName(c.Input))
+	}
+	return nil
+}
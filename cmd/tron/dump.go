@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+type dumpCmd struct {
+	Input  string `arg:"" optional:"" help:"TRON or JSON input file."`
+	Output string `short:"o" help:"Output file (default stdout)."`
+	Hex    bool   `short:"x" help:"Print the raw bytes of every node."`
+}
+
+func (c *dumpCmd) Run() error {
+	doc, err := readDocument(c.Input)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if c.Output != "" && c.Output != "-" {
+		f, err := os.Create(c.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return tron.DumpNodes(out, doc, c.Hex)
+}
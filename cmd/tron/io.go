@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+// readInput reads a file, or stdin when path is empty or "-".
+func readInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readDocument reads a TRON document. Inputs without the TRON header are
+// parsed as JSON, so every command accepts either format.
+func readDocument(path string) ([]byte, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	if isTRON(data) {
+		if _, err := tron.DetectDocType(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", inputName(path), err)
+		}
+		return data, nil
+	}
+	doc, err := tron.FromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", inputName(path), err)
+	}
+	return doc, nil
+}
+
+func isTRON(data []byte) bool {
+	return bytes.HasPrefix(data, tron.HeaderMagic[:])
+}
+
+func inputName(path string) string {
+	if path == "" || path == "-" {
+		return "stdin"
+	}
+	return path
+}
+
+// writeOutput writes data to a file, or stdout when path is empty or "-".
+func writeOutput(path string, data []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// documentJSON renders doc as JSON, indented when pretty is set.
+func documentJSON(doc []byte, pretty bool) ([]byte, error) {
+	var opts tron.JSONWriteOptions
+	if pretty {
+		opts.Indent = "  "
+	}
+	var buf bytes.Buffer
+	if err := tron.WriteJSONTo(&buf, doc, opts); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// valueDocument returns a document whose root is v.
+func valueDocument(doc []byte, v tron.Value) ([]byte, error) {
+	if v.Type == tron.TypeArr || v.Type == tron.TypeMap {
+		return tron.DocForRoot(doc, v.Offset)
+	}
+	return tron.EncodeScalarDocument(v)
+}
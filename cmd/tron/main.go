@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/alecthomas/kong"
+)
+
+type cli struct {
+	FromJSON fromJSONCmd `cmd:"" name:"fromjson" help:"Convert JSON to a TRON document."`
+	ToJSON   toJSONCmd   `cmd:"" name:"tojson" help:"Convert a TRON document to JSON."`
+	Query    queryCmd    `cmd:"" help:"Evaluate a JMESPath expression against a document."`
+	Patch    patchCmd    `cmd:"" help:"Apply a JSON Merge Patch (RFC 7386) to a document."`
+	Validate validateCmd `cmd:"" help:"Validate a document against a JSON Schema."`
+	Dump     dumpCmd     `cmd:"" help:"Print the node tree of a TRON document."`
+}
+
+func main() {
+	log.SetFlags(0)
+
+	var args cli
+	ctx := kong.Parse(&args,
+		kong.Name("tron"),
+		kong.Description("Inspect and convert TRON documents. Inputs default to stdin; '-' also means stdin."),
+		kong.UsageOnError(),
+	)
+	if err := ctx.Run(); err != nil {
+		var status exitStatus
+		if errors.As(err, &status) {
+			os.Exit(int(status))
+		}
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+// writeTemp writes data to name in dir and returns its path.
+func writeTemp(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func mustTRON(t *testing.T, s string) []byte {
+	t.Helper()
+	doc, err := tron.FromJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("from json %s: %v", s, err)
+	}
+	return doc
+}
+
+// outputJSON reads a command's output, converting TRON to JSON, and decodes
+// it so that key order does not matter.
+func outputJSON(t *testing.T, path string) any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if isTRON(data) {
+		s, err := tron.ToJSON(data)
+		if err != nil {
+			t.Fatalf("output to json: %v", err)
+		}
+		data = []byte(s)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("output %q is not JSON: %v", data, err)
+	}
+	return v
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	docJSON := writeTemp(t, dir, "doc.json", []byte(`{"a":{"b":[1,2]},"c":"x"}`))
+	docTRON := writeTemp(t, dir, "doc.tron", mustTRON(t, `{"a":{"b":[1,2]},"c":"x"}`))
+	patch := writeTemp(t, dir, "patch.json", []byte(`{"c":null,"d":true}`))
+	out := filepath.Join(dir, "out")
+
+	tests := []struct {
+		name     string
+		cmd      interface{ Run() error }
+		want     string
+		wantTRON bool
+	}{
+		{"fromjson", &fromJSONCmd{Input: docJSON, Output: out}, `{"a":{"b":[1,2]},"c":"x"}`, true},
+		{"tojson", &toJSONCmd{Input: docTRON, Output: out}, `{"a":{"b":[1,2]},"c":"x"}`, false},
+		{"tojson pretty", &toJSONCmd{Input: docTRON, Output: out, Pretty: true}, `{"a":{"b":[1,2]},"c":"x"}`, false},
+		{"tojson from json", &toJSONCmd{Input: docJSON, Output: out}, `{"a":{"b":[1,2]},"c":"x"}`, false},
+		{"query", &queryCmd{Expression: "a.b", Input: docTRON, Output: out}, `[1,2]`, false},
+		{"query scalar", &queryCmd{Expression: "a.b[1]", Input: docJSON, Output: out}, `2`, false},
+		{"query tron", &queryCmd{Expression: "a", Input: docTRON, Output: out, TRON: true}, `{"b":[1,2]}`, true},
+		{"patch", &patchCmd{Patch: patch, Input: docTRON, Output: out}, `{"a":{"b":[1,2]},"d":true}`, true},
+		{"patch json", &patchCmd{Patch: patch, Input: docJSON, Output: out, JSON: true}, `{"a":{"b":[1,2]},"d":true}`, false},
+		{"patch pretty", &patchCmd{Patch: patch, Input: docJSON, Output: out, Pretty: true}, `{"a":{"b":[1,2]},"d":true}`, false},
+	}
+	for _, tt := range tests {
+		os.Remove(out)
+		if err := tt.cmd.Run(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("%s: read output: %v", tt.name, err)
+		}
+		if isTRON(data) != tt.wantTRON {
+			t.Fatalf("%s: TRON output = %v, want %v", tt.name, isTRON(data), tt.wantTRON)
+		}
+		if !tt.wantTRON && !strings.HasSuffix(string(data), "\n") {
+			t.Fatalf("%s: JSON output %q lacks a final newline", tt.name, data)
+		}
+		var want any
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatalf("%s: bad want: %v", tt.name, err)
+		}
+		if got := outputJSON(t, out); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, want)
+		}
+	}
+
+	os.Remove(out)
+	if err := (&toJSONCmd{Input: docTRON, Output: out, Pretty: true}).Run(); err != nil {
+		t.Fatalf("pretty: %v", err)
+	}
+	if data, _ := os.ReadFile(out); !strings.Contains(string(data), "\n  \"") {
+		t.Fatalf("pretty output is not indented: %q", data)
+	}
+
+	os.Remove(out)
+	if err := (&dumpCmd{Input: docTRON, Output: out}).Run(); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	if data, _ := os.ReadFile(out); len(data) == 0 {
+		t.Fatalf("dump wrote nothing")
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.json")
+	badJSON := writeTemp(t, dir, "bad.json", []byte(`{"a":`))
+	doc := mustTRON(t, `{"a":1}`)
+	corrupt := writeTemp(t, dir, "corrupt.tron", doc[:len(doc)-3])
+	out := filepath.Join(dir, "out")
+
+	tests := []struct {
+		name string
+		cmd  interface{ Run() error }
+	}{
+		{"fromjson missing", &fromJSONCmd{Input: missing, Output: out}},
+		{"fromjson invalid", &fromJSONCmd{Input: badJSON, Output: out}},
+		{"tojson corrupt", &toJSONCmd{Input: corrupt, Output: out}},
+		{"query corrupt", &queryCmd{Expression: "a", Input: corrupt, Output: out}},
+		{"query syntax", &queryCmd{Expression: "a[", Input: badJSON, Output: out}},
+		{"patch missing", &patchCmd{Patch: missing, Input: corrupt, Output: out}},
+		{"dump invalid", &dumpCmd{Input: badJSON, Output: out}},
+	}
+	for _, tt := range tests {
+		err := tt.cmd.Run()
+		if err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+		var status exitStatus
+		if errors.As(err, &status) {
+			t.Fatalf("%s: reported %v instead of the error", tt.name, err)
+		}
+	}
+}
+
+func TestValidateExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	schema := writeTemp(t, dir, "schema.json", []byte(`{"type":"object","required":["a"],"properties":{"a":{"type":"integer"}}}`))
+	doc := mustTRON(t, `{"a":1}`)
+	valid := writeTemp(t, dir, "valid.tron", doc)
+	validJSON := writeTemp(t, dir, "valid.json", []byte(`{"a":2,"b":"extra"}`))
+	invalid := writeTemp(t, dir, "invalid.json", []byte(`{"a":"one"}`))
+	missingKey := writeTemp(t, dir, "missing.tron", mustTRON(t, `{"b":1}`))
+	corrupt := writeTemp(t, dir, "corrupt.tron", doc[:len(doc)-3])
+
+	tests := []struct {
+		name   string
+		input  string
+		status exitStatus
+		err    bool
+	}{
+		{name: "valid tron", input: valid},
+		{name: "valid json", input: validJSON},
+		{name: "wrong type", input: invalid, status: 1},
+		{name: "missing key", input: missingKey, status: 1},
+		{name: "corrupt", input: corrupt, err: true},
+	}
+	for _, tt := range tests {
+		err := (&validateCmd{Schema: schema, Input: tt.input, Quiet: true}).Run()
+		var status exitStatus
+		switch {
+		case tt.err:
+			if err == nil || errors.As(err, &status) {
+				t.Fatalf("%s: err = %v, want a read error", tt.name, err)
+			}
+		case tt.status != 0:
+			if !errors.As(err, &status) || status != tt.status {
+				t.Fatalf("%s: err = %v, want exit status %d", tt.name, err, tt.status)
+			}
+		case err != nil:
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+
+	badSchema := writeTemp(t, dir, "bad-schema.json", []byte(`{"type":7}`))
+	err := (&validateCmd{Schema: badSchema, Input: valid, Quiet: true}).Run()
+	var status exitStatus
+	if err == nil || errors.As(err, &status) {
+		t.Fatalf("bad schema: err = %v, want a compile error", err)
+	}
+}
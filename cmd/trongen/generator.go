@@ -409,7 +409,7 @@ func generatePackage(info *packageInfo, moduleRoot, modulePath string) ([]byte,
 	var imports []string
 	if isRootPackage {
 		tronPrefix = ""
-		imports = append(imports, "errors", `stdjson "encoding/json"`)
+		imports = append(imports, "errors")
 	} else {
 		imports = append(imports, fmt.Sprintf("%q", modulePath))
 	}
@@ -0,0 +1,174 @@
+package tron
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// CompactOptions controls Compact.
+type CompactOptions struct {
+	// KeepHistory is the number of historical roots kept in addition to the
+	// current root. Zero drops history entirely.
+	KeepHistory int
+	// Dedup stores byte-identical nodes once, which also shrinks documents
+	// that were built without Builder.SetDedup.
+	Dedup bool
+}
+
+// CompactStats reports the outcome of Compact.
+type CompactStats struct {
+	BytesBefore    int
+	BytesAfter     int
+	BytesReclaimed int
+	// RootsKept counts the current root plus retained historical roots.
+	RootsKept int
+}
+
+// Compact copies the nodes reachable from the current root, and from up to
+// opts.KeepHistory earlier roots, into a fresh document. Earlier roots are
+// found as History finds them. Every retained root is followed by its
+// trailer in the result.
+// Subtrees shared between retained versions are copied once and stay shared.
+// Node bytes are copied verbatim with child addresses rewritten, so the
+// result encodes the same values as the input.
+func Compact(doc []byte, opts CompactOptions) ([]byte, CompactStats, error) {
+	if opts.KeepHistory < 0 {
+		return nil, CompactStats{}, fmt.Errorf("keep history must be non-negative")
+	}
+	versions, err := historyVersions(doc, opts.KeepHistory+1)
+	if err != nil {
+		return nil, CompactStats{}, err
+	}
+	keep := len(versions)
+
+	c := compactor{
+		doc:     doc,
+		builder: NewBuilderWithCapacity(len(doc)),
+		copied:  make(map[uint32]uint32),
+	}
+	c.builder.SetDedup(opts.Dedup)
+	var out []byte
+	prev := uint32(0)
+	for i := keep - 1; i >= 0; i-- {
+		root, err := c.copyRoot(versions[i].RootOffset)
+		if err != nil {
+			return nil, CompactStats{}, err
+		}
+		out = c.builder.BytesWithTrailerInPlace(root, prev)
+		prev = root
+	}
+	stats := CompactStats{
+		BytesBefore:    len(doc),
+		BytesAfter:     len(out),
+		BytesReclaimed: len(doc) - len(out),
+		RootsKept:      keep,
+	}
+	return out, stats, nil
+}
+
+type compactor struct {
+	doc     []byte
+	builder *Builder
+	copied  map[uint32]uint32
+	scratch []byte
+}
+
+// copyRoot copies the root at off and guarantees it is the last node in the
+// buffer, so the trailer written next sits directly after it.
+func (c *compactor) copyRoot(off uint32) (uint32, error) {
+	newOff, err := c.copyNode(off)
+	if err != nil {
+		return 0, err
+	}
+	h, node, err := NodeSliceAt(c.builder.buf, newOff)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(newOff)+uint64(h.NodeLen) == uint64(len(c.builder.buf)) {
+		return newOff, nil
+	}
+	return c.builder.appendNode(node), nil
+}
+
+func (c *compactor) copyNode(off uint32) (uint32, error) {
+	if newOff, ok := c.copied[off]; ok {
+		return newOff, nil
+	}
+	h, node, err := NodeSliceAt(c.doc, off)
+	if err != nil {
+		return 0, err
+	}
+	start, count, err := nodeAddrRange(h, node)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		newOff := c.builder.AppendNode(node)
+		c.copied[off] = newOff
+		return newOff, nil
+	}
+	addrs := make([]uint32, count)
+	for i := range addrs {
+		child := binary.LittleEndian.Uint32(node[start+i*4:])
+		if child >= off {
+			return 0, fmt.Errorf("child offset %d not before parent %d", child, off)
+		}
+		newChild, err := c.copyNode(child)
+		if err != nil {
+			return 0, err
+		}
+		addrs[i] = newChild
+	}
+	c.scratch = append(c.scratch[:0], node...)
+	for i, addr := range addrs {
+		binary.LittleEndian.PutUint32(c.scratch[start+i*4:], addr)
+	}
+	newOff := c.builder.AppendNode(c.scratch)
+	c.copied[off] = newOff
+	return newOff, nil
+}
+
+// nodeAddrRange returns the position and number of the u32 addresses stored
+// in node. Scalar nodes have none.
+func nodeAddrRange(h NodeHeader, node []byte) (int, int, error) {
+	if h.Type != TypeArr && h.Type != TypeMap {
+		return 0, 0, nil
+	}
+	p := 1 + h.LenBytes
+	size := int(h.NodeLen)
+	switch {
+	case h.KeyType == KeyMap && h.Kind == NodeLeaf:
+		if (size-p)%8 != 0 {
+			return 0, 0, fmt.Errorf("map leaf payload misaligned")
+		}
+		return p, (size - p) / 4, nil
+	case h.KeyType == KeyMap:
+		if size < p+4 {
+			return 0, 0, fmt.Errorf("map branch node too small: %d", h.NodeLen)
+		}
+		bitmap := binary.LittleEndian.Uint32(node[p : p+4])
+		if bitmap&0xFFFF0000 != 0 {
+			return 0, 0, fmt.Errorf("map branch bitmap high bits must be zero")
+		}
+		p += 4
+		count := popcount16(uint16(bitmap))
+		if size < p+count*4 {
+			return 0, 0, fmt.Errorf("child address truncated")
+		}
+		return p, count, nil
+	default:
+		if size < p+3 {
+			return 0, 0, fmt.Errorf("array node too small: %d", h.NodeLen)
+		}
+		bitmap := binary.LittleEndian.Uint16(node[p+1 : p+3])
+		p += 3
+		if h.IsRoot {
+			p += 4
+		}
+		count := popcount16(bitmap)
+		if size < p+count*4 {
+			return 0, 0, fmt.Errorf("array node addresses truncated")
+		}
+		return p, count, nil
+	}
+}
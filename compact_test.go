@@ -0,0 +1,113 @@
+package tron
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// editedDoc returns a document edited n times through SetPointer, which
+// drops each earlier trailer.
+func editedDoc(t *testing.T, n int) []byte {
+	t.Helper()
+	doc := mustJSON(t, `{"n":0,"big":"`+strings.Repeat("x", 100)+`","list":[1,2,3]}`)
+	for i := 1; i <= n; i++ {
+		var err error
+		doc, err = SetPointer(doc, "/n", Value{Type: TypeI64, I64: int64(i)}, PointerCreateNone)
+		if err != nil {
+			t.Fatalf("set %d: %v", i, err)
+		}
+	}
+	return doc
+}
+
+func TestCompactKeepsHistory(t *testing.T) {
+	doc := editedDoc(t, 5)
+	before, err := History(doc)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	for _, keep := range []int{0, 1, 3, 5, 10} {
+		t.Run(fmt.Sprint("keep ", keep), func(t *testing.T) {
+			out, stats, err := Compact(doc, CompactOptions{KeepHistory: keep})
+			if err != nil {
+				t.Fatalf("compact: %v", err)
+			}
+			if err := Verify(out, VerifyLimits{}); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			wantRoots := min(keep+1, before.Len())
+			if stats.RootsKept != wantRoots {
+				t.Fatalf("kept %d roots, want %d", stats.RootsKept, wantRoots)
+			}
+			if stats.BytesBefore != len(doc) || stats.BytesAfter != len(out) || stats.BytesReclaimed != len(doc)-len(out) {
+				t.Fatalf("stats %+v for %d -> %d bytes", stats, len(doc), len(out))
+			}
+			if keep < before.Len()-1 && len(out) >= len(doc) {
+				t.Fatalf("compacted %d bytes to %d", len(doc), len(out))
+			}
+			after, err := History(out)
+			if err != nil {
+				t.Fatalf("history after: %v", err)
+			}
+			if after.Len() != wantRoots {
+				t.Fatalf("history after has %d versions, want %d", after.Len(), wantRoots)
+			}
+			for i := range wantRoots {
+				got, err := after.Document(i)
+				if err != nil {
+					t.Fatalf("document %d: %v", i, err)
+				}
+				orig, err := before.Document(i)
+				if err != nil {
+					t.Fatalf("original %d: %v", i, err)
+				}
+				ok, err := Equal(got, mustRoot(t, got), orig, mustRoot(t, orig))
+				if err != nil || !ok {
+					t.Fatalf("version %d differs from the original: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompactShrinksAndDedups(t *testing.T) {
+	doc := editedDoc(t, 20)
+	out, stats, err := Compact(doc, CompactOptions{})
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if stats.BytesReclaimed <= 0 || len(out) >= len(doc) {
+		t.Fatalf("compact reclaimed %d bytes", stats.BytesReclaimed)
+	}
+	// Compacting again reclaims nothing more.
+	again, stats, err := Compact(out, CompactOptions{})
+	if err != nil {
+		t.Fatalf("compact again: %v", err)
+	}
+	if stats.BytesReclaimed != 0 || len(again) != len(out) {
+		t.Fatalf("second compaction reclaimed %d bytes", stats.BytesReclaimed)
+	}
+
+	dup := mustJSON(t, `[{"a":"same value"},{"a":"same value"},{"a":"same value"}]`)
+	plain, _, err := Compact(dup, CompactOptions{})
+	if err != nil {
+		t.Fatalf("compact plain: %v", err)
+	}
+	deduped, _, err := Compact(dup, CompactOptions{Dedup: true})
+	if err != nil {
+		t.Fatalf("compact dedup: %v", err)
+	}
+	if len(deduped) >= len(plain) {
+		t.Fatalf("dedup gave %d bytes, plain %d", len(deduped), len(plain))
+	}
+	if err := Verify(deduped, VerifyLimits{}); err != nil {
+		t.Fatalf("verify dedup: %v", err)
+	}
+	if ok, err := Equal(deduped, mustRoot(t, deduped), dup, mustRoot(t, dup)); err != nil || !ok {
+		t.Fatalf("dedup changed the value: %v", err)
+	}
+	if _, _, err := Compact(doc, CompactOptions{KeepHistory: -1}); err == nil {
+		t.Fatalf("accepted negative KeepHistory")
+	}
+}
@@ -0,0 +1,309 @@
+package tron
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Cursor navigates a document by key and index without decoding anything
+// until a leaf accessor such as Text, Int64 or Len is called.
+//
+// Navigation methods return new cursors and never fail; accessors return the
+// zero value when the path is missing or holds another type, and record the
+// first such error. Cursors derived from the same NewCursor or CursorAt call
+// share that error, so a chain of reads can be checked once with Err:
+//
+//	c := tron.NewCursor(doc)
+//	name := c.Key("users").Index(3).Key("name").Text()
+//	age := c.Key("users").Index(3).Key("age").Int64()
+//	if err := c.Err(); err != nil {
+//		return err
+//	}
+//
+// Each accessor walks the path from the start. A Cursor is not safe for
+// concurrent use by cursors sharing an error.
+type Cursor struct {
+	state *cursorState
+	last  *cursorStep
+}
+
+type cursorState struct {
+	doc []byte
+	// start is the starting value; hasStart is false until the document
+	// root has been decoded.
+	start    Value
+	hasStart bool
+	err      error
+}
+
+// cursorStep is a map key or, when isIndex is set, an array index. Steps
+// link to the step before them, so cursors derived from one another share
+// their common prefix.
+type cursorStep struct {
+	parent  *cursorStep
+	depth   int
+	key     string
+	index   int
+	isIndex bool
+}
+
+// NewCursor returns a cursor at the root of doc.
+func NewCursor(doc []byte) Cursor {
+	return Cursor{state: &cursorState{doc: doc}}
+}
+
+// CursorAt returns a cursor at v, which must refer to doc when it is a map or
+// array.
+func CursorAt(doc []byte, v Value) Cursor {
+	return Cursor{state: &cursorState{doc: doc, start: v, hasStart: true}}
+}
+
+// Key returns a cursor at key in the current map.
+func (c Cursor) Key(key string) Cursor {
+	return c.step(cursorStep{key: key})
+}
+
+// Index returns a cursor at index i in the current array.
+func (c Cursor) Index(i int) Cursor {
+	return c.step(cursorStep{index: i, isIndex: true})
+}
+
+func (c Cursor) step(s cursorStep) Cursor {
+	s.parent = c.last
+	if c.last != nil {
+		s.depth = c.last.depth
+	}
+	s.depth++
+	return Cursor{state: c.state, last: &s}
+}
+
+// steps returns the path from the start in order.
+func (c Cursor) steps() []*cursorStep {
+	if c.last == nil {
+		return nil
+	}
+	steps := make([]*cursorStep, c.last.depth)
+	for s := c.last; s != nil; s = s.parent {
+		steps[s.depth-1] = s
+	}
+	return steps
+}
+
+// Err returns the first error recorded by any cursor sharing this one's
+// starting point.
+func (c Cursor) Err() error {
+	return c.state.err
+}
+
+// Path returns the cursor position as a JSON Pointer.
+func (c Cursor) Path() string {
+	return cursorPath(c.steps())
+}
+
+func cursorPath(steps []*cursorStep) string {
+	var path string
+	for _, s := range steps {
+		if s.isIndex {
+			path = pointerAppendIndex(path, uint32(s.index))
+		} else {
+			path = pointerAppendKey(path, []byte(s.key))
+		}
+	}
+	return path
+}
+
+// resolve walks the path. It reports false without an error when a key or
+// index is missing or a step meets a value of the wrong type, with missing
+// saying which.
+func (c Cursor) resolve() (val Value, ok bool, missing string, err error) {
+	st := c.state
+	if !st.hasStart {
+		root, err := documentRoot(st.doc)
+		if err != nil {
+			return Value{}, false, "", err
+		}
+		st.start, st.hasStart = root, true
+	}
+	cur := st.start
+	steps := c.steps()
+	for i, s := range steps {
+		switch {
+		case s.isIndex && cur.Type == TypeArr:
+			length, err := arrayRootLength(st.doc, cur.Offset)
+			if err != nil {
+				return Value{}, false, "", err
+			}
+			if s.index < 0 || uint64(s.index) >= uint64(length) {
+				return Value{}, false, fmt.Sprintf("index %d out of range at %q", s.index, cursorPath(steps[:i])), nil
+			}
+			next, present, err := arrGet(st.doc, cur.Offset, uint32(s.index), true)
+			if err != nil {
+				return Value{}, false, "", err
+			}
+			if !present {
+				next = Value{Type: TypeNil}
+			}
+			cur = next
+		case !s.isIndex && cur.Type == TypeMap:
+			next, present, err := MapGet(st.doc, cur.Offset, []byte(s.key))
+			if err != nil {
+				return Value{}, false, "", err
+			}
+			if !present {
+				return Value{}, false, fmt.Sprintf("missing key %q at %q", s.key, cursorPath(steps[:i])), nil
+			}
+			cur = next
+		default:
+			return Value{}, false, fmt.Sprintf("%q is %s, not %s", cursorPath(steps[:i]), cur.Type, stepContainer(s)), nil
+		}
+	}
+	return cur, true, "", nil
+}
+
+func stepContainer(s *cursorStep) string {
+	if s.isIndex {
+		return "arr"
+	}
+	return "map"
+}
+
+func (c Cursor) fail(err error) {
+	if c.state.err == nil {
+		c.state.err = err
+	}
+}
+
+// lookup resolves the cursor and records an error when the value is missing
+// or its type is not one of types.
+func (c Cursor) lookup(types ...ValueType) (Value, bool) {
+	val, ok, missing, err := c.resolve()
+	if err != nil {
+		c.fail(err)
+		return Value{}, false
+	}
+	if !ok {
+		c.fail(errors.New(missing))
+		return Value{}, false
+	}
+	if len(types) == 0 {
+		return val, true
+	}
+	for _, t := range types {
+		if val.Type == t {
+			return val, true
+		}
+	}
+	c.fail(fmt.Errorf("%q is %s, not %s", c.Path(), val.Type, types[0]))
+	return Value{}, false
+}
+
+// Exists reports whether the path resolves to a value. Missing keys,
+// out-of-range indices and steps through scalars report false without
+// recording an error.
+func (c Cursor) Exists() bool {
+	_, ok, _, err := c.resolve()
+	if err != nil {
+		c.fail(err)
+	}
+	return ok
+}
+
+// Value returns the value at the cursor.
+func (c Cursor) Value() Value {
+	val, _ := c.lookup()
+	return val
+}
+
+// Type returns the type of the value at the cursor, or TypeNil when it is
+// missing. Like Exists, it records no error for a missing value.
+func (c Cursor) Type() ValueType {
+	val, _, _, err := c.resolve()
+	if err != nil {
+		c.fail(err)
+	}
+	return val.Type
+}
+
+// Text returns the txt value at the cursor.
+func (c Cursor) Text() string {
+	val, _ := c.lookup(TypeTxt)
+	return string(val.Bytes)
+}
+
+// String returns the txt value at the cursor, or "" when the path is missing
+// or holds another type. Unlike Text it records no error, so formatting or
+// logging a Cursor leaves Err untouched.
+func (c Cursor) String() string {
+	val, ok, _, err := c.resolve()
+	if err != nil || !ok || val.Type != TypeTxt {
+		return ""
+	}
+	return string(val.Bytes)
+}
+
+// Bytes returns the bin or txt value at the cursor. The result aliases the
+// document.
+func (c Cursor) Bytes() []byte {
+	val, _ := c.lookup(TypeBin, TypeTxt)
+	return val.Bytes
+}
+
+// Int64 returns the i64 value at the cursor.
+func (c Cursor) Int64() int64 {
+	val, _ := c.lookup(TypeI64)
+	return val.I64
+}
+
+// Float64 returns the f64 value at the cursor, converting an i64.
+func (c Cursor) Float64() float64 {
+	val, ok := c.lookup(TypeF64, TypeI64)
+	if ok && val.Type == TypeI64 {
+		return float64(val.I64)
+	}
+	return val.F64
+}
+
+// Bool returns the bit value at the cursor.
+func (c Cursor) Bool() bool {
+	val, _ := c.lookup(TypeBit)
+	return val.Bool
+}
+
+// Len returns the number of elements of the array or entries of the map at
+// the cursor.
+func (c Cursor) Len() int {
+	val, ok := c.lookup(TypeArr, TypeMap)
+	if !ok {
+		return 0
+	}
+	if val.Type == TypeArr {
+		length, err := arrayRootLength(c.state.doc, val.Offset)
+		if err != nil {
+			c.fail(err)
+		}
+		return int(length)
+	}
+	n, err := MapLen(c.state.doc, val.Offset)
+	if err != nil {
+		c.fail(err)
+	}
+	return n
+}
+
+// Keys returns the keys of the map at the cursor in stored order.
+func (c Cursor) Keys() []string {
+	val, ok := c.lookup(TypeMap)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	err := MapEach(c.state.doc, val.Offset, func(key []byte, _ Value) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		c.fail(err)
+		return nil
+	}
+	return keys
+}
@@ -0,0 +1,187 @@
+package tron
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const cursorTestJSON = `{"users":[{"name":"ada","age":36,"tags":["x"]},{"name":"bob","score":1.5,"ok":true}],"a/b":{"~":"esc"},"bin":"b64:AAE="}`
+
+func TestCursorReads(t *testing.T) {
+	c := NewCursor(mustJSON(t, cursorTestJSON))
+	users := c.Key("users")
+	if got := users.Index(0).Key("name").Text(); got != "ada" {
+		t.Fatalf("name = %q", got)
+	}
+	if got := users.Index(0).Key("age").Int64(); got != 36 {
+		t.Fatalf("age = %d", got)
+	}
+	if got := users.Index(0).Key("age").Float64(); got != 36 {
+		t.Fatalf("age as float = %v", got)
+	}
+	if got := users.Index(1).Key("score").Float64(); got != 1.5 {
+		t.Fatalf("score = %v", got)
+	}
+	if !users.Index(1).Key("ok").Bool() {
+		t.Fatalf("ok = false")
+	}
+	if got := users.Len(); got != 2 {
+		t.Fatalf("users len = %d", got)
+	}
+	if got := users.Index(0).Len(); got != 3 {
+		t.Fatalf("user len = %d", got)
+	}
+	keys := users.Index(1).Keys()
+	slices.Sort(keys)
+	if got := strings.Join(keys, ","); got != "name,ok,score" {
+		t.Fatalf("keys = %s", got)
+	}
+	if got := c.Key("a/b").Key("~").Text(); got != "esc" {
+		t.Fatalf("escaped = %q", got)
+	}
+	if got := c.Key("bin").Bytes(); string(got) != "\x00\x01" {
+		t.Fatalf("bin = %q", got)
+	}
+	if got := users.Index(0).Key("name").Bytes(); string(got) != "ada" {
+		t.Fatalf("txt bytes = %q", got)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if got := c.Key("a/b").Key("~").Path(); got != "/a~1b/~0" {
+		t.Fatalf("path = %q", got)
+	}
+}
+
+func TestCursorErrors(t *testing.T) {
+	doc := mustJSON(t, cursorTestJSON)
+	tests := []struct {
+		name string
+		read func(c Cursor)
+		err  string
+	}{
+		{"missing key", func(c Cursor) { _ = c.Key("nope").Text() }, `missing key "nope" at ""`},
+		{"missing nested key", func(c Cursor) { _ = c.Key("users").Index(0).Key("email").Text() }, `missing key "email" at "/users/0"`},
+		{"index out of range", func(c Cursor) { _ = c.Key("users").Index(2).Key("name").Text() }, `index 2 out of range at "/users"`},
+		{"key on array", func(c Cursor) { _ = c.Key("users").Key("name").Text() }, `"/users" is arr, not map`},
+		{"index on map", func(c Cursor) { _ = c.Key("users").Index(0).Index(0).Int64() }, `"/users/0" is map, not arr`},
+		{"step through scalar", func(c Cursor) { _ = c.Key("bin").Key("x").Bool() }, `"/bin" is bin, not map`},
+		{"string of i64", func(c Cursor) { _ = c.Key("users").Index(0).Key("age").Text() }, `"/users/0/age" is i64, not txt`},
+		{"int of f64", func(c Cursor) { _ = c.Key("users").Index(1).Key("score").Int64() }, `"/users/1/score" is f64, not i64`},
+		{"len of txt", func(c Cursor) { _ = c.Key("users").Index(0).Key("name").Len() }, `"/users/0/name" is txt, not arr`},
+		{"keys of arr", func(c Cursor) { _ = c.Key("users").Keys() }, `"/users" is arr, not map`},
+		{"bool of map", func(c Cursor) { _ = c.Bool() }, `"" is map, not bit`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCursor(doc)
+			tt.read(c)
+			if err := c.Err(); err == nil || err.Error() != tt.err {
+				t.Fatalf("err = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCursorFirstErrorWins(t *testing.T) {
+	c := NewCursor(mustJSON(t, cursorTestJSON))
+	if got := c.Key("nope").Int64(); got != 0 {
+		t.Fatalf("missing int = %d", got)
+	}
+	if got := c.Key("users").Index(0).Key("name").Text(); got != "ada" {
+		t.Fatalf("name after error = %q", got)
+	}
+	_ = c.Key("users").Int64()
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Fatalf("err = %v", err)
+	}
+	// Cursors from separate NewCursor calls keep separate errors.
+	if err := NewCursor(c.state.doc).Err(); err != nil {
+		t.Fatalf("fresh cursor err = %v", err)
+	}
+}
+
+func TestCursorExistsAndType(t *testing.T) {
+	c := NewCursor(mustJSON(t, `{"a":null,"b":[1]}`))
+	if !c.Key("a").Exists() || c.Key("a").Type() != TypeNil {
+		t.Fatalf("null member should exist with type nil")
+	}
+	if c.Key("z").Exists() || c.Key("b").Index(1).Exists() || c.Key("b").Index(0).Key("x").Exists() {
+		t.Fatalf("missing paths should not exist")
+	}
+	if c.Key("z").Type() != TypeNil || c.Key("b").Type() != TypeArr {
+		t.Fatalf("unexpected types")
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("Exists and Type recorded %v", err)
+	}
+	// A corrupt document is an error even for Exists.
+	bad := NewCursor([]byte("TRON"))
+	if bad.Exists() || bad.Err() == nil {
+		t.Fatalf("corrupt document: exists or no error")
+	}
+}
+
+func TestCursorAt(t *testing.T) {
+	doc := mustJSON(t, cursorTestJSON)
+	user := NewCursor(doc).Key("users").Index(1).Value()
+	c := CursorAt(doc, user)
+	if got := c.Key("name").Text(); got != "bob" || c.Err() != nil {
+		t.Fatalf("name = %q err = %v", got, c.Err())
+	}
+	_ = c.Key("age").Int64()
+	if err := c.Err(); err == nil || err.Error() != `missing key "age" at ""` {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCursorStringRecordsNothing(t *testing.T) {
+	c := NewCursor(mustJSON(t, cursorTestJSON))
+	name := c.Key("users").Index(0).Key("name")
+	if got := fmt.Sprint(name); got != "ada" {
+		t.Fatalf("Sprint = %q", got)
+	}
+	for _, other := range []Cursor{c.Key("nope"), c.Key("users").Index(0).Key("age"), c.Key("users").Index(9), c.Key("bin").Key("x")} {
+		if got := fmt.Sprintf("%v|%s", other, other); got != "|" {
+			t.Fatalf("formatted %s as %q", other.Path(), got)
+		}
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("formatting recorded %v", err)
+	}
+	if got := c.Key("nope").Text(); got != "" || c.Err() == nil {
+		t.Fatalf("Text of a missing key = %q, err %v", got, c.Err())
+	}
+}
+
+func TestCursorSharesSteps(t *testing.T) {
+	c := NewCursor(mustJSON(t, `{"a":{"x":1,"y":[10,20]},"b":2}`))
+	a := c.Key("a")
+	x, y := a.Key("x"), a.Key("y")
+	y0, y1 := y.Index(0), y.Index(1)
+	if x.Int64() != 1 || y0.Int64() != 10 || y1.Int64() != 20 || c.Key("b").Int64() != 2 || c.Err() != nil {
+		t.Fatalf("siblings interfere: %d %d %d err %v", x.Int64(), y0.Int64(), y1.Int64(), c.Err())
+	}
+	if x.Path() != "/a/x" || y1.Path() != "/a/y/1" || a.Path() != "/a" || c.Path() != "" {
+		t.Fatalf("paths %q %q %q %q", x.Path(), y1.Path(), a.Path(), c.Path())
+	}
+	if y1.last.parent != y.last || y.last.parent != x.last.parent {
+		t.Fatalf("derived cursors do not share their parent steps")
+	}
+
+	// A long chain of steps is built in linear time and resolves in order.
+	const depth = 2000
+	doc := mustJSON(t, strings.Repeat(`{"k":[`, depth)+`"leaf"`+strings.Repeat(`]}`, depth))
+	deep := NewCursor(doc)
+	for range depth {
+		deep = deep.Key("k").Index(0)
+	}
+	if got := deep.Text(); got != "leaf" || deep.Err() != nil {
+		t.Fatalf("deep = %q, err %v", got, deep.Err())
+	}
+	if got := deep.Key("k").Path(); len(got) != depth*len("/k/0")+len("/k") {
+		t.Fatalf("deep path has length %d", len(got))
+	}
+}
@@ -0,0 +1,84 @@
+package tron
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupDocKeepsHistory(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"n":0,"tags":["a","b"]}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	d, err := NewDoc(doc)
+	if err != nil {
+		t.Fatalf("new doc: %v", err)
+	}
+	d.builder.SetDedup(true)
+	// The third commit encodes the same root node as the first, which
+	// deduplication resolves to the first commit's offset; the fourth
+	// commit then walks back through it.
+	for _, n := range []int64{1, 2, 1, 3} {
+		err := d.Update(func(tx *Txn) error {
+			return tx.SetKey("n", Value{Type: TypeI64, I64: n})
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", n, err)
+		}
+	}
+	out := d.Bytes()
+	if err := Verify(out, VerifyLimits{}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	hist, err := History(out)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	want := []int64{3, 1, 2, 1, 0}
+	if hist.Len() != len(want) {
+		t.Fatalf("history has %d versions, want %d", hist.Len(), len(want))
+	}
+	for i, w := range want {
+		view, err := hist.Document(i)
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		c := NewCursor(view)
+		if n, tags := c.Key("n").Int64(), c.Key("tags").Len(); n != w || tags != 2 || c.Err() != nil {
+			t.Fatalf("version %d: n=%d tags=%d err=%v, want n=%d", i, n, tags, c.Err(), w)
+		}
+	}
+}
+
+func TestDedupJSONWorkspace(t *testing.T) {
+	input := []byte("[" + strings.Repeat(`{"host":"api-1","ok":true},`, 50) + `{"host":"api-1","ok":true}]`)
+	plain, err := FromJSONWithOptions(input, JSONReadOptions{})
+	if err != nil {
+		t.Fatalf("plain: %v", err)
+	}
+	dedup, err := FromJSONWithOptions(input, JSONReadOptions{Dedup: true})
+	if err != nil {
+		t.Fatalf("dedup: %v", err)
+	}
+	if len(dedup) >= len(plain)/10 {
+		t.Fatalf("dedup size %d, plain size %d", len(dedup), len(plain))
+	}
+	if err := Verify(dedup, VerifyLimits{}); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if ok, err := Equal(plain, mustRoot(t, plain), dedup, mustRoot(t, dedup)); err != nil || !ok {
+		t.Fatalf("documents differ: %v", err)
+	}
+	if _, err := History(dedup); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+}
+
+func mustRoot(t *testing.T, doc []byte) Value {
+	t.Helper()
+	root, err := documentRoot(doc)
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	return root
+}
@@ -0,0 +1,487 @@
+package tron
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ChangeKind classifies a single difference between two values.
+type ChangeKind uint8
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+// String returns the lowercase name of the change kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes a difference at a JSON pointer path.
+// Old is set for removed and modified values and refers to the old document;
+// New is set for added and modified values and refers to the new document.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  Value
+	New  Value
+}
+
+// DiffRoots compares two roots stored in the same document.
+func DiffRoots(doc []byte, oldRoot, newRoot uint32) ([]Change, error) {
+	oldVal, err := DecodeValueAt(doc, oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newVal, err := DecodeValueAt(doc, newRoot)
+	if err != nil {
+		return nil, err
+	}
+	var out []Change
+	err = DiffValues(doc, oldVal, doc, newVal, func(c Change) error {
+		out = append(out, c)
+		return nil
+	})
+	return out, err
+}
+
+// DiffValues compares oldVal in oldDoc with newVal in newDoc and calls fn for each change.
+// Arrays are compared by index and maps by key. When both documents share a
+// byte prefix, as they do after NewBuilderFromDocument, subtrees at the same
+// offset inside that prefix are treated as equal without being walked.
+// Finding the prefix costs one comparison pass over the shorter document,
+// unless both documents are views of the same buffer.
+// Removed array elements are reported from the highest index down.
+func DiffValues(oldDoc []byte, oldVal Value, newDoc []byte, newVal Value, fn func(Change) error) error {
+	d := differ{
+		oldDoc: oldDoc,
+		newDoc: newDoc,
+		shared: sharedPrefixLen(oldDoc, newDoc),
+		fn:     fn,
+	}
+	return d.diffValue("", oldVal, newVal)
+}
+
+func sharedPrefixLen(a, b []byte) uint32 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) > 0 && len(b) > 0 && &a[0] == &b[0] {
+		return uint32(len(a))
+	}
+	// Compare in blocks to find the first mismatch, then bytewise within it.
+	const block = 64
+	i := 0
+	for i+block <= len(a) && bytes.Equal(a[i:i+block], b[i:i+block]) {
+		i += block
+	}
+	for i < len(a) && a[i] == b[i] {
+		i++
+	}
+	return uint32(i)
+}
+
+type differ struct {
+	oldDoc []byte
+	newDoc []byte
+	shared uint32
+	fn     func(Change) error
+}
+
+// sameNode reports whether two node offsets name an identical subtree.
+// Nodes only reference earlier offsets, so a node that ends inside the shared
+// prefix has an identical subtree in both documents.
+func (d *differ) sameNode(a, b uint32) bool {
+	if a != b || a >= d.shared {
+		return false
+	}
+	h, err := ParseNodeHeader(d.oldDoc[a:])
+	if err != nil {
+		return false
+	}
+	return uint64(a)+uint64(h.NodeLen) <= uint64(d.shared)
+}
+
+func (d *differ) diffValue(path string, a, b Value) error {
+	switch {
+	case a.Type == TypeMap && b.Type == TypeMap:
+		return d.diffMap(path, a.Offset, b.Offset)
+	case a.Type == TypeArr && b.Type == TypeArr:
+		return d.diffArray(path, a.Offset, b.Offset)
+	case a.Type == TypeArr || a.Type == TypeMap || b.Type == TypeArr || b.Type == TypeMap:
+		return d.fn(Change{Path: path, Kind: ChangeModified, Old: a, New: b})
+	case valueEqual(a, b):
+		return nil
+	default:
+		return d.fn(Change{Path: path, Kind: ChangeModified, Old: a, New: b})
+	}
+}
+
+type diffEntry struct {
+	key []byte
+	val Value
+}
+
+func (d *differ) diffMap(path string, aOff, bOff uint32) error {
+	return d.diffMapNodes(path, aOff, bOff, 0)
+}
+
+func (d *differ) diffMapNodes(path string, aOff, bOff uint32, depth int) error {
+	if d.sameNode(aOff, bOff) {
+		return nil
+	}
+	if depth > maxDepth32 {
+		return fmt.Errorf("map depth exceeds max")
+	}
+	ah, aNode, err := NodeSliceAt(d.oldDoc, aOff)
+	if err != nil {
+		return err
+	}
+	bh, bNode, err := NodeSliceAt(d.newDoc, bOff)
+	if err != nil {
+		return err
+	}
+	if ah.KeyType != KeyMap || bh.KeyType != KeyMap {
+		return fmt.Errorf("node is not a map")
+	}
+	if ah.Kind == NodeBranch && bh.Kind == NodeBranch {
+		aBranch, err := ParseMapBranchNode(aNode)
+		if err != nil {
+			return err
+		}
+		defer releaseMapBranchNode(&aBranch)
+		bBranch, err := ParseMapBranchNode(bNode)
+		if err != nil {
+			return err
+		}
+		defer releaseMapBranchNode(&bBranch)
+		ai, bi := 0, 0
+		for slot := 0; slot < hamtSlots; slot++ {
+			aHas := (aBranch.Bitmap>>uint(slot))&1 == 1
+			bHas := (bBranch.Bitmap>>uint(slot))&1 == 1
+			switch {
+			case aHas && bHas:
+				err = d.diffMapNodes(path, aBranch.Children[ai], bBranch.Children[bi], depth+1)
+			case aHas:
+				err = d.emitMapSide(path, d.oldDoc, aBranch.Children[ai], depth+1, ChangeRemoved)
+			case bHas:
+				err = d.emitMapSide(path, d.newDoc, bBranch.Children[bi], depth+1, ChangeAdded)
+			}
+			if err != nil {
+				return err
+			}
+			if aHas {
+				ai++
+			}
+			if bHas {
+				bi++
+			}
+		}
+		return nil
+	}
+
+	aEntries, err := collectDiffEntries(d.oldDoc, aOff, depth)
+	if err != nil {
+		return err
+	}
+	bEntries, err := collectDiffEntries(d.newDoc, bOff, depth)
+	if err != nil {
+		return err
+	}
+	i, j := 0, 0
+	for i < len(aEntries) || j < len(bEntries) {
+		var cmp int
+		switch {
+		case i == len(aEntries):
+			cmp = 1
+		case j == len(bEntries):
+			cmp = -1
+		default:
+			cmp = bytes.Compare(aEntries[i].key, bEntries[j].key)
+		}
+		switch {
+		case cmp < 0:
+			err = d.fn(Change{Path: pointerAppendKey(path, aEntries[i].key), Kind: ChangeRemoved, Old: aEntries[i].val})
+			i++
+		case cmp > 0:
+			err = d.fn(Change{Path: pointerAppendKey(path, bEntries[j].key), Kind: ChangeAdded, New: bEntries[j].val})
+			j++
+		default:
+			err = d.diffValue(pointerAppendKey(path, aEntries[i].key), aEntries[i].val, bEntries[j].val)
+			i++
+			j++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) emitMapSide(path string, doc []byte, off uint32, depth int, kind ChangeKind) error {
+	entries, err := collectDiffEntries(doc, off, depth)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		c := Change{Path: pointerAppendKey(path, e.key), Kind: kind}
+		if kind == ChangeRemoved {
+			c.Old = e.val
+		} else {
+			c.New = e.val
+		}
+		if err := d.fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func collectDiffEntries(doc []byte, off uint32, depth int) ([]diffEntry, error) {
+	var out []diffEntry
+	err := mapEach(doc, off, depth, func(key []byte, val Value) error {
+		out = append(out, diffEntry{key: key, val: val})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return bytes.Compare(out[i].key, out[j].key) < 0
+	})
+	return out, nil
+}
+
+func (d *differ) diffArray(path string, aOff, bOff uint32) error {
+	if d.sameNode(aOff, bOff) {
+		return nil
+	}
+	aLen, err := arrayRootLength(d.oldDoc, aOff)
+	if err != nil {
+		return err
+	}
+	bLen, err := arrayRootLength(d.newDoc, bOff)
+	if err != nil {
+		return err
+	}
+	common := min(aLen, bLen)
+	aShift, err := arrayNodeShift(d.oldDoc, aOff)
+	if err != nil {
+		return err
+	}
+	bShift, err := arrayNodeShift(d.newDoc, bOff)
+	if err != nil {
+		return err
+	}
+	if common > 0 {
+		if aShift == bShift {
+			err = d.diffArrayNodes(path, aOff, bOff, 0, common)
+		} else {
+			err = d.diffArrayDense(path, aOff, bOff, common)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := common; i < bLen; i++ {
+		val, ok, err := arrGet(d.newDoc, bOff, i, true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			val = Value{Type: TypeNil}
+		}
+		if err := d.fn(Change{Path: pointerAppendIndex(path, i), Kind: ChangeAdded, New: val}); err != nil {
+			return err
+		}
+	}
+	for i := aLen; i > common; i-- {
+		val, ok, err := arrGet(d.oldDoc, aOff, i-1, true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			val = Value{Type: TypeNil}
+		}
+		if err := d.fn(Change{Path: pointerAppendIndex(path, i-1), Kind: ChangeRemoved, Old: val}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) diffArrayDense(path string, aOff, bOff uint32, common uint32) error {
+	aVals, err := arrayDenseValues(d.oldDoc, aOff, common)
+	if err != nil {
+		return err
+	}
+	bVals, err := arrayDenseValues(d.newDoc, bOff, common)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < common; i++ {
+		if err := d.diffValue(pointerAppendIndex(path, i), aVals[i], bVals[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffArrayNodes compares two array subtrees with the same shift, covering
+// indexes below limit. base is the index of the subtrees' first slot.
+func (d *differ) diffArrayNodes(path string, aOff, bOff uint32, base uint32, limit uint32) error {
+	if d.sameNode(aOff, bOff) {
+		return nil
+	}
+	ah, aNode, err := NodeSliceAt(d.oldDoc, aOff)
+	if err != nil {
+		return err
+	}
+	bh, bNode, err := NodeSliceAt(d.newDoc, bOff)
+	if err != nil {
+		return err
+	}
+	if ah.KeyType != KeyArr || bh.KeyType != KeyArr {
+		return fmt.Errorf("node is not an array")
+	}
+	if ah.Kind != bh.Kind {
+		return fmt.Errorf("array node kinds differ at same shift")
+	}
+	if ah.Kind == NodeLeaf {
+		aLeaf, err := ParseArrayLeafNode(aNode)
+		if err != nil {
+			return err
+		}
+		defer releaseArrayLeafNode(&aLeaf)
+		bLeaf, err := ParseArrayLeafNode(bNode)
+		if err != nil {
+			return err
+		}
+		defer releaseArrayLeafNode(&bLeaf)
+		ai, bi := 0, 0
+		for slot := uint32(0); slot < 16; slot++ {
+			aHas := (aLeaf.Bitmap>>slot)&1 == 1
+			bHas := (bLeaf.Bitmap>>slot)&1 == 1
+			index := base + slot
+			if index < limit && (aHas || bHas) {
+				aVal := Value{Type: TypeNil}
+				bVal := Value{Type: TypeNil}
+				if aHas {
+					if aVal, err = DecodeValueAt(d.oldDoc, aLeaf.ValueAddrs[ai]); err != nil {
+						return err
+					}
+				}
+				if bHas {
+					if bVal, err = DecodeValueAt(d.newDoc, bLeaf.ValueAddrs[bi]); err != nil {
+						return err
+					}
+				}
+				if err := d.diffValue(pointerAppendIndex(path, index), aVal, bVal); err != nil {
+					return err
+				}
+			}
+			if aHas {
+				ai++
+			}
+			if bHas {
+				bi++
+			}
+		}
+		return nil
+	}
+
+	aBranch, err := ParseArrayBranchNode(aNode)
+	if err != nil {
+		return err
+	}
+	defer releaseArrayBranchNode(&aBranch)
+	bBranch, err := ParseArrayBranchNode(bNode)
+	if err != nil {
+		return err
+	}
+	defer releaseArrayBranchNode(&bBranch)
+	if aBranch.Shift != bBranch.Shift || aBranch.Shift == 0 {
+		return fmt.Errorf("array branch shifts differ")
+	}
+	ai, bi := 0, 0
+	for slot := uint32(0); slot < 16; slot++ {
+		aHas := (aBranch.Bitmap>>slot)&1 == 1
+		bHas := (bBranch.Bitmap>>slot)&1 == 1
+		childBase := base + (slot << aBranch.Shift)
+		if childBase < limit {
+			switch {
+			case aHas && bHas:
+				err = d.diffArrayNodes(path, aBranch.Children[ai], bBranch.Children[bi], childBase, limit)
+			case aHas:
+				err = d.emitArraySide(path, d.oldDoc, aBranch.Children[ai], childBase, int(aBranch.Shift)-4, limit, true)
+			case bHas:
+				err = d.emitArraySide(path, d.newDoc, bBranch.Children[bi], childBase, int(bBranch.Shift)-4, limit, false)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if aHas {
+			ai++
+		}
+		if bHas {
+			bi++
+		}
+	}
+	return nil
+}
+
+// emitArraySide reports values present on only one side of a common index
+// range as modifications against nil.
+func (d *differ) emitArraySide(path string, doc []byte, off uint32, base uint32, shift int, limit uint32, old bool) error {
+	err := arrEach(doc, off, base, shift, func(index uint32, val Value) error {
+		if index >= limit {
+			return errStopRange
+		}
+		nilVal := Value{Type: TypeNil}
+		if old {
+			return d.diffValue(pointerAppendIndex(path, index), val, nilVal)
+		}
+		return d.diffValue(pointerAppendIndex(path, index), nilVal, val)
+	})
+	if err == errStopRange {
+		return nil
+	}
+	return err
+}
+
+func arrayNodeShift(doc []byte, off uint32) (uint8, error) {
+	h, node, err := NodeSliceAt(doc, off)
+	if err != nil {
+		return 0, err
+	}
+	if h.KeyType != KeyArr {
+		return 0, fmt.Errorf("node is not an array")
+	}
+	p := 1 + h.LenBytes
+	if int(h.NodeLen) < p+3 {
+		return 0, fmt.Errorf("array node too small: %d", h.NodeLen)
+	}
+	return node[p], nil
+}
+
+func pointerAppendKey(path string, key []byte) string {
+	return path + "/" + pointerEscaper.Replace(string(key))
+}
+
+func pointerAppendIndex(path string, index uint32) string {
+	return path + "/" + strconv.FormatUint(uint64(index), 10)
+}
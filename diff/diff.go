@@ -0,0 +1,52 @@
+package diff
+
+import (
+	tron "github.com/starfederation/tron-go"
+)
+
+// Changes compares the current roots of two documents.
+// When newDoc was derived from oldDoc through NewBuilderFromDocument, subtrees
+// in their shared prefix are not walked; see tron.DiffValues.
+func Changes(oldDoc, newDoc []byte) ([]tron.Change, error) {
+	oldRoot, err := rootValue(oldDoc)
+	if err != nil {
+		return nil, err
+	}
+	newRoot, err := rootValue(newDoc)
+	if err != nil {
+		return nil, err
+	}
+	var out []tron.Change
+	err = tron.DiffValues(oldDoc, oldRoot, newDoc, newRoot, func(c tron.Change) error {
+		out = append(out, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func rootValue(doc []byte) (tron.Value, error) {
+	if _, err := tron.DetectDocType(doc); err != nil {
+		return tron.Value{}, err
+	}
+	tr, err := tron.ParseTrailer(doc)
+	if err != nil {
+		return tron.Value{}, err
+	}
+	return tron.DecodeValueAt(doc, tr.RootOffset)
+}
+
+// documentFor returns a document whose root is v, built in builder.
+func documentFor(builder *tron.Builder, v tron.Value) ([]byte, error) {
+	if v.Type == tron.TypeArr || v.Type == tron.TypeMap {
+		return builder.BytesWithTrailer(v.Offset, 0), nil
+	}
+	enc, err := tron.EncodeValue(v)
+	if err != nil {
+		return nil, err
+	}
+	addr := builder.AppendNode(enc)
+	return builder.BytesWithTrailer(addr, 0), nil
+}
@@ -0,0 +1,161 @@
+package diff
+
+import (
+	"strconv"
+	"testing"
+
+	tron "github.com/starfederation/tron-go"
+	"github.com/starfederation/tron-go/merge"
+)
+
+var roundTripCases = []struct {
+	name     string
+	old, new string
+}{
+	{"identical", `{"a":1,"b":[1,2]}`, `{"a":1,"b":[1,2]}`},
+	{"scalar replaced", `{"a":1}`, `{"a":"one"}`},
+	{"member added and removed", `{"a":1,"b":2}`, `{"b":2,"c":{"d":true}}`},
+	{"nested member", `{"a":{"b":{"c":1,"d":2}}}`, `{"a":{"b":{"c":1,"d":3,"e":[]}}}`},
+	{"array grown", `{"a":[1,2]}`, `{"a":[1,2,3,4]}`},
+	{"array tail removed", `{"a":[1,2,3,4,5]}`, `{"a":[1,2]}`},
+	{"array element replaced", `[{"id":1,"v":"x"},{"id":2,"v":"y"}]`, `[{"id":1,"v":"x"},{"id":2,"v":"z"}]`},
+	{"container type changed", `{"a":{"b":1}}`, `{"a":[1]}`},
+	{"root type changed", `{"a":1}`, `[1]`},
+	{"scalar root", `1`, `"one"`},
+	{"escaped keys", `{"a/b":1,"m~n":{"~1":2}}`, `{"a/b":2,"m~n":{"~1":3,"/":4}}`},
+	{"large map", largeMap(100, 0), largeMap(100, 42)},
+}
+
+func TestJSONPatchRoundTrip(t *testing.T) {
+	for _, tt := range roundTripCases {
+		t.Run(tt.name, func(t *testing.T) {
+			oldDoc, newDoc := mustFromJSON(t, tt.old), mustFromJSON(t, tt.new)
+			patch, err := JSONPatch(oldDoc, newDoc)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			got, err := merge.ApplyJSONPatch(oldDoc, patch)
+			if err != nil {
+				t.Fatalf("apply %s: %v", mustToJSON(t, patch), err)
+			}
+			assertEqual(t, got, newDoc)
+		})
+	}
+}
+
+func TestMergePatchRoundTrip(t *testing.T) {
+	for _, tt := range roundTripCases {
+		t.Run(tt.name, func(t *testing.T) {
+			oldDoc, newDoc := mustFromJSON(t, tt.old), mustFromJSON(t, tt.new)
+			patch, err := MergePatch(oldDoc, newDoc)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			got, err := merge.ApplyMergePatch(oldDoc, patch)
+			if err != nil {
+				t.Fatalf("apply %s: %v", mustToJSON(t, patch), err)
+			}
+			assertEqual(t, got, newDoc)
+		})
+	}
+}
+
+func TestMergePatchRejectsNullMember(t *testing.T) {
+	oldDoc, newDoc := mustFromJSON(t, `{"a":1}`), mustFromJSON(t, `{"a":null}`)
+	if _, err := MergePatch(oldDoc, newDoc); err == nil {
+		t.Fatalf("expected error for a member set to null")
+	}
+	// The JSON Patch form can express it.
+	patch, err := JSONPatch(oldDoc, newDoc)
+	if err != nil {
+		t.Fatalf("json patch: %v", err)
+	}
+	got, err := merge.ApplyJSONPatch(oldDoc, patch)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	assertEqual(t, got, newDoc)
+}
+
+func TestPatchRoundTripDerivedDocument(t *testing.T) {
+	oldDoc := mustFromJSON(t, largeMap(200, 0))
+	newDoc, err := tron.SetPointer(oldDoc, "/k7", tron.Value{Type: tron.TypeI64, I64: -1}, tron.PointerCreateNone)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	newDoc, err = tron.SetPointer(newDoc, "/extra", tron.Value{Type: tron.TypeTxt, Bytes: []byte("x")}, tron.PointerCreateNone)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	changes, err := Changes(oldDoc, newDoc)
+	if err != nil {
+		t.Fatalf("changes: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %v", len(changes), changes)
+	}
+	patch, err := JSONPatch(oldDoc, newDoc)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	got, err := merge.ApplyJSONPatch(oldDoc, patch)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	assertEqual(t, got, newDoc)
+}
+
+func largeMap(n, changed int) string {
+	b := []byte{'{'}
+	for i := range n {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		v := i
+		if i == changed && changed != 0 {
+			v = -i
+		}
+		b = append(b, `"k`...)
+		b = strconv.AppendInt(b, int64(i), 10)
+		b = append(b, `":`...)
+		b = strconv.AppendInt(b, int64(v), 10)
+	}
+	return string(append(b, '}'))
+}
+
+func mustFromJSON(t *testing.T, s string) []byte {
+	t.Helper()
+	doc, err := tron.FromJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("from json %s: %v", s, err)
+	}
+	return doc
+}
+
+func mustToJSON(t *testing.T, doc []byte) string {
+	t.Helper()
+	s, err := tron.ToJSON(doc)
+	if err != nil {
+		t.Fatalf("to json: %v", err)
+	}
+	return s
+}
+
+func assertEqual(t *testing.T, got, want []byte) {
+	t.Helper()
+	gotRoot, err := rootValue(got)
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	wantRoot, err := rootValue(want)
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	ok, err := tron.Equal(got, gotRoot, want, wantRoot)
+	if err != nil {
+		t.Fatalf("equal: %v", err)
+	}
+	if !ok {
+		t.Fatalf("got %s, want %s", mustToJSON(t, got), mustToJSON(t, want))
+	}
+}
@@ -0,0 +1,50 @@
+package diff
+
+import (
+	tron "github.com/starfederation/tron-go"
+)
+
+// JSONPatch returns a JSON Patch (RFC 6902) document that turns oldDoc into
+// newDoc when applied with merge.ApplyJSONPatch. The patch root is an array
+// of add, remove, and replace operations; arrays are compared by index.
+func JSONPatch(oldDoc, newDoc []byte) ([]byte, error) {
+	changes, err := Changes(oldDoc, newDoc)
+	if err != nil {
+		return nil, err
+	}
+	builder := tron.NewBuilder()
+	ops := tron.NewArrayBuilder()
+	for _, c := range changes {
+		op := tron.NewMapBuilder()
+		switch c.Kind {
+		case tron.ChangeAdded:
+			op.SetString("op", txtValue("add"))
+		case tron.ChangeRemoved:
+			op.SetString("op", txtValue("remove"))
+		default:
+			op.SetString("op", txtValue("replace"))
+		}
+		op.SetString("path", txtValue(c.Path))
+		if c.Kind != tron.ChangeRemoved {
+			val, err := tron.CloneValueFromDoc(newDoc, c.New, builder)
+			if err != nil {
+				return nil, err
+			}
+			op.SetString("value", val)
+		}
+		off, err := op.Build(builder)
+		if err != nil {
+			return nil, err
+		}
+		ops.Append(tron.Value{Type: tron.TypeMap, Offset: off})
+	}
+	off, err := ops.Build(builder)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BytesWithTrailer(off, 0), nil
+}
+
+func txtValue(s string) tron.Value {
+	return tron.Value{Type: tron.TypeTxt, Bytes: []byte(s)}
+}
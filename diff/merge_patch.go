@@ -0,0 +1,175 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+// MergePatch returns a JSON Merge Patch (RFC 7386) document that turns oldDoc
+// into newDoc when applied with merge.ApplyMergePatch.
+// Merge patches cannot address array elements, so any change inside an array
+// replaces the whole array. Setting a map member to null cannot be expressed
+// and returns an error.
+func MergePatch(oldDoc, newDoc []byte) ([]byte, error) {
+	changes, err := Changes(oldDoc, newDoc)
+	if err != nil {
+		return nil, err
+	}
+	oldRoot, err := rootValue(oldDoc)
+	if err != nil {
+		return nil, err
+	}
+	newRoot, err := rootValue(newDoc)
+	if err != nil {
+		return nil, err
+	}
+	builder := tron.NewBuilder()
+	if newRoot.Type != tron.TypeMap || oldRoot.Type != tron.TypeMap {
+		if newRoot.Type == tron.TypeMap {
+			if err := checkMergeValue(newDoc, newRoot, ""); err != nil {
+				return nil, err
+			}
+		}
+		val, err := tron.CloneValueFromDoc(newDoc, newRoot, builder)
+		if err != nil {
+			return nil, err
+		}
+		return documentFor(builder, val)
+	}
+
+	root := &mergeNode{}
+	for _, c := range changes {
+		if err := root.add(newDoc, newRoot, c); err != nil {
+			return nil, err
+		}
+	}
+	off, err := root.build(newDoc, builder)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BytesWithTrailer(off, 0), nil
+}
+
+// mergeNode is a member of the merge patch being assembled.
+type mergeNode struct {
+	keys     []string
+	children map[string]*mergeNode
+	// set holds a replacement value from the new document.
+	set    *tron.Value
+	remove bool
+}
+
+func (n *mergeNode) child(key string) *mergeNode {
+	if n.children == nil {
+		n.children = make(map[string]*mergeNode)
+	}
+	if c, ok := n.children[key]; ok {
+		return c
+	}
+	c := &mergeNode{}
+	n.children[key] = c
+	n.keys = append(n.keys, key)
+	return c
+}
+
+func (n *mergeNode) add(newDoc []byte, newRoot tron.Value, c tron.Change) error {
+	tokens, err := tron.ParsePointer(c.Path)
+	if err != nil {
+		return err
+	}
+	cur := newRoot
+	node := n
+	for i, tok := range tokens {
+		if node.set != nil {
+			return nil
+		}
+		if cur.Type == tron.TypeArr {
+			arr := cur
+			node.set = &arr
+			node.children = nil
+			node.keys = nil
+			return nil
+		}
+		if cur.Type != tron.TypeMap {
+			return fmt.Errorf("merge patch: %s is not a container", c.Path)
+		}
+		node = node.child(tok)
+		if i < len(tokens)-1 {
+			next, ok, err := tron.MapGet(newDoc, cur.Offset, []byte(tok))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("merge patch: %s not found in new document", c.Path)
+			}
+			cur = next
+			continue
+		}
+		if c.Kind == tron.ChangeRemoved {
+			node.remove = true
+			return nil
+		}
+		if c.New.Type == tron.TypeNil {
+			return fmt.Errorf("merge patch cannot set %s to null", c.Path)
+		}
+		if err := checkMergeValue(newDoc, c.New, c.Path); err != nil {
+			return err
+		}
+		val := c.New
+		node.set = &val
+	}
+	return nil
+}
+
+func (n *mergeNode) build(newDoc []byte, builder *tron.Builder) (uint32, error) {
+	mb := tron.NewMapBuilder()
+	for _, key := range n.keys {
+		c := n.children[key]
+		switch {
+		case c.remove:
+			mb.SetString(key, tron.Value{Type: tron.TypeNil})
+		case c.set != nil:
+			val, err := tron.CloneValueFromDoc(newDoc, *c.set, builder)
+			if err != nil {
+				return 0, err
+			}
+			mb.SetString(key, val)
+		default:
+			off, err := c.build(newDoc, builder)
+			if err != nil {
+				return 0, err
+			}
+			mb.SetString(key, tron.Value{Type: tron.TypeMap, Offset: off})
+		}
+	}
+	return mb.Build(builder)
+}
+
+var errNullMember = errors.New("null member")
+
+// checkMergeValue rejects maps with null members, which a merge patch would
+// read as deletions.
+func checkMergeValue(doc []byte, v tron.Value, path string) error {
+	if v.Type != tron.TypeMap {
+		return nil
+	}
+	err := tron.MapEach(doc, v.Offset, func(key []byte, val tron.Value) error {
+		if val.Type == tron.TypeNil {
+			return errNullMember
+		}
+		return checkMergeValue(doc, val, path)
+	})
+	if errors.Is(err, errNullMember) {
+		return fmt.Errorf("merge patch cannot express null members in %s", displayPath(path))
+	}
+	return err
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "the document root"
+	}
+	return path
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/maphash"
 )
 
 // DocType indicates the top-level document kind.
@@ -89,6 +90,10 @@ func NodeSliceAt(b []byte, off uint32) (NodeHeader, []byte, error) {
 // Builder helps assemble a tree document by appending nodes.
 type Builder struct {
 	buf []byte
+	// dedup maps the hash of each appended node to its offset while
+	// deduplication is enabled.
+	dedup map[uint64]uint32
+	seed  maphash.Seed
 }
 
 // NewBuilder creates an empty builder.
@@ -121,13 +126,62 @@ func NewBuilderFromDocument(doc []byte) (*Builder, Trailer, error) {
 	return &Builder{buf: buf}, tr, nil
 }
 
+// SetDedup turns hash-consing of appended nodes on or off. While it is on,
+// AppendNode returns the offset of an identical node appended earlier instead
+// of writing a copy, so repeated strings and identical subtrees are stored
+// once. Nodes written by MapBuilder, ArrayBuilder and the copy-on-write
+// helpers all go through AppendNode and are deduplicated too. Only nodes
+// appended while deduplication is on are candidates.
+//
+// A deduplicated root may resolve to an earlier offset that is not followed
+// by its trailer. Doc transactions and Compact copy such a root to the end
+// before writing the trailer, so History can still walk their output.
+func (b *Builder) SetDedup(enabled bool) {
+	if !enabled {
+		b.dedup = nil
+		return
+	}
+	if b.dedup == nil {
+		b.dedup = make(map[uint64]uint32)
+		b.seed = maphash.MakeSeed()
+	}
+}
+
 // AppendNode appends an encoded node and returns its offset.
 func (b *Builder) AppendNode(node []byte) uint32 {
+	if b.dedup == nil {
+		return b.appendNode(node)
+	}
+	sum := maphash.Bytes(b.seed, node)
+	if off, ok := b.dedup[sum]; ok {
+		end := int(off) + len(node)
+		if end <= len(b.buf) && bytes.Equal(b.buf[off:end], node) {
+			return off
+		}
+	}
+	off := b.appendNode(node)
+	b.dedup[sum] = off
+	return off
+}
+
+// appendNode appends node without consulting the dedup table.
+func (b *Builder) appendNode(node []byte) uint32 {
 	off := uint32(len(b.buf))
 	b.buf = append(b.buf, node...)
 	return off
 }
 
+// truncate discards everything from n onward, along with dedup entries that
+// pointed there.
+func (b *Builder) truncate(n int) {
+	b.buf = b.buf[:n]
+	for sum, off := range b.dedup {
+		if int(off) >= n {
+			delete(b.dedup, sum)
+		}
+	}
+}
+
 // Buffer returns the current builder buffer (without trailer).
 func (b *Builder) Buffer() []byte {
 	return b.buf
@@ -136,6 +190,7 @@ func (b *Builder) Buffer() []byte {
 // Reset clears the builder buffer while retaining its capacity.
 func (b *Builder) Reset() {
 	b.buf = b.buf[:0]
+	clear(b.dedup)
 	b.buf = append(b.buf, HeaderMagic[:]...)
 }
 
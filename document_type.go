@@ -0,0 +1,170 @@
+package tron
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Document is an encoded TRON document that plugs into standard library
+// interfaces: JSON encoding, binary encoding, database/sql columns, slog and
+// fmt. A nil Document stands for a JSON null and a SQL NULL.
+type Document []byte
+
+// MarshalJSON implements json.Marshaler using WriteJSON.
+func (d Document) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("null"), nil
+	}
+	var sb strings.Builder
+	if err := WriteJSON(&sb, d); err != nil {
+		return nil, err
+	}
+	return []byte(sb.String()), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler using FromJSON. A JSON null
+// sets d to nil.
+func (d *Document) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = nil
+		return nil
+	}
+	doc, err := FromJSON(data)
+	if err != nil {
+		return err
+	}
+	*d = doc
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The result is the
+// document itself, not a copy.
+func (d Document) MarshalBinary() ([]byte, error) {
+	return d, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler by copying data.
+func (d *Document) UnmarshalBinary(data []byte) error {
+	if _, err := DetectDocType(data); err != nil {
+		return err
+	}
+	*d = append(Document(nil), data...)
+	return nil
+}
+
+// Scan implements sql.Scanner for BLOB and BYTEA columns holding TRON bytes.
+// The bytes are copied, since drivers may reuse their buffers. NULL sets d
+// to nil.
+func (d *Document) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into tron.Document", src)
+	}
+	return d.UnmarshalBinary(data)
+}
+
+// Value implements driver.Valuer, storing the document bytes.
+func (d Document) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return []byte(d), nil
+}
+
+// LogValue implements slog.LogValuer. A map document becomes a group with an
+// attribute per entry, nested maps become nested groups, and arrays become
+// slices. Txt values are logged as strings and bin values as b64: strings.
+func (d Document) LogValue() slog.Value {
+	root, err := documentRoot(d)
+	if err != nil {
+		return slog.AnyValue(err)
+	}
+	val, err := logValue(d, root)
+	if err != nil {
+		return slog.AnyValue(err)
+	}
+	return val
+}
+
+func logValue(doc []byte, v Value) (slog.Value, error) {
+	switch v.Type {
+	case TypeNil:
+		return slog.AnyValue(nil), nil
+	case TypeBit:
+		return slog.BoolValue(v.Bool), nil
+	case TypeI64:
+		return slog.Int64Value(v.I64), nil
+	case TypeF64:
+		return slog.Float64Value(v.F64), nil
+	case TypeTxt:
+		return slog.StringValue(string(v.Bytes)), nil
+	case TypeBin:
+		return slog.StringValue("b64:" + base64.StdEncoding.EncodeToString(v.Bytes)), nil
+	case TypeArr:
+		items, err := valueArrayToAny(doc, v.Offset)
+		if err != nil {
+			return slog.Value{}, err
+		}
+		return slog.AnyValue(items), nil
+	case TypeMap:
+		var attrs []slog.Attr
+		err := MapEach(doc, v.Offset, func(key []byte, val Value) error {
+			lv, err := logValue(doc, val)
+			if err != nil {
+				return err
+			}
+			attrs = append(attrs, slog.Attr{Key: string(key), Value: lv})
+			return nil
+		})
+		if err != nil {
+			return slog.Value{}, err
+		}
+		return slog.GroupValue(attrs...), nil
+	default:
+		return slog.Value{}, fmt.Errorf("unknown value type %d", v.Type)
+	}
+}
+
+// Format implements fmt.Formatter. %v and %s print compact JSON, %+v prints
+// the node tree as DumpNodes does, %q prints the JSON quoted, and %x and %X
+// print the raw bytes in hex.
+func (d Document) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's', 'q':
+		if verb == 'v' && f.Flag('+') {
+			if err := DumpNodes(f, d, false); err != nil {
+				fmt.Fprintf(f, "%%!v(ERROR=%v)", err)
+			}
+			return
+		}
+		var sb strings.Builder
+		if err := WriteJSON(&sb, d); err != nil {
+			fmt.Fprintf(f, "%%!%c(ERROR=%v)", verb, err)
+			return
+		}
+		if verb == 'q' {
+			f.Write([]byte(strconv.Quote(sb.String())))
+			return
+		}
+		f.Write([]byte(sb.String()))
+	case 'x':
+		f.Write([]byte(hex.EncodeToString(d)))
+	case 'X':
+		f.Write([]byte(strings.ToUpper(hex.EncodeToString(d))))
+	default:
+		fmt.Fprintf(f, "%%!%c(tron.Document=%d bytes)", verb, len(d))
+	}
+}
@@ -0,0 +1,109 @@
+package tron
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var (
+	_ json.Marshaler   = Document(nil)
+	_ json.Unmarshaler = (*Document)(nil)
+	_ sql.Scanner      = (*Document)(nil)
+	_ driver.Valuer    = Document(nil)
+	_ fmt.Formatter    = Document(nil)
+)
+
+func TestDocumentJSON(t *testing.T) {
+	type row struct {
+		ID   int      `json:"id"`
+		Body Document `json:"body"`
+		Opt  Document `json:"opt"`
+	}
+	in := []byte(`{"id":7,"body":{"a":[1,"x",null]},"opt":null}`)
+	var r row
+	if err := json.Unmarshal(in, &r); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if r.Opt != nil {
+		t.Fatalf("null decoded to %d bytes", len(r.Opt))
+	}
+	assertDocEqual(t, r.Body, `{"a":[1,"x",null]}`)
+	out, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("got %s, want %s", out, in)
+	}
+	var bad Document
+	if err := json.Unmarshal([]byte(`{"a":}`), &bad); err == nil {
+		t.Fatalf("accepted invalid JSON")
+	}
+}
+
+func TestDocumentSQL(t *testing.T) {
+	doc := Document(mustJSON(t, `{"a":1}`))
+	v, err := doc.Value()
+	if err != nil {
+		t.Fatalf("value: %v", err)
+	}
+	raw, ok := v.([]byte)
+	if !ok || string(raw) != string(doc) {
+		t.Fatalf("value = %T %v", v, v)
+	}
+	if v, err := Document(nil).Value(); v != nil || err != nil {
+		t.Fatalf("nil value = %v, %v", v, err)
+	}
+
+	var got Document
+	buf := append([]byte{}, raw...)
+	if err := got.Scan(buf); err != nil {
+		t.Fatalf("scan bytes: %v", err)
+	}
+	// The scanned document must not alias the driver's buffer.
+	clear(buf)
+	assertDocEqual(t, got, `{"a":1}`)
+	if err := got.Scan(string(doc)); err != nil {
+		t.Fatalf("scan string: %v", err)
+	}
+	assertDocEqual(t, got, `{"a":1}`)
+	if err := got.Scan(nil); err != nil || got != nil {
+		t.Fatalf("scan nil: %v, %d bytes", err, len(got))
+	}
+	if err := got.Scan(42); err == nil {
+		t.Fatalf("scanned an int")
+	}
+	if err := got.Scan([]byte("not tron")); err == nil {
+		t.Fatalf("scanned bytes that are not TRON")
+	}
+}
+
+func TestDocumentFormat(t *testing.T) {
+	doc := Document(mustJSON(t, `["a\"b"]`))
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%v", `["a\"b"]`},
+		{"%s", `["a\"b"]`},
+		{"%q", `"[\"a\\\"b\"]"`},
+		{"%x", fmt.Sprintf("%x", []byte(doc))},
+		{"%X", fmt.Sprintf("%X", []byte(doc))},
+		{"%d", fmt.Sprintf("%%!d(tron.Document=%d bytes)", len(doc))},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprintf(tt.format, doc); got != tt.want {
+			t.Fatalf("%s: got %s, want %s", tt.format, got, tt.want)
+		}
+	}
+	if got := fmt.Sprintf("%+v", doc); !strings.Contains(got, "arr root leaf") {
+		t.Fatalf("%%+v: got %s", got)
+	}
+	if got := fmt.Sprintf("%v", Document("TRON")); !strings.HasPrefix(got, "%!v(ERROR=") {
+		t.Fatalf("corrupt %%v: got %s", got)
+	}
+}
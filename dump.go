@@ -0,0 +1,203 @@
+package tron
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DumpNodes writes the node tree of doc to w, one line per node with its
+// offset, kind and length, indented by depth. With hexBytes set, the raw bytes
+// of every node follow its line.
+func DumpNodes(w io.Writer, doc []byte, hexBytes bool) error {
+	bw := bufio.NewWriter(w)
+	d := dumper{w: bw, doc: doc, hex: hexBytes}
+	if err := d.document(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+type dumper struct {
+	w   *bufio.Writer
+	doc []byte
+	hex bool
+}
+
+func (d *dumper) document() error {
+	tr, err := ParseTrailer(d.doc)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.w, "document %d bytes, root @%d, prev root @%d\n", len(d.doc), tr.RootOffset, tr.PrevRootOffset)
+	return d.value(tr.RootOffset, 0, "")
+}
+
+// node prints a header line for the node at off.
+func (d *dumper) node(off uint32, depth int, label string, detail string) error {
+	h, node, err := NodeSliceAt(d.doc, off)
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(d.w, "%s%s@%d %s len=%d%s\n", indent, label, off, nodeKindName(h), h.NodeLen, detail)
+	if d.hex {
+		for line := range slices.Chunk(node, 16) {
+			fmt.Fprintf(d.w, "%s  | % x\n", indent, line)
+		}
+	}
+	return nil
+}
+
+func (d *dumper) value(off uint32, depth int, label string) error {
+	h, err := ParseNodeHeader(d.doc[min(int(off), len(d.doc)):])
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	switch h.Type {
+	case TypeMap:
+		return d.mapNode(off, depth, label)
+	case TypeArr:
+		return d.arrayNode(off, depth, label)
+	}
+	val, err := DecodeValueAt(d.doc, off)
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	return d.node(off, depth, label, " = "+scalarString(val))
+}
+
+func (d *dumper) mapNode(off uint32, depth int, label string) error {
+	h, node, err := NodeSliceAt(d.doc, off)
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	if h.Kind == NodeLeaf {
+		leaf, err := ParseMapLeafNode(d.doc, node)
+		if err != nil {
+			return fmt.Errorf("node @%d: %w", off, err)
+		}
+		defer ReleaseMapLeafNode(&leaf)
+		if err := d.node(off, depth, label, fmt.Sprintf(" entries=%d", len(leaf.Entries))); err != nil {
+			return err
+		}
+		for _, entry := range leaf.Entries {
+			entryLabel := fmt.Sprintf("%s@%d: ", strconv.Quote(string(entry.Key)), entry.KeyAddr)
+			if err := d.value(entry.ValueAddr, depth+1, entryLabel); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	branch, err := ParseMapBranchNode(node)
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	defer ReleaseMapBranchNode(&branch)
+	if err := d.node(off, depth, label, fmt.Sprintf(" bitmap=%016b", branch.Bitmap)); err != nil {
+		return err
+	}
+	i := 0
+	for slot := 0; slot < 16; slot++ {
+		if (branch.Bitmap>>uint(slot))&1 == 0 {
+			continue
+		}
+		if err := d.mapNode(branch.Children[i], depth+1, fmt.Sprintf("[%x] ", slot)); err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+func (d *dumper) arrayNode(off uint32, depth int, label string) error {
+	h, node, err := NodeSliceAt(d.doc, off)
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	if h.Kind == NodeLeaf {
+		leaf, err := ParseArrayLeafNode(node)
+		if err != nil {
+			return fmt.Errorf("node @%d: %w", off, err)
+		}
+		defer ReleaseArrayLeafNode(&leaf)
+		if err := d.node(off, depth, label, arrayDetail(h, leaf.Shift, leaf.Bitmap, leaf.Length)); err != nil {
+			return err
+		}
+		i := 0
+		for slot := 0; slot < 16; slot++ {
+			if (leaf.Bitmap>>uint(slot))&1 == 0 {
+				continue
+			}
+			if err := d.value(leaf.ValueAddrs[i], depth+1, fmt.Sprintf("[%x] ", slot)); err != nil {
+				return err
+			}
+			i++
+		}
+		return nil
+	}
+	branch, err := ParseArrayBranchNode(node)
+	if err != nil {
+		return fmt.Errorf("node @%d: %w", off, err)
+	}
+	defer ReleaseArrayBranchNode(&branch)
+	if err := d.node(off, depth, label, arrayDetail(h, branch.Shift, branch.Bitmap, branch.Length)); err != nil {
+		return err
+	}
+	i := 0
+	for slot := 0; slot < 16; slot++ {
+		if (branch.Bitmap>>uint(slot))&1 == 0 {
+			continue
+		}
+		if err := d.arrayNode(branch.Children[i], depth+1, fmt.Sprintf("[%x] ", slot)); err != nil {
+			return err
+		}
+		i++
+	}
+	return nil
+}
+
+func arrayDetail(h NodeHeader, shift uint8, bitmap uint16, length uint32) string {
+	detail := fmt.Sprintf(" shift=%d bitmap=%016b", shift, bitmap)
+	if h.IsRoot {
+		detail += fmt.Sprintf(" length=%d", length)
+	}
+	return detail
+}
+
+func nodeKindName(h NodeHeader) string {
+	if h.Type != TypeArr && h.Type != TypeMap {
+		return h.Type.String()
+	}
+	kind := "branch"
+	if h.Kind == NodeLeaf {
+		kind = "leaf"
+	}
+	if h.Type == TypeArr && h.IsRoot {
+		kind = "root " + kind
+	}
+	return h.Type.String() + " " + kind
+}
+
+func scalarString(v Value) string {
+	switch v.Type {
+	case TypeNil:
+		return "null"
+	case TypeBit:
+		return strconv.FormatBool(v.Bool)
+	case TypeI64:
+		return strconv.FormatInt(v.I64, 10)
+	case TypeF64:
+		return strconv.FormatFloat(v.F64, 'g', -1, 64)
+	case TypeTxt:
+		return strconv.Quote(string(v.Bytes))
+	case TypeBin:
+		return "0x" + hex.EncodeToString(v.Bytes)
+	default:
+		return "?"
+	}
+}
@@ -9,12 +9,23 @@ type encodeWorkspace struct {
 	arrayNodes      []*arrayNode
 	mapNodeSlices   [][]*mapNode
 	arrayNodeSlices [][]*arrayNode
+	// dedup makes MapBuilder and ArrayBuilder turn on deduplication in the
+	// builders they write to.
+	dedup bool
 }
 
 func newEncodeWorkspace() *encodeWorkspace {
 	return &encodeWorkspace{}
 }
 
+// dedupWithWorkspace enables deduplication on builder when workspace asks
+// for it.
+func dedupWithWorkspace(builder *Builder, workspace *encodeWorkspace) {
+	if workspace != nil && workspace.dedup && builder.dedup == nil {
+		builder.SetDedup(true)
+	}
+}
+
 func getMapEntrySliceWithWorkspace(n int, workspace *encodeWorkspace) []mapEntry {
 	if workspace == nil {
 		return getMapEntrySlice(n)
@@ -0,0 +1,196 @@
+package tron
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+)
+
+var errNotEqual = errors.New("values differ")
+
+// Equal reports whether valA in docA and valB in docB hold the same content.
+// Maps are compared by key and arrays by index, with holes equal to nil.
+// Scalars must match in type, so i64 1 and f64 1.0 differ, and f64 values
+// are compared bit for bit. Subtrees at the same offset inside a byte prefix
+// shared by both documents, such as two versions of one buffer, are equal
+// without being read.
+func Equal(docA []byte, valA Value, docB []byte, valB Value) (bool, error) {
+	err := DiffValues(docA, valA, docB, valB, func(Change) error {
+		return errNotEqual
+	})
+	if err == errNotEqual {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Digest is a SHA-256 content hash produced by ContentHash.
+type Digest [sha256.Size]byte
+
+// String returns the digest in lowercase hex.
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// Digest domain tags. Each value is hashed with its tag so values of
+// different types never collide.
+const (
+	digestNil byte = iota
+	digestBit
+	digestI64
+	digestF64
+	digestTxt
+	digestBin
+	digestArr
+	digestMap
+)
+
+// ContentHash returns a Merkle hash of val in doc. The hash covers content
+// only: values that are Equal hash the same regardless of node layout, buffer
+// offsets or history. A map hashes its entries in key order, each as the key
+// followed by the value's digest, and an array hashes its length followed by
+// the digest of every element, with holes hashed as nil.
+func ContentHash(doc []byte, val Value) (Digest, error) {
+	h := contentHasher{doc: doc, memo: make(map[uint32]Digest)}
+	return h.value(val)
+}
+
+type contentHasher struct {
+	doc  []byte
+	memo map[uint32]Digest
+}
+
+func (h *contentHasher) value(v Value) (Digest, error) {
+	if v.Type == TypeArr || v.Type == TypeMap {
+		if d, ok := h.memo[v.Offset]; ok {
+			return d, nil
+		}
+	}
+	var num [9]byte
+	switch v.Type {
+	case TypeNil:
+		return sha256.Sum256([]byte{digestNil}), nil
+	case TypeBit:
+		num[0] = digestBit
+		if v.Bool {
+			num[1] = 1
+		}
+		return sha256.Sum256(num[:2]), nil
+	case TypeI64:
+		num[0] = digestI64
+		binary.LittleEndian.PutUint64(num[1:], uint64(v.I64))
+		return sha256.Sum256(num[:]), nil
+	case TypeF64:
+		num[0] = digestF64
+		binary.LittleEndian.PutUint64(num[1:], math.Float64bits(v.F64))
+		return sha256.Sum256(num[:]), nil
+	case TypeTxt, TypeBin:
+		tag := digestTxt
+		if v.Type == TypeBin {
+			tag = digestBin
+		}
+		sum := sha256.New()
+		writeDigestBytes(sum, tag, v.Bytes)
+		return digestOf(sum), nil
+	case TypeArr:
+		d, err := h.array(v.Offset)
+		if err != nil {
+			return Digest{}, err
+		}
+		h.memo[v.Offset] = d
+		return d, nil
+	case TypeMap:
+		d, err := h.object(v.Offset)
+		if err != nil {
+			return Digest{}, err
+		}
+		h.memo[v.Offset] = d
+		return d, nil
+	default:
+		return Digest{}, fmt.Errorf("unknown value type %d", v.Type)
+	}
+}
+
+func (h *contentHasher) array(off uint32) (Digest, error) {
+	length, err := arrayRootLength(h.doc, off)
+	if err != nil {
+		return Digest{}, err
+	}
+	nilDigest := sha256.Sum256([]byte{digestNil})
+	sum := sha256.New()
+	var head [9]byte
+	head[0] = digestArr
+	binary.LittleEndian.PutUint64(head[1:], uint64(length))
+	sum.Write(head[:])
+	next := uint32(0)
+	err = ArrEach(h.doc, off, func(index uint32, val Value) error {
+		if index >= length {
+			return fmt.Errorf("array index out of range: %d", index)
+		}
+		for ; next < index; next++ {
+			sum.Write(nilDigest[:])
+		}
+		d, err := h.value(val)
+		if err != nil {
+			return err
+		}
+		sum.Write(d[:])
+		next = index + 1
+		return nil
+	})
+	if err != nil {
+		return Digest{}, err
+	}
+	for ; next < length; next++ {
+		sum.Write(nilDigest[:])
+	}
+	return digestOf(sum), nil
+}
+
+func (h *contentHasher) object(off uint32) (Digest, error) {
+	var entries []MapLeafEntry
+	err := MapEach(h.doc, off, func(key []byte, val Value) error {
+		entries = append(entries, MapLeafEntry{Key: key, Value: val})
+		return nil
+	})
+	if err != nil {
+		return Digest{}, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	sum := sha256.New()
+	var head [9]byte
+	head[0] = digestMap
+	binary.LittleEndian.PutUint64(head[1:], uint64(len(entries)))
+	sum.Write(head[:])
+	for _, e := range entries {
+		d, err := h.value(e.Value)
+		if err != nil {
+			return Digest{}, err
+		}
+		writeDigestBytes(sum, digestTxt, e.Key)
+		sum.Write(d[:])
+	}
+	return digestOf(sum), nil
+}
+
+func writeDigestBytes(w hash.Hash, tag byte, b []byte) {
+	var head [9]byte
+	head[0] = tag
+	binary.LittleEndian.PutUint64(head[1:], uint64(len(b)))
+	w.Write(head[:])
+	w.Write(b)
+}
+
+func digestOf(sum hash.Hash) Digest {
+	var d Digest
+	sum.Sum(d[:0])
+	return d
+}
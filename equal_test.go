@@ -0,0 +1,143 @@
+package tron
+
+import (
+	"math"
+	"testing"
+)
+
+func mustHash(t *testing.T, doc []byte, v Value) Digest {
+	t.Helper()
+	d, err := ContentHash(doc, v)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	return d
+}
+
+func mustEqual(t *testing.T, docA []byte, a Value, docB []byte, b Value) bool {
+	t.Helper()
+	eq, err := Equal(docA, a, docB, b)
+	if err != nil {
+		t.Fatalf("equal: %v", err)
+	}
+	return eq
+}
+
+func TestEqualAcrossLayouts(t *testing.T) {
+	const final = `{"a":1,"b":[1,2,{"c":"x"}],"d":{"e":null,"f":[true,false]}}`
+	fresh := mustJSON(t, final)
+
+	// Reach the same content through copy-on-write edits, which leave the
+	// old nodes in the buffer and place the new ones elsewhere.
+	edited := mustJSON(t, `{"a":0,"b":[1,2,{"c":"y"}],"d":{"f":[true]}}`)
+	for _, step := range []struct {
+		ptr string
+		val Value
+	}{
+		{"/a", Value{Type: TypeI64, I64: 1}},
+		{"/b/2/c", Value{Type: TypeTxt, Bytes: []byte("x")}},
+		{"/d/e", Value{Type: TypeNil}},
+		{"/d/f/-", Value{Type: TypeBit, Bool: false}},
+	} {
+		var err error
+		edited, err = SetPointer(edited, step.ptr, step.val, PointerCreateNone)
+		if err != nil {
+			t.Fatalf("set %s: %v", step.ptr, err)
+		}
+	}
+	if len(edited) == len(fresh) {
+		t.Fatalf("edited document has the fresh layout")
+	}
+	// Keys inserted in another order build the same content.
+	reordered := mustJSON(t, `{"d":{"f":[true,false],"e":null},"b":[1,2,{"c":"x"}],"a":1}`)
+
+	want := mustHash(t, fresh, mustRoot(t, fresh))
+	for name, doc := range map[string][]byte{"edited": edited, "reordered": reordered} {
+		if !mustEqual(t, fresh, mustRoot(t, fresh), doc, mustRoot(t, doc)) {
+			t.Fatalf("%s: not equal to the fresh encoding", name)
+		}
+		if got := mustHash(t, doc, mustRoot(t, doc)); got != want {
+			t.Fatalf("%s: hash %s, want %s", name, got, want)
+		}
+	}
+	if got := mustHash(t, fresh, mustRoot(t, fresh)); got != want {
+		t.Fatalf("hash changed between calls: %s, %s", got, want)
+	}
+}
+
+func TestContentHashChangesWithAnyValue(t *testing.T) {
+	doc := mustJSON(t, `{"a":1,"b":[1,2,{"c":"x"}],"d":{"e":null,"f":[true,false]},"g":1.5}`)
+	base := mustHash(t, doc, mustRoot(t, doc))
+	for _, ptr := range []string{"/a", "/b/0", "/b/1", "/b/2/c", "/d/e", "/d/f/0", "/d/f/1", "/g"} {
+		changed, err := SetPointer(doc, ptr, Value{Type: TypeTxt, Bytes: []byte("changed")}, PointerCreateNone)
+		if err != nil {
+			t.Fatalf("set %s: %v", ptr, err)
+		}
+		if mustEqual(t, doc, mustRoot(t, doc), changed, mustRoot(t, changed)) {
+			t.Fatalf("%s: equal after a change", ptr)
+		}
+		if mustHash(t, changed, mustRoot(t, changed)) == base {
+			t.Fatalf("%s: hash unchanged", ptr)
+		}
+	}
+	// Renaming a key with the same value changes the hash too.
+	renamed := mustJSON(t, `{"z":1,"b":[1,2,{"c":"x"}],"d":{"e":null,"f":[true,false]},"g":1.5}`)
+	if mustHash(t, renamed, mustRoot(t, renamed)) == base {
+		t.Fatalf("renamed key: hash unchanged")
+	}
+}
+
+func TestEqualScalars(t *testing.T) {
+	nan := math.NaN()
+	otherNaN := math.Float64frombits(math.Float64bits(nan) ^ 1)
+	cases := []struct {
+		name  string
+		a, b  Value
+		equal bool
+	}{
+		{"nan", Value{Type: TypeF64, F64: nan}, Value{Type: TypeF64, F64: nan}, true},
+		{"nan payloads", Value{Type: TypeF64, F64: nan}, Value{Type: TypeF64, F64: otherNaN}, false},
+		{"zero signs", Value{Type: TypeF64, F64: 0}, Value{Type: TypeF64, F64: math.Copysign(0, -1)}, false},
+		{"i64 and f64", Value{Type: TypeI64, I64: 1}, Value{Type: TypeF64, F64: 1}, false},
+		{"txt and bin", Value{Type: TypeTxt, Bytes: []byte("a")}, Value{Type: TypeBin, Bytes: []byte("a")}, false},
+		{"nil", Value{Type: TypeNil}, Value{Type: TypeNil}, true},
+		{"false and nil", Value{Type: TypeBit}, Value{Type: TypeNil}, false},
+	}
+	for _, c := range cases {
+		if got := mustEqual(t, nil, c.a, nil, c.b); got != c.equal {
+			t.Fatalf("%s: equal = %v, want %v", c.name, got, c.equal)
+		}
+		if same := mustHash(t, nil, c.a) == mustHash(t, nil, c.b); same != c.equal {
+			t.Fatalf("%s: same hash = %v, want %v", c.name, same, c.equal)
+		}
+	}
+	// The nil digest is SHA-256 of its domain tag alone.
+	if got := mustHash(t, nil, Value{Type: TypeNil}).String(); got != "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d" {
+		t.Fatalf("nil digest %s", got)
+	}
+}
+
+func TestEqualArrayHolesAreNil(t *testing.T) {
+	b := NewBuilder()
+	root, err := NewArrayBuilder().Build(b)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	root, err = ArraySetNode(b, root, 2, Value{Type: TypeI64, I64: 7}, 4)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	sparse := b.BytesWithTrailer(root, 0)
+	dense := mustJSON(t, `[null,null,7,null]`)
+	sv, dv := mustRoot(t, sparse), mustRoot(t, dense)
+	if !mustEqual(t, sparse, sv, dense, dv) {
+		t.Fatalf("sparse array not equal to explicit nils")
+	}
+	if mustHash(t, sparse, sv) != mustHash(t, dense, dv) {
+		t.Fatalf("sparse array hashes differently from explicit nils")
+	}
+	shorter := mustJSON(t, `[null,null,7]`)
+	if mustEqual(t, sparse, sv, shorter, mustRoot(t, shorter)) {
+		t.Fatalf("arrays of different length are equal")
+	}
+}
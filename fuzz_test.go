@@ -1,9 +1,11 @@
 package tron
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -95,6 +97,116 @@ func FuzzJSONRoundTrip(f *testing.F) {
 	})
 }
 
+func FuzzTextRoundTrip(f *testing.F) {
+	seeds := []string{
+		"null",
+		"1",
+		"1.0",
+		"-Infinity",
+		`"hi\x00"`,
+		"h'00ff'",
+		"b64'AA=='",
+		"[1, undefined, 3]",
+		`{"a": 1, "b": [true, 2.5], "c": {"d": "x"}}`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := ParseText(data)
+		if err != nil {
+			return
+		}
+		var sb strings.Builder
+		if err := WriteText(&sb, doc, TextOptions{}); err != nil {
+			t.Fatalf("write text: %v", err)
+		}
+		again, err := ParseText([]byte(sb.String()))
+		if err != nil {
+			t.Fatalf("parse text roundtrip: %v\n%s", err, sb.String())
+		}
+		if !bytes.Equal(doc, again) {
+			t.Fatalf("roundtrip changed document bytes for %s", sb.String())
+		}
+	})
+}
+
+func FuzzVerify(f *testing.F) {
+	seeds := []string{
+		"null",
+		"[]",
+		"{}",
+		`{"a":1,"b":[true,false],"c":{"d":"x"}}`,
+		`[0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17]`,
+	}
+	for _, seed := range seeds {
+		doc, err := FromJSON([]byte(seed))
+		if err != nil {
+			f.Fatalf("fromjson seed: %v", err)
+		}
+		if err := Verify(doc, VerifyLimits{}); err != nil {
+			f.Fatalf("verify seed %s: %v", seed, err)
+		}
+		f.Add(doc)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := Verify(data, VerifyLimits{MaxNodes: 1 << 16}); err != nil {
+			return
+		}
+		tr, err := ParseTrailer(data)
+		if err != nil {
+			t.Fatalf("verified doc trailer: %v", err)
+		}
+		if _, err := DecodeValueAt(data, tr.RootOffset); err != nil {
+			t.Fatalf("verified doc root: %v", err)
+		}
+	})
+}
+
+func FuzzFromCBOR(f *testing.F) {
+	seeds := [][]byte{
+		{0xf6},
+		{0x01},
+		{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		{0xf9, 0x3c, 0x00},
+		{0x62, 'h', 'i'},
+		{0x42, 0x00, 0xff},
+		{0x82, 0x01, 0xf5},
+		{0xa1, 0x61, 'a', 0x01},
+		{0x9f, 0x01, 0xff},
+		{0xc2, 0x49, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0xc2, 0x05},
+		{0xc3, 0x18, 0x40},
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := FromCBOR(data)
+		if err != nil {
+			return
+		}
+		if err := Verify(doc, VerifyLimits{}); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		out, err := ToCBOR(doc)
+		if err != nil {
+			t.Fatalf("tocbor: %v", err)
+		}
+		again, err := FromCBOR(out)
+		if err != nil {
+			t.Fatalf("fromcbor roundtrip: %v", err)
+		}
+		out2, err := ToCBOR(again)
+		if err != nil {
+			t.Fatalf("tocbor roundtrip: %v", err)
+		}
+		if !bytes.Equal(out, out2) {
+			t.Fatalf("roundtrip mismatch: %x != %x", out, out2)
+		}
+	})
+}
+
 func valueFromFuzzBytes(data []byte) Value {
 	typ := ValueType(data[0] & 0x7)
 	payload := data[1:]
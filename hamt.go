@@ -12,9 +12,14 @@ const (
 	maxDepth32 = 7
 )
 
+// mapBuilderIndexMin is the entry count above which MapBuilder looks keys up
+// in a map instead of scanning its entries.
+const mapBuilderIndexMin = 16
+
 // MapBuilder builds a HAMT map tree from key/value pairs.
 type MapBuilder struct {
 	entries   []MapLeafEntry
+	index     map[string]int
 	workspace *encodeWorkspace
 }
 
@@ -32,13 +37,39 @@ func newMapBuilderWithWorkspace(workspace *encodeWorkspace) *MapBuilder {
 
 // Set stores a key/value pair without copying the key bytes.
 func (b *MapBuilder) Set(key []byte, v Value) {
+	if i := b.find(key); i >= 0 {
+		b.entries[i].Value = v
+		return
+	}
+	b.entries = append(b.entries, MapLeafEntry{Key: key, Value: v})
+	if b.index != nil {
+		b.index[string(key)] = len(b.entries) - 1
+	} else if len(b.entries) > mapBuilderIndexMin {
+		b.index = make(map[string]int, 2*len(b.entries))
+		for i, e := range b.entries {
+			b.index[string(e.Key)] = i
+		}
+	}
+}
+
+func (b *MapBuilder) has(key []byte) bool {
+	return b.find(key) >= 0
+}
+
+// find returns the index of key in b.entries, or -1.
+func (b *MapBuilder) find(key []byte) int {
+	if b.index != nil {
+		if i, ok := b.index[string(key)]; ok {
+			return i
+		}
+		return -1
+	}
 	for i := range b.entries {
 		if bytes.Equal(b.entries[i].Key, key) {
-			b.entries[i].Value = v
-			return
+			return i
 		}
 	}
-	b.entries = append(b.entries, MapLeafEntry{Key: key, Value: v})
+	return -1
 }
 
 // SetString stores a key/value pair from a string key.
@@ -51,6 +82,7 @@ func (b *MapBuilder) Build(builder *Builder) (uint32, error) {
 	if builder == nil {
 		return 0, fmt.Errorf("nil builder")
 	}
+	dedupWithWorkspace(builder, b.workspace)
 	root := buildMapNodeFromEntries(b.entries, 0, b.workspace)
 	return encodeMapNode(builder, root, b.workspace)
 }
@@ -0,0 +1,217 @@
+package tron
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Version is a committed root recorded in a document's trailer chain.
+type Version struct {
+	RootOffset     uint32
+	PrevRootOffset uint32
+	// End is the offset just past the version's trailer when that trailer is
+	// still in the document, and just past its root node otherwise.
+	End uint32
+	// trailer reports whether the version's trailer ends at End.
+	trailer bool
+}
+
+// DocHistory lists the versions recorded in a document, newest first.
+type DocHistory struct {
+	doc      []byte
+	versions []Version
+}
+
+// History walks the PrevRootOffset chain of doc and returns its versions.
+//
+// Doc transactions, Compact and the store package leave each commit's trailer
+// after its root, so the chain is read from those trailers. Copy-on-write
+// helpers built on NewBuilderFromDocument drop the previous trailer, so the
+// predecessor of a root without one is taken to be the closest earlier node
+// that no node up to that root refers to. Helpers that reach their result in
+// several steps, such as merge.ApplyMergePatch with several keys, leave
+// intermediate roots that are then listed as versions too.
+func History(doc []byte) (*DocHistory, error) {
+	versions, err := historyVersions(doc, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &DocHistory{doc: doc, versions: versions}, nil
+}
+
+// historyVersions returns up to limit versions of doc, newest first, or all of
+// them when limit is negative.
+func historyVersions(doc []byte, limit int) ([]Version, error) {
+	if _, err := DetectDocType(doc); err != nil {
+		return nil, err
+	}
+	tr, err := ParseTrailer(doc)
+	if err != nil {
+		return nil, err
+	}
+	cur := Version{RootOffset: tr.RootOffset, PrevRootOffset: tr.PrevRootOffset, End: uint32(len(doc)), trailer: true}
+	var versions []Version
+	var scan *historyScan
+	for {
+		versions = append(versions, cur)
+		if cur.PrevRootOffset == 0 || len(versions) == limit {
+			return versions, nil
+		}
+		prev := cur.PrevRootOffset
+		if prev >= cur.RootOffset {
+			return nil, fmt.Errorf("history root %d is not before root %d", prev, cur.RootOffset)
+		}
+		h, _, err := NodeSliceAt(doc, prev)
+		if err != nil {
+			return nil, fmt.Errorf("history root %d: %w", prev, err)
+		}
+		if prevTr, prevEnd, ok := embeddedTrailer(doc, prev, cur.RootOffset); ok {
+			cur = Version{RootOffset: prev, PrevRootOffset: prevTr.PrevRootOffset, End: prevEnd, trailer: true}
+			continue
+		}
+		if scan == nil {
+			scan, err = scanHistory(doc, uint32(len(doc))-TrailerSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		prevPrev, err := scan.prevRoot(prev)
+		if err != nil {
+			return nil, err
+		}
+		cur = Version{RootOffset: prev, PrevRootOffset: prevPrev, End: prev + h.NodeLen}
+	}
+}
+
+// historyScan records every node of a document in order, with the offset of
+// the first node referring to it, or zero when none does.
+type historyScan struct {
+	offsets  []uint32
+	firstRef []uint32
+	index    map[uint32]int
+}
+
+// scanHistory reads the nodes between the header and limit, skipping the
+// trailers left after earlier roots.
+func scanHistory(doc []byte, limit uint32) (*historyScan, error) {
+	s := &historyScan{index: make(map[uint32]int)}
+	for pos := uint32(len(HeaderMagic)); pos < limit; {
+		h, node, err := NodeSliceAt(doc[:limit], pos)
+		if err != nil {
+			return nil, fmt.Errorf("history scan at %d: %w", pos, err)
+		}
+		start, count, err := nodeAddrRange(h, node)
+		if err != nil {
+			return nil, fmt.Errorf("history scan at %d: %w", pos, err)
+		}
+		for i := range count {
+			child := binary.LittleEndian.Uint32(node[start+i*4:])
+			if j, ok := s.index[child]; ok && s.firstRef[j] == 0 {
+				s.firstRef[j] = pos
+			}
+		}
+		s.index[pos] = len(s.offsets)
+		s.offsets = append(s.offsets, pos)
+		s.firstRef = append(s.firstRef, 0)
+		next := pos + h.NodeLen
+		if _, end, ok := embeddedTrailer(doc, pos, limit); ok {
+			next = end
+		}
+		pos = next
+	}
+	return s, nil
+}
+
+// prevRoot returns the closest node before root that no node up to root
+// refers to, or zero when there is none.
+func (s *historyScan) prevRoot(root uint32) (uint32, error) {
+	i, ok := s.index[root]
+	if !ok {
+		return 0, fmt.Errorf("history root %d is not on a node boundary", root)
+	}
+	for j := i - 1; j >= 0; j-- {
+		if ref := s.firstRef[j]; ref == 0 || ref > root {
+			return s.offsets[j], nil
+		}
+	}
+	return 0, nil
+}
+
+// embeddedTrailer returns the trailer written directly after the root node at
+// off, provided it ends at or before limit and records off as its root.
+func embeddedTrailer(doc []byte, off uint32, limit uint32) (Trailer, uint32, bool) {
+	h, _, err := NodeSliceAt(doc, off)
+	if err != nil {
+		return Trailer{}, 0, false
+	}
+	pos := uint64(off) + uint64(h.NodeLen)
+	if pos+TrailerSize > uint64(limit) {
+		return Trailer{}, 0, false
+	}
+	end := uint32(pos) + TrailerSize
+	tr, err := ParseTrailer(doc[:end])
+	if err != nil || tr.RootOffset != off {
+		return Trailer{}, 0, false
+	}
+	if tr.PrevRootOffset != 0 && tr.PrevRootOffset >= uint32(pos) {
+		return Trailer{}, 0, false
+	}
+	return tr, end, true
+}
+
+// Len returns the number of recorded versions.
+func (h *DocHistory) Len() int {
+	return len(h.versions)
+}
+
+// Versions returns the recorded versions, newest first.
+func (h *DocHistory) Versions() []Version {
+	return append([]Version{}, h.versions...)
+}
+
+// Version returns the i-th version, where 0 is the current root.
+func (h *DocHistory) Version(i int) (Version, error) {
+	if i < 0 || i >= len(h.versions) {
+		return Version{}, fmt.Errorf("history index %d out of range", i)
+	}
+	return h.versions[i], nil
+}
+
+// Roots returns the recorded root offsets, newest first.
+func (h *DocHistory) Roots() []uint32 {
+	out := make([]uint32, len(h.versions))
+	for i, v := range h.versions {
+		out[i] = v.RootOffset
+	}
+	return out
+}
+
+// Document returns the i-th version as a document. When the version's
+// trailer is still in the buffer the result is a view of the prefix ending
+// there; otherwise it is a copy of the prefix ending at the root with a new
+// trailer appended, as DocForRoot builds.
+func (h *DocHistory) Document(i int) ([]byte, error) {
+	v, err := h.Version(i)
+	if err != nil {
+		return nil, err
+	}
+	if v.trailer {
+		return h.doc[:v.End:v.End], nil
+	}
+	out := make([]byte, 0, int(v.End)+TrailerSize)
+	out = append(out, h.doc[:v.End]...)
+	return AppendTrailer(out, Trailer{RootOffset: v.RootOffset, PrevRootOffset: v.PrevRootOffset}), nil
+}
+
+// Diff reports the changes needed to turn version older into version newer.
+func (h *DocHistory) Diff(older, newer int) ([]Change, error) {
+	a, err := h.Version(older)
+	if err != nil {
+		return nil, err
+	}
+	b, err := h.Version(newer)
+	if err != nil {
+		return nil, err
+	}
+	return DiffRoots(h.doc, a.RootOffset, b.RootOffset)
+}
@@ -0,0 +1,154 @@
+package tron_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	tron "github.com/starfederation/tron-go"
+	"github.com/starfederation/tron-go/merge"
+)
+
+func TestHistoryWalksCopyOnWriteEdits(t *testing.T) {
+	arr := mustFromJSON(t, `[1,2,3]`)
+	arrStates := []string{`[1,2,3]`}
+	var err error
+	for i, v := range []int64{10, 30} {
+		arr, err = tron.ArrSetDocument(arr, uint32(2*i), tron.Value{Type: tron.TypeI64, I64: v})
+		if err != nil {
+			t.Fatalf("arr set %d: %v", i, err)
+		}
+	}
+	arrStates = append(arrStates, `[10,2,3]`, `[10,2,30]`)
+	checkHistory(t, arr, arrStates)
+
+	obj := mustFromJSON(t, `{"id":1,"meta":{"v":0,"tag":"x"}}`)
+	objStates := []string{`{"id":1,"meta":{"v":0,"tag":"x"}}`}
+	root := mustTrailer(t, obj).RootOffset
+	obj, root, err = tron.SetFieldValue(obj, root, "id", tron.XXH32([]byte("id"), 0), 2)
+	if err != nil {
+		t.Fatalf("set field: %v", err)
+	}
+	objStates = append(objStates, `{"id":2,"meta":{"v":0,"tag":"x"}}`)
+	obj, err = merge.ApplyMergePatch(obj, mustFromJSON(t, `{"meta":{"v":1}}`))
+	if err != nil {
+		t.Fatalf("merge patch: %v", err)
+	}
+	objStates = append(objStates, `{"id":2,"meta":{"v":1,"tag":"x"}}`)
+	root = mustTrailer(t, obj).RootOffset
+	obj, _, err = tron.SetFieldValue(obj, root, "id", tron.XXH32([]byte("id"), 0), 3)
+	if err != nil {
+		t.Fatalf("set field: %v", err)
+	}
+	objStates = append(objStates, `{"id":3,"meta":{"v":1,"tag":"x"}}`)
+	hist := checkHistory(t, obj, objStates)
+
+	changes, err := hist.Diff(hist.Len()-1, 0)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	slices.Sort(paths)
+	if !slices.Equal(paths, []string{"/id", "/meta/v"}) {
+		t.Fatalf("diff paths = %v", paths)
+	}
+}
+
+func TestHistoryMixesTxnAndCopyOnWrite(t *testing.T) {
+	update := func(doc []byte, n int64) []byte {
+		t.Helper()
+		d, err := tron.NewDoc(doc)
+		if err != nil {
+			t.Fatalf("new doc: %v", err)
+		}
+		err = d.Update(func(tx *tron.Txn) error {
+			return tx.SetKey("n", tron.Value{Type: tron.TypeI64, I64: n})
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", n, err)
+		}
+		return d.Bytes()
+	}
+	set := func(doc []byte, n int64) []byte {
+		t.Helper()
+		out, err := tron.SetPointer(doc, "/n", tron.Value{Type: tron.TypeI64, I64: n}, tron.PointerCreateNone)
+		if err != nil {
+			t.Fatalf("set %d: %v", n, err)
+		}
+		return out
+	}
+	doc := mustFromJSON(t, `{"n":0}`)
+	doc = set(update(update(set(set(update(doc, 1), 2), 3), 4), 5), 6)
+	states := []string{`{"n":0}`}
+	for n := 1; n <= 6; n++ {
+		states = append(states, fmt.Sprintf(`{"n":%d}`, n))
+	}
+	checkHistory(t, doc, states)
+}
+
+// checkHistory walks the history of doc and compares each version, oldest
+// first, with states.
+func checkHistory(t *testing.T, doc []byte, states []string) *tron.DocHistory {
+	t.Helper()
+	hist, err := tron.History(doc)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if hist.Len() != len(states) {
+		t.Fatalf("history has %d versions, want %d: %+v", hist.Len(), len(states), hist.Versions())
+	}
+	for i := range states {
+		view, err := hist.Document(i)
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		if err := tron.Verify(view, tron.VerifyLimits{}); err != nil {
+			t.Fatalf("verify %d: %v", i, err)
+		}
+		if want := states[len(states)-1-i]; !jsonEqual(t, view, want) {
+			got, _ := tron.ToJSON(view)
+			t.Fatalf("version %d = %s, want %s", i, got, want)
+		}
+	}
+	return hist
+}
+
+func mustFromJSON(t *testing.T, s string) []byte {
+	t.Helper()
+	doc, err := tron.FromJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("from json %s: %v", s, err)
+	}
+	return doc
+}
+
+func mustTrailer(t *testing.T, doc []byte) tron.Trailer {
+	t.Helper()
+	tr, err := tron.ParseTrailer(doc)
+	if err != nil {
+		t.Fatalf("trailer: %v", err)
+	}
+	return tr
+}
+
+// jsonEqual compares doc with the JSON text want, ignoring key order.
+func jsonEqual(t *testing.T, doc []byte, want string) bool {
+	t.Helper()
+	got, err := tron.ToJSON(doc)
+	if err != nil {
+		t.Fatalf("to json: %v", err)
+	}
+	var gotAny, wantAny any
+	if err := json.Unmarshal([]byte(got), &gotAny); err != nil {
+		t.Fatalf("parse %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantAny); err != nil {
+		t.Fatalf("parse %s: %v", want, err)
+	}
+	return reflect.DeepEqual(gotAny, wantAny)
+}
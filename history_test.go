@@ -0,0 +1,66 @@
+package tron
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHistoryWalksDocCommits(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"n":0}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	d, err := NewDoc(doc)
+	if err != nil {
+		t.Fatalf("new doc: %v", err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		err := d.Update(func(tx *Txn) error {
+			return tx.SetKey("n", Value{Type: TypeI64, I64: i})
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	hist, err := History(d.Bytes())
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if hist.Len() != 4 {
+		t.Fatalf("history has %d versions, want 4", hist.Len())
+	}
+	for i := 0; i < hist.Len(); i++ {
+		view, err := hist.Document(i)
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		got, err := ToJSON(view)
+		if err != nil {
+			t.Fatalf("to json %d: %v", i, err)
+		}
+		if want := fmt.Sprintf(`{"n":%d}`, 3-i); got != want {
+			t.Fatalf("version %d = %s, want %s", i, got, want)
+		}
+	}
+	changes, err := hist.Diff(3, 0)
+	if err != nil || len(changes) != 1 || changes[0].Path != "/n" {
+		t.Fatalf("diff = %v, %v", changes, err)
+	}
+}
+
+func TestSharedPrefixLen(t *testing.T) {
+	a := make([]byte, 300)
+	for i := range a {
+		a[i] = byte(i)
+	}
+	for _, n := range []int{0, 1, 63, 64, 65, 200, 299} {
+		b := append([]byte{}, a...)
+		b[n]++
+		if got := sharedPrefixLen(a, b); got != uint32(n) {
+			t.Fatalf("mismatch at %d: shared %d", n, got)
+		}
+	}
+	if got := sharedPrefixLen(a, append(append([]byte{}, a...), 1, 2)); got != 300 {
+		t.Fatalf("prefix of longer slice: shared %d", got)
+	}
+}
@@ -15,41 +15,41 @@ import (
 
 // FromJSON parses JSON using simdjson-go and returns a TRON document.
 func FromJSON(data []byte) ([]byte, error) {
+	builder := NewBuilder()
+	val, err := valueFromJSON(data, builder, newEncodeWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	switch val.Type {
+	case TypeArr, TypeMap:
+		return builder.BytesWithTrailer(val.Offset, 0), nil
+	default:
+		return EncodeScalarDocument(val)
+	}
+}
+
+// valueFromJSON parses a single JSON value and appends any arr/map nodes to builder.
+func valueFromJSON(data []byte, builder *Builder, workspace *encodeWorkspace) (Value, error) {
 	trimmed := bytes.TrimSpace(data)
 	if len(trimmed) == 0 {
-		return nil, fmt.Errorf("json input is empty")
+		return Value{}, fmt.Errorf("json input is empty")
 	}
 	if trimmed[0] != '{' && trimmed[0] != '[' {
-		val, err := scalarValueFromJSON(trimmed)
-		if err != nil {
-			return nil, err
-		}
-		return EncodeScalarDocument(val)
+		return scalarValueFromJSON(trimmed)
 	}
 	parsed, err := simdjson.Parse(data, nil)
 	if err != nil {
-		return nil, err
+		return Value{}, err
 	}
 	it := parsed.Iter()
 	if it.Advance() != simdjson.TypeRoot {
-		return nil, fmt.Errorf("json root not found")
+		return Value{}, fmt.Errorf("json root not found")
 	}
 	typ, root, err := it.Root(nil)
 	if err != nil {
-		return nil, err
-	}
-	builder := NewBuilder()
-	workspace := newEncodeWorkspace()
-	val, err := valueFromJSONIter(typ, root, builder, workspace)
-	if err != nil {
-		return nil, err
-	}
-	switch val.Type {
-	case TypeArr, TypeMap:
-		return builder.BytesWithTrailer(val.Offset, 0), nil
-	default:
-		return EncodeScalarDocument(val)
+		return Value{}, err
 	}
+	return valueFromJSONIter(typ, root, builder, workspace)
 }
 
 func scalarValueFromJSON(data []byte) (Value, error) {
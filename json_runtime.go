@@ -1,17 +1,48 @@
 package tron
 
 import (
+	"encoding"
+	"encoding/base64"
 	stdjson "encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxGoDepth bounds reflection recursion so cyclic Go values fail instead of overflowing the stack.
+const maxGoDepth = 1000
+
+var (
+	jsonMarshalerType   = reflect.TypeFor[stdjson.Marshaler]()
+	jsonUnmarshalerType = reflect.TypeFor[stdjson.Unmarshaler]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	jsonNumberType      = reflect.TypeFor[stdjson.Number]()
 )
 
 // Marshal encodes a Go value into a TRON document using JSON semantics.
+// Struct fields honor json tags (including omitempty, omitzero and string),
+// embedded structs are flattened, and []byte values are stored as TypeBin.
+// Unsigned integers above math.MaxInt64 are stored as TypeF64 and lose their
+// low bits; Unmarshal reads them back into unsigned fields, with 2^64
+// saturating to math.MaxUint64.
 func Marshal(v any) ([]byte, error) {
-	data, err := stdjson.Marshal(v)
+	builder := NewBuilder()
+	enc := goEncoder{builder: builder, workspace: newEncodeWorkspace()}
+	val, err := enc.encode(reflect.ValueOf(v), 0)
 	if err != nil {
 		return nil, err
 	}
-	return FromJSON(data)
+	switch val.Type {
+	case TypeArr, TypeMap:
+		return builder.BytesWithTrailer(val.Offset, 0), nil
+	default:
+		return EncodeScalarDocument(val)
+	}
 }
 
 // Unmarshal decodes a TRON document into a Go value using JSON semantics.
@@ -19,15 +50,18 @@ func Unmarshal(doc []byte, out any) error {
 	if out == nil {
 		return fmt.Errorf("nil target")
 	}
-	value, err := documentToAny(doc)
+	if _, err := DetectDocType(doc); err != nil {
+		return err
+	}
+	tr, err := ParseTrailer(doc)
 	if err != nil {
 		return err
 	}
-	data, err := stdjson.Marshal(value)
+	root, err := DecodeValueAt(doc, tr.RootOffset)
 	if err != nil {
 		return err
 	}
-	return stdjson.Unmarshal(data, out)
+	return UnmarshalValue(doc, root, out)
 }
 
 // UnmarshalValue decodes a TRON value into a Go value using JSON semantics.
@@ -35,15 +69,12 @@ func UnmarshalValue(doc []byte, v Value, out any) error {
 	if out == nil {
 		return fmt.Errorf("nil target")
 	}
-	value, err := valueToAny(doc, v)
-	if err != nil {
-		return err
-	}
-	data, err := stdjson.Marshal(value)
-	if err != nil {
-		return err
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("tron: Unmarshal(non-pointer %T)", out)
 	}
-	return stdjson.Unmarshal(data, out)
+	dec := goDecoder{doc: doc}
+	return dec.decode(v, rv, 0)
 }
 
 // ValueFromGo encodes a Go value into a TRON value stored in builder.
@@ -51,35 +82,828 @@ func ValueFromGo(builder *Builder, v any) (Value, error) {
 	if builder == nil {
 		return Value{}, fmt.Errorf("nil builder")
 	}
-	doc, err := Marshal(v)
+	enc := goEncoder{builder: builder, workspace: newEncodeWorkspace()}
+	return enc.encode(reflect.ValueOf(v), 0)
+}
+
+type goEncoder struct {
+	builder   *Builder
+	workspace *encodeWorkspace
+}
+
+func (e *goEncoder) encode(rv reflect.Value, depth int) (Value, error) {
+	if depth > maxGoDepth {
+		return Value{}, fmt.Errorf("tron: marshal exceeds max depth %d", maxGoDepth)
+	}
+	if !rv.IsValid() {
+		return Value{Type: TypeNil}, nil
+	}
+	if (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil() {
+		return Value{Type: TypeNil}, nil
+	}
+	if m, ok := marshalerFor(rv, jsonMarshalerType); ok {
+		data, err := m.(stdjson.Marshaler).MarshalJSON()
+		if err != nil {
+			return Value{}, fmt.Errorf("tron: MarshalJSON for %s: %w", rv.Type(), err)
+		}
+		return valueFromJSON(data, e.builder, e.workspace)
+	}
+	if m, ok := marshalerFor(rv, textMarshalerType); ok {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return Value{}, fmt.Errorf("tron: MarshalText for %s: %w", rv.Type(), err)
+		}
+		return Value{Type: TypeTxt, Bytes: text}, nil
+	}
+	if rv.Type() == jsonNumberType {
+		return numberValue(rv.String())
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return Value{Type: TypeBit, Bool: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Value{Type: TypeI64, I64: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return Value{Type: TypeF64, F64: float64(u)}, nil
+		}
+		return Value{Type: TypeI64, I64: int64(u)}, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return Value{}, fmt.Errorf("tron: unsupported float value %v", f)
+		}
+		return Value{Type: TypeF64, F64: f}, nil
+	case reflect.String:
+		return Value{Type: TypeTxt, Bytes: []byte(rv.String())}, nil
+	case reflect.Interface, reflect.Pointer:
+		return e.encode(rv.Elem(), depth+1)
+	case reflect.Slice:
+		if rv.IsNil() {
+			return Value{Type: TypeNil}, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 && !elemHasMarshaler(rv.Type().Elem()) {
+			return Value{Type: TypeBin, Bytes: append([]byte{}, rv.Bytes()...)}, nil
+		}
+		return e.encodeArray(rv, depth)
+	case reflect.Array:
+		return e.encodeArray(rv, depth)
+	case reflect.Map:
+		if rv.IsNil() {
+			return Value{Type: TypeNil}, nil
+		}
+		return e.encodeMap(rv, depth)
+	case reflect.Struct:
+		return e.encodeStruct(rv, depth)
+	default:
+		return Value{}, fmt.Errorf("tron: unsupported type %s", rv.Type())
+	}
+}
+
+func (e *goEncoder) encodeArray(rv reflect.Value, depth int) (Value, error) {
+	ab := newArrayBuilderWithWorkspace(e.workspace)
+	n := rv.Len()
+	for i := 0; i < n; i++ {
+		val, err := e.encode(rv.Index(i), depth+1)
+		if err != nil {
+			return Value{}, err
+		}
+		ab.Append(val)
+	}
+	off, err := ab.Build(e.builder)
 	if err != nil {
 		return Value{}, err
 	}
-	if _, err := DetectDocType(doc); err != nil {
-		return Value{}, err
+	return Value{Type: TypeArr, Offset: off}, nil
+}
+
+func (e *goEncoder) encodeMap(rv reflect.Value, depth int) (Value, error) {
+	mb := newMapBuilderWithWorkspace(e.workspace)
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := mapKeyString(iter.Key())
+		if err != nil {
+			return Value{}, err
+		}
+		val, err := e.encode(iter.Value(), depth+1)
+		if err != nil {
+			return Value{}, err
+		}
+		mb.Set([]byte(key), val)
 	}
-	tr, err := ParseTrailer(doc)
+	off, err := mb.Build(e.builder)
 	if err != nil {
 		return Value{}, err
 	}
-	root, err := DecodeValueAt(doc, tr.RootOffset)
+	return Value{Type: TypeMap, Offset: off}, nil
+}
+
+func (e *goEncoder) encodeStruct(rv reflect.Value, depth int) (Value, error) {
+	mb := newMapBuilderWithWorkspace(e.workspace)
+	for _, f := range cachedGoFields(rv.Type()).list {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok {
+			continue
+		}
+		if f.omitEmpty && isEmptyGoValue(fv) {
+			continue
+		}
+		if f.omitZero && isZeroGoValue(fv) {
+			continue
+		}
+		val, err := e.encode(fv, depth+1)
+		if err != nil {
+			return Value{}, err
+		}
+		if f.quoted {
+			val = quotedValue(val)
+		}
+		mb.Set(f.nameBytes, val)
+	}
+	off, err := mb.Build(e.builder)
 	if err != nil {
 		return Value{}, err
 	}
-	return CloneValueFromDoc(doc, root, builder)
+	return Value{Type: TypeMap, Offset: off}, nil
 }
 
-func documentToAny(doc []byte) (any, error) {
-	if _, err := DetectDocType(doc); err != nil {
-		return nil, err
+func marshalerFor(rv reflect.Value, iface reflect.Type) (any, bool) {
+	if rv.Kind() != reflect.Pointer && rv.CanAddr() && reflect.PointerTo(rv.Type()).Implements(iface) {
+		return rv.Addr().Interface(), true
 	}
-	tr, err := ParseTrailer(doc)
+	if rv.Type().Implements(iface) {
+		return rv.Interface(), true
+	}
+	return nil, false
+}
+
+func elemHasMarshaler(t reflect.Type) bool {
+	p := reflect.PointerTo(t)
+	return p.Implements(jsonMarshalerType) || p.Implements(textMarshalerType)
+}
+
+func numberValue(s string) (Value, error) {
+	if s == "" {
+		s = "0"
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Value{Type: TypeI64, I64: i}, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
 	if err != nil {
-		return nil, err
+		return Value{}, fmt.Errorf("tron: invalid number literal %q", s)
 	}
-	root, err := DecodeValueAt(doc, tr.RootOffset)
+	return Value{Type: TypeF64, F64: f}, nil
+}
+
+// quotedValue applies the json ",string" option to an encoded scalar.
+func quotedValue(v Value) Value {
+	switch v.Type {
+	case TypeTxt:
+		return Value{Type: TypeTxt, Bytes: []byte(strconv.Quote(string(v.Bytes)))}
+	case TypeBit:
+		return Value{Type: TypeTxt, Bytes: []byte(strconv.FormatBool(v.Bool))}
+	case TypeI64, TypeF64:
+		s, _ := v.AsString()
+		return Value{Type: TypeTxt, Bytes: []byte(s)}
+	default:
+		return v
+	}
+}
+
+func mapKeyString(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if m, ok := marshalerFor(k, textMarshalerType); ok {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	default:
+		return "", fmt.Errorf("tron: unsupported map key type %s", k.Type())
+	}
+}
+
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(idx)
+	}
+	return rv, true
+}
+
+func isEmptyGoValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+func isZeroGoValue(rv reflect.Value) bool {
+	type zeroer interface{ IsZero() bool }
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return true
+	}
+	if !rv.CanInterface() {
+		return rv.IsZero()
+	}
+	if z, ok := rv.Interface().(zeroer); ok {
+		return z.IsZero()
+	}
+	return rv.IsZero()
+}
+
+type goDecoder struct {
+	doc []byte
+}
+
+func (d *goDecoder) decode(v Value, rv reflect.Value, depth int) error {
+	if depth > maxGoDepth {
+		return fmt.Errorf("tron: unmarshal exceeds max depth %d", maxGoDepth)
+	}
+	u, rv := indirectGoValue(rv, v.Type == TypeNil)
+	if u != nil {
+		if ju, ok := u.(stdjson.Unmarshaler); ok {
+			var sb strings.Builder
+			if err := writeJSONValue(&sb, d.doc, v); err != nil {
+				return err
+			}
+			return ju.UnmarshalJSON([]byte(sb.String()))
+		}
+		if tu, ok := u.(encoding.TextUnmarshaler); ok {
+			switch v.Type {
+			case TypeNil:
+				return nil
+			case TypeTxt, TypeBin:
+				return tu.UnmarshalText(v.Bytes)
+			default:
+				return d.typeError(v, reflect.TypeOf(u))
+			}
+		}
+	}
+
+	if v.Type == TypeNil {
+		switch rv.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			rv.SetZero()
+		}
+		return nil
+	}
+	if rv.Kind() == reflect.Interface {
+		if rv.NumMethod() != 0 {
+			return d.typeError(v, rv.Type())
+		}
+		val, err := d.toInterface(v, depth)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(val))
+		return nil
+	}
+	if rv.Type() == jsonNumberType {
+		switch v.Type {
+		case TypeI64, TypeF64:
+			s, _ := v.AsString()
+			rv.SetString(s)
+			return nil
+		}
+		return d.typeError(v, rv.Type())
+	}
+
+	switch v.Type {
+	case TypeBit:
+		if rv.Kind() != reflect.Bool {
+			return d.typeError(v, rv.Type())
+		}
+		rv.SetBool(v.Bool)
+		return nil
+	case TypeI64, TypeF64:
+		return d.decodeNumber(v, rv)
+	case TypeTxt:
+		switch {
+		case rv.Kind() == reflect.String:
+			rv.SetString(string(v.Bytes))
+			return nil
+		case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+			decoded, err := base64.StdEncoding.DecodeString(string(v.Bytes))
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(decoded)
+			return nil
+		}
+		return d.typeError(v, rv.Type())
+	case TypeBin:
+		switch {
+		case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+			rv.SetBytes(append([]byte{}, v.Bytes...))
+			return nil
+		case rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8:
+			n := reflect.Copy(rv, reflect.ValueOf(v.Bytes))
+			for i := n; i < rv.Len(); i++ {
+				rv.Index(i).SetZero()
+			}
+			return nil
+		case rv.Kind() == reflect.String:
+			rv.SetString(base64.StdEncoding.EncodeToString(v.Bytes))
+			return nil
+		}
+		return d.typeError(v, rv.Type())
+	case TypeArr:
+		return d.decodeArray(v, rv, depth)
+	case TypeMap:
+		switch rv.Kind() {
+		case reflect.Map:
+			return d.decodeMap(v, rv, depth)
+		case reflect.Struct:
+			return d.decodeStruct(v, rv, depth)
+		}
+		return d.typeError(v, rv.Type())
+	default:
+		return fmt.Errorf("unknown value type %d", v.Type)
+	}
+}
+
+func (d *goDecoder) decodeNumber(v Value, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := integralValue(v)
+		if !ok || rv.OverflowInt(i) {
+			return d.typeError(v, rv.Type())
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Type == TypeF64 && v.F64 >= math.MaxInt64 && v.F64 <= 1<<64 && math.Trunc(v.F64) == v.F64 {
+			// float64(math.MaxUint64) rounds up to 2^64, which Marshal
+			// writes for the largest uint64 values.
+			u := uint64(math.MaxUint64)
+			if v.F64 < 1<<64 {
+				u = uint64(v.F64)
+			}
+			if rv.OverflowUint(u) {
+				return d.typeError(v, rv.Type())
+			}
+			rv.SetUint(u)
+			return nil
+		}
+		i, ok := integralValue(v)
+		if !ok || i < 0 || rv.OverflowUint(uint64(i)) {
+			return d.typeError(v, rv.Type())
+		}
+		rv.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, _ := v.AsFloat64()
+		if rv.OverflowFloat(f) {
+			return d.typeError(v, rv.Type())
+		}
+		rv.SetFloat(f)
+	default:
+		return d.typeError(v, rv.Type())
+	}
+	return nil
+}
+
+func integralValue(v Value) (int64, bool) {
+	switch v.Type {
+	case TypeI64:
+		return v.I64, true
+	case TypeF64:
+		if math.Trunc(v.F64) != v.F64 || v.F64 < math.MinInt64 || v.F64 >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v.F64), true
+	default:
+		return 0, false
+	}
+}
+
+func (d *goDecoder) decodeArray(v Value, rv reflect.Value, depth int) error {
+	length, err := arrayRootLength(d.doc, v.Offset)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	switch rv.Kind() {
+	case reflect.Slice:
+		n := int(length)
+		if rv.IsNil() || rv.Cap() < n {
+			rv.Set(reflect.MakeSlice(rv.Type(), n, n))
+		} else {
+			rv.SetLen(n)
+			for i := 0; i < n; i++ {
+				rv.Index(i).SetZero()
+			}
+		}
+	case reflect.Array:
+		for i := int(length); i < rv.Len(); i++ {
+			rv.Index(i).SetZero()
+		}
+	default:
+		return d.typeError(v, rv.Type())
+	}
+	limit := uint32(rv.Len())
+	return ArrEach(d.doc, v.Offset, func(index uint32, elem Value) error {
+		if index >= limit {
+			return errStopRange
+		}
+		return d.decode(elem, rv.Index(int(index)), depth+1)
+	})
+}
+
+func (d *goDecoder) decodeMap(v Value, rv reflect.Value, depth int) error {
+	t := rv.Type()
+	switch t.Key().Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		if !reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) {
+			return d.typeError(v, t)
+		}
+	}
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(t))
+	}
+	return MapEach(d.doc, v.Offset, func(key []byte, val Value) error {
+		kv, err := mapKeyValue(key, t.Key())
+		if err != nil {
+			return err
+		}
+		ev := reflect.New(t.Elem()).Elem()
+		if err := d.decode(val, ev, depth+1); err != nil {
+			return err
+		}
+		rv.SetMapIndex(kv, ev)
+		return nil
+	})
+}
+
+func mapKeyValue(key []byte, t reflect.Type) (reflect.Value, error) {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) && t.Kind() != reflect.String {
+		kv := reflect.New(t)
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText(key); err != nil {
+			return reflect.Value{}, err
+		}
+		return kv.Elem(), nil
+	}
+	kv := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		kv.SetString(string(key))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(string(key), 10, 64)
+		if err != nil || kv.OverflowInt(i) {
+			return reflect.Value{}, fmt.Errorf("tron: cannot unmarshal map key %q into %s", key, t)
+		}
+		kv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(string(key), 10, 64)
+		if err != nil || kv.OverflowUint(u) {
+			return reflect.Value{}, fmt.Errorf("tron: cannot unmarshal map key %q into %s", key, t)
+		}
+		kv.SetUint(u)
+	default:
+		return reflect.Value{}, fmt.Errorf("tron: unsupported map key type %s", t)
+	}
+	return kv, nil
+}
+
+func (d *goDecoder) decodeStruct(v Value, rv reflect.Value, depth int) error {
+	fields := cachedGoFields(rv.Type())
+	return MapEach(d.doc, v.Offset, func(key []byte, val Value) error {
+		f := fields.lookup(key)
+		if f == nil {
+			return nil
+		}
+		fv, err := fieldByIndexAlloc(rv, f.index)
+		if err != nil {
+			return err
+		}
+		if f.quoted && val.Type == TypeTxt {
+			return d.decodeQuoted(val, fv)
+		}
+		return d.decode(val, fv, depth+1)
+	})
+}
+
+func (d *goDecoder) decodeQuoted(v Value, rv reflect.Value) error {
+	s := string(v.Bytes)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		unq, err := strconv.Unquote(s)
+		if err != nil {
+			return fmt.Errorf("tron: invalid quoted string %q", s)
+		}
+		rv.SetString(unq)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("tron: invalid quoted bool %q", s)
+		}
+		rv.SetBool(b)
+		return nil
+	default:
+		num, err := numberValue(s)
+		if err != nil {
+			return err
+		}
+		return d.decodeNumber(num, rv)
+	}
+}
+
+func (d *goDecoder) toInterface(v Value, depth int) (any, error) {
+	if depth > maxGoDepth {
+		return nil, fmt.Errorf("tron: unmarshal exceeds max depth %d", maxGoDepth)
+	}
+	switch v.Type {
+	case TypeNil:
+		return nil, nil
+	case TypeBit:
+		return v.Bool, nil
+	case TypeI64:
+		return float64(v.I64), nil
+	case TypeF64:
+		return v.F64, nil
+	case TypeTxt:
+		return string(v.Bytes), nil
+	case TypeBin:
+		return append([]byte{}, v.Bytes...), nil
+	case TypeArr:
+		length, err := arrayRootLength(d.doc, v.Offset)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]any, length)
+		err = ArrEach(d.doc, v.Offset, func(index uint32, elem Value) error {
+			if index >= length {
+				return fmt.Errorf("array index out of range: %d", index)
+			}
+			conv, err := d.toInterface(elem, depth+1)
+			if err != nil {
+				return err
+			}
+			out[index] = conv
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	case TypeMap:
+		out := make(map[string]any)
+		err := MapEach(d.doc, v.Offset, func(key []byte, val Value) error {
+			conv, err := d.toInterface(val, depth+1)
+			if err != nil {
+				return err
+			}
+			out[string(key)] = conv
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown value type %d", v.Type)
+	}
+}
+
+func (d *goDecoder) typeError(v Value, t reflect.Type) error {
+	return fmt.Errorf("tron: cannot unmarshal %s into Go value of type %s", v.Type, t)
+}
+
+// indirectGoValue walks pointers down to a settable value, allocating as needed.
+// It stops early and returns an unmarshaler when one is implemented along the way.
+func indirectGoValue(rv reflect.Value, decodingNil bool) (any, reflect.Value) {
+	if rv.Kind() != reflect.Pointer && rv.Type().Name() != "" && rv.CanAddr() {
+		rv = rv.Addr()
+	}
+	for {
+		if rv.Kind() == reflect.Interface && !rv.IsNil() {
+			e := rv.Elem()
+			if e.Kind() == reflect.Pointer && !e.IsNil() && (!decodingNil || e.Elem().Kind() == reflect.Pointer) {
+				rv = e
+				continue
+			}
+		}
+		if rv.Kind() != reflect.Pointer {
+			break
+		}
+		if decodingNil && rv.CanSet() {
+			break
+		}
+		if rv.Elem().Kind() == reflect.Interface && rv.Elem().Elem().Equal(rv) {
+			rv = rv.Elem()
+			break
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		if rv.Type().NumMethod() > 0 && rv.CanInterface() {
+			if rv.Type().Implements(jsonUnmarshalerType) || rv.Type().Implements(textUnmarshalerType) {
+				return rv.Interface(), reflect.Value{}
+			}
+		}
+		rv = rv.Elem()
+	}
+	return nil, rv
+}
+
+func fieldByIndexAlloc(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, idx := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Value{}, fmt.Errorf("tron: cannot set embedded pointer to unexported struct %s", rv.Type().Elem())
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(idx)
+	}
+	return rv, nil
+}
+
+type goField struct {
+	name      string
+	nameBytes []byte
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool
+}
+
+type goFields struct {
+	list   []goField
+	byName map[string]int
+}
+
+func (f *goFields) lookup(key []byte) *goField {
+	if i, ok := f.byName[string(key)]; ok {
+		return &f.list[i]
+	}
+	for i := range f.list {
+		if strings.EqualFold(f.list[i].name, string(key)) {
+			return &f.list[i]
+		}
+	}
+	return nil
+}
+
+var goFieldCache sync.Map // map[reflect.Type]*goFields
+
+func cachedGoFields(t reflect.Type) *goFields {
+	if f, ok := goFieldCache.Load(t); ok {
+		return f.(*goFields)
+	}
+	f, _ := goFieldCache.LoadOrStore(t, typeGoFields(t))
+	return f.(*goFields)
+}
+
+// typeGoFields returns the fields encoding/json would serialize for t,
+// applying its embedding and name dominance rules.
+func typeGoFields(t reflect.Type) *goFields {
+	type pending struct {
+		typ   reflect.Type
+		index []int
+	}
+	var all []goField
+	visited := map[reflect.Type]bool{}
+	next := []pending{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, p := range current {
+			if visited[p.typ] {
+				continue
+			}
+			visited[p.typ] = true
+			for i := 0; i < p.typ.NumField(); i++ {
+				sf := p.typ.Field(i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := make([]int, len(p.index)+1)
+				copy(index, p.index)
+				index[len(p.index)] = i
+
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, pending{typ: ft, index: index})
+					continue
+				}
+				f := goField{name: name, index: index, tagged: name != ""}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				for opt := range strings.SplitSeq(opts, ",") {
+					switch opt {
+					case "omitempty":
+						f.omitEmpty = true
+					case "omitzero":
+						f.omitZero = true
+					case "string":
+						switch ft.Kind() {
+						case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+							reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+							reflect.Float32, reflect.Float64, reflect.String:
+							f.quoted = true
+						}
+					}
+				}
+				f.nameBytes = []byte(f.name)
+				all = append(all, f)
+			}
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		if len(all[i].index) != len(all[j].index) {
+			return len(all[i].index) < len(all[j].index)
+		}
+		return all[i].tagged && !all[j].tagged
+	})
+	out := make([]goField, 0, len(all))
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].name == all[i].name {
+			j++
+		}
+		group := all[i:j]
+		i = j
+		if len(group) > 1 && len(group[1].index) == len(group[0].index) && group[1].tagged == group[0].tagged {
+			continue
+		}
+		out = append(out, group[0])
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].index, out[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	byName := make(map[string]int, len(out))
+	for i := range out {
+		byName[out[i].name] = i
 	}
-	return valueToAny(doc, root)
+	return &goFields{list: out, byName: byName}
 }
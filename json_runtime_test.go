@@ -0,0 +1,251 @@
+package tron
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jsonOptionals struct {
+	Sr  string         `json:"sr"`
+	So  string         `json:"so,omitempty"`
+	Sw  string         `json:"-"`
+	Ir  int            `json:"omitempty"`
+	Io  int            `json:"io,omitempty"`
+	Slr []string       `json:"slr,random"`
+	Slo []string       `json:"slo,omitempty"`
+	Mr  map[string]any `json:"mr"`
+	Mo  map[string]any `json:",omitempty"`
+	Fr  float64        `json:"fr"`
+	Fo  float64        `json:"fo,omitempty"`
+	Br  bool           `json:"br"`
+	Bo  bool           `json:"bo,omitempty"`
+	Ur  uint           `json:"ur"`
+	Uo  uint           `json:"uo,omitempty"`
+	Str struct{}       `json:"str"`
+	Sto struct{}       `json:"sto,omitempty"`
+}
+
+type jsonStringTag struct {
+	BoolStr    bool    `json:",string"`
+	IntStr     int64   `json:",string"`
+	UintptrStr uintptr `json:",string"`
+	StrStr     string  `json:",string"`
+	NumberStr  json.Number
+}
+
+type jsonBasicEmbedded struct {
+	jsonEmbeddedA
+	jsonEmbeddedB
+	Q int
+}
+
+type jsonEmbeddedA struct {
+	X int `json:"x"`
+	Y int
+}
+
+type jsonEmbeddedB struct {
+	Y int // Y is ambiguous with jsonEmbeddedA.Y and dropped.
+	Z string
+}
+
+type jsonTextKey struct {
+	name string
+}
+
+func (k jsonTextKey) MarshalText() ([]byte, error) {
+	return []byte("k:" + strings.ToUpper(k.name)), nil
+}
+
+func (k *jsonTextKey) UnmarshalText(b []byte) error {
+	k.name = strings.ToLower(strings.TrimPrefix(string(b), "k:"))
+	return nil
+}
+
+type jsonCustom struct {
+	N int
+}
+
+func (c jsonCustom) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]int{c.N, c.N * 2})
+}
+
+func (c *jsonCustom) UnmarshalJSON(b []byte) error {
+	var pair []int
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return err
+	}
+	c.N = pair[0]
+	return nil
+}
+
+type jsonAll struct {
+	Bool     bool
+	Int      int
+	Int8     int8
+	Int64    int64
+	Uint8    uint8
+	Uint64   uint64
+	Float32  float32
+	Float64  float64
+	String   string
+	Ptr      *string
+	NilPtr   *int
+	Slice    []int
+	Array    [3]string
+	Map      map[string]int
+	IntMap   map[int]string
+	TextMap  map[jsonTextKey]int
+	Iface    any
+	Nested   *jsonAll `json:",omitempty"`
+	Time     time.Time
+	Custom   jsonCustom
+	Number   json.Number
+	RawBytes []byte
+}
+
+// TestMarshalRoundTrip ports encoding/json round-trip cases: each value is
+// marshalled, unmarshalled into a fresh value of the same type and compared,
+// and the JSON rendering is compared against encoding/json where both define
+// the same output.
+func TestMarshalRoundTrip(t *testing.T) {
+	s := "pointed"
+	tests := []struct {
+		name string
+		in   any
+		json bool
+	}{
+		{"optionals", &jsonOptionals{Sr: "", Mr: map[string]any{}, Slr: nil}, true},
+		{"optionals set", &jsonOptionals{So: "x", Io: 1, Slo: []string{"a"}, Mo: map[string]any{"k": "v"}, Fo: 1.5, Bo: true, Uo: 3}, true},
+		{"string tag", &jsonStringTag{BoolStr: true, IntStr: 42, UintptrStr: 44, StrStr: "xzbit", NumberStr: "46"}, true},
+		{"embedded", &jsonBasicEmbedded{jsonEmbeddedA: jsonEmbeddedA{X: 1}, jsonEmbeddedB: jsonEmbeddedB{Z: "z"}, Q: 4}, true},
+		{"all", &jsonAll{
+			Bool: true, Int: -7, Int8: -8, Int64: math.MinInt64, Uint8: 255, Uint64: math.MaxInt64,
+			Float32: 1.25, Float64: 1e300, String: "héllo\n ", Ptr: &s,
+			Slice: []int{1, 2, 3}, Array: [3]string{"a", "", "c"},
+			Map: map[string]int{"a": 1, "b": 2}, IntMap: map[int]string{-1: "neg", 10: "ten"},
+			TextMap: map[jsonTextKey]int{{"up"}: 1},
+			Iface:   map[string]any{"list": []any{1.5, "x", nil, true}},
+			Nested:  &jsonAll{Int: 1, Slice: []int{}, Number: "0"},
+			Time:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+			Custom:  jsonCustom{N: 5}, Number: "12.5",
+		}, true},
+		{"bytes", &jsonAll{RawBytes: []byte{0, 1, 2, 0xff}, Number: "0"}, false},
+		{"top-level slice", &[]string{"a", "b"}, true},
+		{"top-level map", &map[string][]int{"a": {1}, "b": nil}, true},
+		{"top-level string", ptrTo("text"), true},
+		{"top-level int", ptrTo(int64(-12)), true},
+		{"max uint64", ptrTo(uint64(math.MaxUint64)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if err := Verify(doc, VerifyLimits{}); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			out := reflect.New(reflect.TypeOf(tt.in).Elem())
+			if err := Unmarshal(doc, out.Interface()); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			want := reflect.ValueOf(tt.in).Elem().Interface()
+			if got := out.Elem().Interface(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("round trip:\n got %#v\nwant %#v", got, want)
+			}
+			if !tt.json {
+				return
+			}
+			got, err := ToJSON(doc)
+			if err != nil {
+				t.Fatalf("to json: %v", err)
+			}
+			std, err := json.Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("encoding/json: %v", err)
+			}
+			var gotAny, stdAny any
+			if err := json.Unmarshal([]byte(got), &gotAny); err != nil {
+				t.Fatalf("parse %s: %v", got, err)
+			}
+			if err := json.Unmarshal(std, &stdAny); err != nil {
+				t.Fatalf("parse %s: %v", std, err)
+			}
+			if !reflect.DeepEqual(gotAny, stdAny) {
+				t.Fatalf("json differs:\n got %s\nwant %s", got, std)
+			}
+		})
+	}
+}
+
+func TestUnmarshalLikeEncodingJSON(t *testing.T) {
+	type target struct {
+		Alpha string `json:"alpha"`
+		Beta  int
+		Gamma *int
+		Delta []int
+	}
+	seven := 7
+	tests := []struct {
+		name string
+		in   string
+		init target
+		want target
+	}{
+		{"case-insensitive names", `{"ALPHA":"a","beta":2}`, target{}, target{Alpha: "a", Beta: 2}},
+		{"unknown fields ignored", `{"alpha":"a","omega":[1,2]}`, target{}, target{Alpha: "a"}},
+		{"null leaves scalars", `{"alpha":null,"Beta":null}`, target{Alpha: "x", Beta: 1}, target{Alpha: "x", Beta: 1}},
+		{"null clears pointers and slices", `{"Gamma":null,"Delta":null}`, target{Gamma: &seven, Delta: []int{1}}, target{}},
+		{"arrays replace slices", `{"Delta":[4,5]}`, target{Delta: []int{1, 2, 3}}, target{Delta: []int{4, 5}}},
+		{"integral floats into ints", `{"Beta":3.0}`, target{}, target{Beta: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := FromJSON([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("from json: %v", err)
+			}
+			got := tt.init
+			if err := Unmarshal(doc, &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalTypeErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		out any
+	}{
+		{`"x"`, new(int)},
+		{`1.5`, new(int)},
+		{`-1`, new(uint)},
+		{`300`, new(uint8)},
+		{`1e20`, new(uint64)},
+		{`{"a":1}`, new([]int)},
+		{`[1]`, new(map[string]int)},
+		{`true`, new(string)},
+	}
+	for _, tt := range tests {
+		doc, err := FromJSON([]byte(tt.in))
+		if err != nil {
+			t.Fatalf("from json %s: %v", tt.in, err)
+		}
+		if err := Unmarshal(doc, tt.out); err == nil {
+			t.Fatalf("unmarshal %s into %T: expected error", tt.in, tt.out)
+		}
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
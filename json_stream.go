@@ -0,0 +1,609 @@
+package tron
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxJSONStreamDepth bounds nesting in JSONDecoder input.
+const maxJSONStreamDepth = 10000
+
+// DuplicateKeys selects how repeated keys in a JSON object are handled.
+type DuplicateKeys uint8
+
+const (
+	// DuplicateKeysLast keeps the last value for a key, as FromJSON does.
+	DuplicateKeysLast DuplicateKeys = iota
+	// DuplicateKeysFirst keeps the first value for a key.
+	DuplicateKeysFirst
+	// DuplicateKeysError rejects the input.
+	DuplicateKeysError
+)
+
+// NonFinite selects how NaN and infinite numbers are handled.
+type NonFinite uint8
+
+const (
+	// NonFiniteError rejects the NaN, Infinity and -Infinity literals and
+	// numbers too large for an f64, as FromJSON does.
+	NonFiniteError NonFinite = iota
+	// NonFiniteFloat accepts the literals and stores them, and numbers too
+	// large for an f64, as f64 NaN or ±Inf.
+	NonFiniteFloat
+	// NonFiniteNil accepts the literals and stores them, and numbers too
+	// large for an f64, as nil.
+	NonFiniteNil
+)
+
+// JSONReadOptions controls FromJSONWithOptions and
+// NewJSONDecoderWithOptions. The zero value decodes like FromJSON.
+type JSONReadOptions struct {
+	DuplicateKeys DuplicateKeys
+	// MaxDepth bounds the nesting of arrays and objects. Zero means 10000.
+	MaxDepth int
+	// MaxSize bounds the JSON text of a value in bytes, and MaxKeys the
+	// number of object keys in it. Zero means no limit.
+	MaxSize int64
+	MaxKeys int
+	// BigInts handles integers outside the i64 range.
+	BigInts   IntOverflow
+	NonFinite NonFinite
+	// BinaryPrefix marks strings holding base64 that are stored as bin.
+	// Empty means "b64:". NoBinaryPrefix stores every string as txt.
+	BinaryPrefix   string
+	NoBinaryPrefix bool
+	// Dedup stores identical nodes once, as Builder.SetDedup does.
+	Dedup bool
+}
+
+// FromJSONWithOptions parses a single JSON value and returns a TRON
+// document, applying the limits and policies in opts. It reads the input
+// with the same tokenizer as JSONDecoder, so limits are checked before the
+// whole input has been parsed.
+func FromJSONWithOptions(data []byte, opts JSONReadOptions) ([]byte, error) {
+	d := NewJSONDecoderWithOptions(bytes.NewReader(data), opts)
+	doc, err := d.Decode()
+	if err == io.EOF {
+		return nil, fmt.Errorf("json input is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c, err := d.skipSpace(); err != io.EOF {
+		if err != nil {
+			return nil, err
+		}
+		return nil, d.syntaxError("invalid character %q after top-level value", c)
+	}
+	return doc, nil
+}
+
+// JSONDecoder reads JSON values from a stream and encodes each as a TRON document.
+// Input is tokenized incrementally and nodes are written as each array or
+// object closes, so the JSON text is never held in memory as a whole.
+// Values may be separated by any whitespace, which makes NDJSON input yield
+// one document per line. Strings and numbers map to TRON values as in FromJSON.
+type JSONDecoder struct {
+	r         *bufio.Reader
+	builder   *Builder
+	workspace *encodeWorkspace
+	scratch   []byte
+	offset    int64
+	opts      JSONReadOptions
+	prefix    string
+	maxDepth  int
+	// limit is the offset the current value may not pass, or zero; keys
+	// counts the object keys read for it.
+	limit int64
+	keys  int
+}
+
+// NewJSONDecoder returns a decoder that reads from r.
+func NewJSONDecoder(r io.Reader) *JSONDecoder {
+	return NewJSONDecoderWithOptions(r, JSONReadOptions{})
+}
+
+// NewJSONDecoderWithOptions returns a decoder that reads from r and applies
+// opts to each value, as FromJSONWithOptions does.
+func NewJSONDecoderWithOptions(r io.Reader, opts JSONReadOptions) *JSONDecoder {
+	d := &JSONDecoder{
+		r:         bufio.NewReaderSize(r, 64<<10),
+		builder:   NewBuilder(),
+		workspace: newEncodeWorkspace(),
+		opts:      opts,
+		prefix:    opts.BinaryPrefix,
+		maxDepth:  opts.MaxDepth,
+	}
+	if d.prefix == "" {
+		d.prefix = "b64:"
+	}
+	if opts.NoBinaryPrefix {
+		d.prefix = ""
+	}
+	if d.maxDepth <= 0 {
+		d.maxDepth = maxJSONStreamDepth
+	}
+	d.workspace.dedup = opts.Dedup
+	return d
+}
+
+// Decode reads the next JSON value and returns it as a TRON document.
+// It returns io.EOF when the input holds no further values.
+func (d *JSONDecoder) Decode() ([]byte, error) {
+	c, err := d.skipSpace()
+	if err != nil {
+		return nil, err
+	}
+	d.builder.Reset()
+	d.keys = 0
+	if d.opts.MaxSize > 0 {
+		d.limit = d.offset - 1 + d.opts.MaxSize
+	}
+	val, err := d.value(c, 0)
+	d.limit = 0
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if err := d.endValue(); err != nil {
+		return nil, err
+	}
+	switch val.Type {
+	case TypeArr, TypeMap:
+		return d.builder.BytesWithTrailer(val.Offset, 0), nil
+	default:
+		return EncodeScalarDocument(val)
+	}
+}
+
+// InputOffset returns the number of bytes consumed from the input so far.
+func (d *JSONDecoder) InputOffset() int64 {
+	return d.offset
+}
+
+func (d *JSONDecoder) readByte() (byte, error) {
+	if d.limit > 0 && d.offset >= d.limit {
+		return 0, d.syntaxError("value exceeds max size of %d bytes", d.opts.MaxSize)
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	d.offset++
+	return c, nil
+}
+
+func (d *JSONDecoder) unreadByte() {
+	_ = d.r.UnreadByte()
+	d.offset--
+}
+
+func (d *JSONDecoder) skipSpace() (byte, error) {
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		return c, nil
+	}
+}
+
+// endValue checks that a top-level value is followed by whitespace or EOF.
+func (d *JSONDecoder) endValue() error {
+	c, err := d.readByte()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	switch c {
+	case ' ', '\t', '\n', '\r':
+		return nil
+	}
+	d.unreadByte()
+	return d.syntaxError("invalid character %q after top-level value", c)
+}
+
+func (d *JSONDecoder) syntaxError(format string, args ...any) error {
+	return fmt.Errorf("json: "+format+" at offset %d", append(args, d.offset)...)
+}
+
+func (d *JSONDecoder) value(c byte, depth int) (Value, error) {
+	switch c {
+	case '{':
+		return d.object(depth + 1)
+	case '[':
+		return d.array(depth + 1)
+	case '"':
+		b, err := d.stringBytes()
+		if err != nil {
+			return Value{}, err
+		}
+		if d.prefix != "" && bytes.HasPrefix(b, []byte(d.prefix)) {
+			if decoded, err := base64.StdEncoding.DecodeString(string(b[len(d.prefix):])); err == nil {
+				return Value{Type: TypeBin, Bytes: decoded}, nil
+			}
+		}
+		return Value{Type: TypeTxt, Bytes: append([]byte{}, b...)}, nil
+	case 't':
+		return Value{Type: TypeBit, Bool: true}, d.literal("rue")
+	case 'f':
+		return Value{Type: TypeBit, Bool: false}, d.literal("alse")
+	case 'n':
+		return Value{Type: TypeNil}, d.literal("ull")
+	case 'N':
+		if d.opts.NonFinite != NonFiniteError {
+			return d.nonFinite(math.NaN()), d.literal("aN")
+		}
+	case 'I':
+		if d.opts.NonFinite != NonFiniteError {
+			return d.nonFinite(math.Inf(1)), d.literal("nfinity")
+		}
+	case '-':
+		if next, err := d.r.Peek(1); err == nil && next[0] == 'I' && d.opts.NonFinite != NonFiniteError {
+			_, _ = d.readByte()
+			return d.nonFinite(math.Inf(-1)), d.literal("nfinity")
+		}
+		return d.number(c)
+	default:
+		if c >= '0' && c <= '9' {
+			return d.number(c)
+		}
+	}
+	return Value{}, d.syntaxError("invalid character %q looking for beginning of value", c)
+}
+
+func (d *JSONDecoder) nonFinite(f float64) Value {
+	if d.opts.NonFinite == NonFiniteNil {
+		return Value{Type: TypeNil}
+	}
+	return Value{Type: TypeF64, F64: f}
+}
+
+func (d *JSONDecoder) literal(rest string) error {
+	for i := 0; i < len(rest); i++ {
+		c, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		if c != rest[i] {
+			return d.syntaxError("invalid character %q in literal", c)
+		}
+	}
+	return nil
+}
+
+func (d *JSONDecoder) object(depth int) (Value, error) {
+	if depth > d.maxDepth {
+		return Value{}, d.syntaxError("exceeded max depth")
+	}
+	mb := newMapBuilderWithWorkspace(d.workspace)
+	c, err := d.skipSpace()
+	if err != nil {
+		return Value{}, err
+	}
+	if c != '}' {
+		for {
+			if c != '"' {
+				return Value{}, d.syntaxError("invalid character %q looking for object key", c)
+			}
+			key, err := d.stringBytes()
+			if err != nil {
+				return Value{}, err
+			}
+			key = append([]byte{}, key...)
+			d.keys++
+			if d.opts.MaxKeys > 0 && d.keys > d.opts.MaxKeys {
+				return Value{}, d.syntaxError("exceeded max key count of %d", d.opts.MaxKeys)
+			}
+			dup := d.opts.DuplicateKeys != DuplicateKeysLast && mb.has(key)
+			if dup && d.opts.DuplicateKeys == DuplicateKeysError {
+				return Value{}, d.syntaxError("duplicate key %q", key)
+			}
+			if c, err = d.skipSpace(); err != nil {
+				return Value{}, err
+			}
+			if c != ':' {
+				return Value{}, d.syntaxError("invalid character %q after object key", c)
+			}
+			if c, err = d.skipSpace(); err != nil {
+				return Value{}, err
+			}
+			val, err := d.value(c, depth)
+			if err != nil {
+				return Value{}, err
+			}
+			if !dup {
+				mb.Set(key, val)
+			}
+			if c, err = d.skipSpace(); err != nil {
+				return Value{}, err
+			}
+			if c == '}' {
+				break
+			}
+			if c != ',' {
+				return Value{}, d.syntaxError("invalid character %q after object value", c)
+			}
+			if c, err = d.skipSpace(); err != nil {
+				return Value{}, err
+			}
+		}
+	}
+	off, err := mb.Build(d.builder)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeMap, Offset: off}, nil
+}
+
+func (d *JSONDecoder) array(depth int) (Value, error) {
+	if depth > d.maxDepth {
+		return Value{}, d.syntaxError("exceeded max depth")
+	}
+	ab := newArrayBuilderWithWorkspace(d.workspace)
+	c, err := d.skipSpace()
+	if err != nil {
+		return Value{}, err
+	}
+	if c != ']' {
+		for {
+			val, err := d.value(c, depth)
+			if err != nil {
+				return Value{}, err
+			}
+			ab.Append(val)
+			if c, err = d.skipSpace(); err != nil {
+				return Value{}, err
+			}
+			if c == ']' {
+				break
+			}
+			if c != ',' {
+				return Value{}, d.syntaxError("invalid character %q after array element", c)
+			}
+			if c, err = d.skipSpace(); err != nil {
+				return Value{}, err
+			}
+		}
+	}
+	off, err := ab.Build(d.builder)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeArr, Offset: off}, nil
+}
+
+// stringBytes reads a string body after the opening quote. The result aliases
+// the decoder's scratch buffer.
+func (d *JSONDecoder) stringBytes() ([]byte, error) {
+	out := d.scratch[:0]
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c == '"':
+			d.scratch = out
+			if !utf8.Valid(out) {
+				return nil, d.syntaxError("invalid UTF-8 in string")
+			}
+			return out, nil
+		case c < 0x20:
+			return nil, d.syntaxError("invalid control character %q in string", c)
+		case c != '\\':
+			out = append(out, c)
+			continue
+		}
+		c, err = d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case '"', '\\', '/':
+			out = append(out, c)
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, err := d.hexRune()
+			if err != nil {
+				return nil, err
+			}
+			if utf16.IsSurrogate(r) {
+				r = d.surrogatePair(r)
+			}
+			out = utf8.AppendRune(out, r)
+		default:
+			return nil, d.syntaxError("invalid escape %q in string", c)
+		}
+	}
+}
+
+// surrogatePair completes a UTF-16 surrogate pair, returning U+FFFD when the
+// low half is missing, as encoding/json does.
+func (d *JSONDecoder) surrogatePair(high rune) rune {
+	if next, err := d.r.Peek(2); err != nil || next[0] != '\\' || next[1] != 'u' {
+		return utf8.RuneError
+	}
+	next, err := d.r.Peek(6)
+	if err != nil {
+		return utf8.RuneError
+	}
+	low, ok := parseHexRune(next[2:6])
+	if !ok {
+		return utf8.RuneError
+	}
+	combined := utf16.DecodeRune(high, low)
+	if combined == utf8.RuneError {
+		return utf8.RuneError
+	}
+	_, _ = d.r.Discard(6)
+	d.offset += 6
+	return combined
+}
+
+func (d *JSONDecoder) hexRune() (rune, error) {
+	var buf [4]byte
+	for i := range buf {
+		c, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		buf[i] = c
+	}
+	r, ok := parseHexRune(buf[:])
+	if !ok {
+		return 0, d.syntaxError("invalid \\u escape %q", buf[:])
+	}
+	return r, nil
+}
+
+func parseHexRune(b []byte) (rune, bool) {
+	var r rune
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+func (d *JSONDecoder) number(first byte) (Value, error) {
+	out := append(d.scratch[:0], first)
+	for {
+		next, err := d.r.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Value{}, err
+		}
+		c := next[0]
+		if !((c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-') {
+			break
+		}
+		if _, err := d.readByte(); err != nil {
+			return Value{}, err
+		}
+		out = append(out, c)
+	}
+	d.scratch = out
+	if !validJSONNumber(out) {
+		return Value{}, d.syntaxError("invalid number %q", out)
+	}
+	return d.numberValue(out)
+}
+
+// numberValue converts a validated JSON number using the same rules as
+// FromJSON: integers become I64, unsigned overflow and fractions become F64,
+// and integral floats within range become I64. Integers outside the i64
+// range and numbers outside the f64 range follow the decoder options.
+func (d *JSONDecoder) numberValue(b []byte) (Value, error) {
+	s := string(b)
+	isInt := true
+	for _, c := range b {
+		if c == '.' || c == 'e' || c == 'E' {
+			isInt = false
+			break
+		}
+	}
+	if isInt {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return Value{Type: TypeI64, I64: i}, nil
+		}
+		switch d.opts.BigInts {
+		case IntOverflowError:
+			return Value{}, d.syntaxError("integer %s overflows int64", s)
+		case IntOverflowText:
+			return Value{Type: TypeTxt, Bytes: []byte(s)}, nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return Value{Type: TypeF64, F64: float64(u)}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		if math.IsInf(f, 0) && d.opts.NonFinite != NonFiniteError {
+			return d.nonFinite(f), nil
+		}
+		return Value{}, fmt.Errorf("json: invalid number %q: %w", s, err)
+	}
+	if f >= math.MinInt64 && f <= math.MaxInt64 && math.Trunc(f) == f {
+		return Value{Type: TypeI64, I64: int64(f)}, nil
+	}
+	return Value{Type: TypeF64, F64: f}, nil
+}
+
+// validJSONNumber reports whether b matches the JSON number grammar.
+func validJSONNumber(b []byte) bool {
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(b) && b[i] == '0':
+		i++
+	case i < len(b) && b[i] >= '1' && b[i] <= '9':
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+	default:
+		return false
+	}
+	if i < len(b) && b[i] == '.' {
+		i++
+		start := i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		start := i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	return i == len(b)
+}
@@ -0,0 +1,328 @@
+package tron
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestJSONReadOptionsDuplicateKeys(t *testing.T) {
+	input := []byte(`{"a":1,"b":2,"a":3}`)
+	tests := []struct {
+		policy DuplicateKeys
+		want   int64
+	}{
+		{DuplicateKeysLast, 3},
+		{DuplicateKeysFirst, 1},
+	}
+	for _, tt := range tests {
+		doc, err := FromJSONWithOptions(input, JSONReadOptions{DuplicateKeys: tt.policy})
+		if err != nil {
+			t.Fatalf("policy %d: %v", tt.policy, err)
+		}
+		c := NewCursor(doc)
+		if a := c.Key("a").Int64(); a != tt.want || c.Len() != 2 || c.Err() != nil {
+			t.Fatalf("policy %d: a=%d len=%d err=%v, want a=%d", tt.policy, a, c.Len(), c.Err(), tt.want)
+		}
+	}
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{DuplicateKeys: DuplicateKeysError}); err == nil {
+		t.Fatalf("DuplicateKeysError accepted repeated key")
+	}
+	// Keys repeated in sibling objects are not duplicates.
+	if _, err := FromJSONWithOptions([]byte(`[{"a":1},{"a":2}]`), JSONReadOptions{DuplicateKeys: DuplicateKeysError}); err != nil {
+		t.Fatalf("sibling objects: %v", err)
+	}
+	// Past the builder's index threshold lookups go through the index.
+	var sb strings.Builder
+	sb.WriteString(`{`)
+	for i := range 3 * mapBuilderIndexMin {
+		sb.WriteString(`"k` + string(rune('a'+i%26)) + string(rune('a'+i/26)) + `":0,`)
+	}
+	sb.WriteString(`"kaa":1}`)
+	if _, err := FromJSONWithOptions([]byte(sb.String()), JSONReadOptions{DuplicateKeys: DuplicateKeysError}); err == nil {
+		t.Fatalf("DuplicateKeysError accepted repeated key in a large object")
+	}
+	doc, err := FromJSONWithOptions([]byte(sb.String()), JSONReadOptions{DuplicateKeys: DuplicateKeysFirst})
+	if err != nil {
+		t.Fatalf("large object: %v", err)
+	}
+	if c := NewCursor(doc); c.Key("kaa").Int64() != 0 || c.Len() != 3*mapBuilderIndexMin {
+		t.Fatalf("large object: kaa=%d len=%d", c.Key("kaa").Int64(), c.Len())
+	}
+}
+
+func TestJSONReadOptionsBigInts(t *testing.T) {
+	input := []byte(`[18446744073709551616,-9223372036854775809,9223372036854775807]`)
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{BigInts: IntOverflowError}); err == nil {
+		t.Fatalf("IntOverflowError accepted big integer")
+	}
+	doc, err := FromJSONWithOptions(input, JSONReadOptions{BigInts: IntOverflowFloat})
+	if err != nil {
+		t.Fatalf("float: %v", err)
+	}
+	c := NewCursor(doc)
+	if c.Index(0).Float64() != 1<<64 || c.Index(1).Float64() != -(1<<63) || c.Index(2).Int64() != math.MaxInt64 || c.Err() != nil {
+		t.Fatalf("float: %v %v %v %v", c.Index(0).Value(), c.Index(1).Value(), c.Index(2).Value(), c.Err())
+	}
+	doc, err = FromJSONWithOptions(input, JSONReadOptions{BigInts: IntOverflowText})
+	if err != nil {
+		t.Fatalf("text: %v", err)
+	}
+	c = NewCursor(doc)
+	if c.Index(0).Text() != "18446744073709551616" || c.Index(1).Text() != "-9223372036854775809" || c.Index(2).Int64() != math.MaxInt64 || c.Err() != nil {
+		t.Fatalf("text: %v %v %v %v", c.Index(0).Value(), c.Index(1).Value(), c.Index(2).Value(), c.Err())
+	}
+}
+
+func TestJSONReadOptionsNonFinite(t *testing.T) {
+	input := []byte(`[NaN,Infinity,-Infinity,1e400]`)
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{}); err == nil {
+		t.Fatalf("NonFiniteError accepted NaN")
+	}
+	if _, err := FromJSONWithOptions([]byte(`1e400`), JSONReadOptions{}); err == nil {
+		t.Fatalf("NonFiniteError accepted 1e400")
+	}
+	doc, err := FromJSONWithOptions(input, JSONReadOptions{NonFinite: NonFiniteFloat})
+	if err != nil {
+		t.Fatalf("float: %v", err)
+	}
+	c := NewCursor(doc)
+	if !math.IsNaN(c.Index(0).Float64()) || !math.IsInf(c.Index(1).Float64(), 1) || !math.IsInf(c.Index(2).Float64(), -1) || !math.IsInf(c.Index(3).Float64(), 1) || c.Err() != nil {
+		t.Fatalf("float: %v", c.Err())
+	}
+	doc, err = FromJSONWithOptions(input, JSONReadOptions{NonFinite: NonFiniteNil})
+	if err != nil {
+		t.Fatalf("nil: %v", err)
+	}
+	c = NewCursor(doc)
+	for i := range 4 {
+		if typ := c.Index(i).Type(); typ != TypeNil {
+			t.Fatalf("nil: index %d has type %v", i, typ)
+		}
+	}
+	if _, err := FromJSONWithOptions([]byte(`[Nan]`), JSONReadOptions{NonFinite: NonFiniteFloat}); err == nil {
+		t.Fatalf("accepted misspelled NaN")
+	}
+}
+
+func TestJSONReadOptionsBinaryPrefix(t *testing.T) {
+	input := []byte(`["b64:AAEC","bin:AAEC","b64:not base64!"]`)
+	tests := []struct {
+		name  string
+		opts  JSONReadOptions
+		types []ValueType
+	}{
+		{"default", JSONReadOptions{}, []ValueType{TypeBin, TypeTxt, TypeTxt}},
+		{"custom", JSONReadOptions{BinaryPrefix: "bin:"}, []ValueType{TypeTxt, TypeBin, TypeTxt}},
+		{"none", JSONReadOptions{NoBinaryPrefix: true}, []ValueType{TypeTxt, TypeTxt, TypeTxt}},
+	}
+	for _, tt := range tests {
+		doc, err := FromJSONWithOptions(input, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		c := NewCursor(doc)
+		for i, want := range tt.types {
+			if got := c.Index(i).Type(); got != want {
+				t.Fatalf("%s: index %d has type %v, want %v", tt.name, i, got, want)
+			}
+			if want == TypeBin && string(c.Index(i).Bytes()) != "\x00\x01\x02" {
+				t.Fatalf("%s: index %d holds %q", tt.name, i, c.Index(i).Bytes())
+			}
+		}
+	}
+}
+
+func TestJSONReadOptionsMaxSize(t *testing.T) {
+	input := []byte(`{"a":[1,2,3],"b":"text"}`)
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{MaxSize: int64(len(input))}); err != nil {
+		t.Fatalf("exact size: %v", err)
+	}
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{MaxSize: int64(len(input) - 1)}); err == nil {
+		t.Fatalf("accepted input over MaxSize")
+	}
+	// A number ending exactly at the limit must not trip it.
+	if _, err := FromJSONWithOptions([]byte(`12345`), JSONReadOptions{MaxSize: 5}); err != nil {
+		t.Fatalf("number at limit: %v", err)
+	}
+	// The limit applies to each value a decoder reads.
+	dec := NewJSONDecoderWithOptions(strings.NewReader(`[1,2] [3,4] [5,6,7,8,9]`), JSONReadOptions{MaxSize: 6})
+	for i := range 2 {
+		if _, err := dec.Decode(); err != nil {
+			t.Fatalf("value %d: %v", i, err)
+		}
+	}
+	if _, err := dec.Decode(); err == nil {
+		t.Fatalf("accepted third value over MaxSize")
+	}
+}
+
+func TestJSONReadOptionsMaxKeys(t *testing.T) {
+	input := []byte(`{"a":{"b":1,"c":2},"d":[{"e":3}]}`)
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{MaxKeys: 5}); err != nil {
+		t.Fatalf("exact keys: %v", err)
+	}
+	if _, err := FromJSONWithOptions(input, JSONReadOptions{MaxKeys: 4}); err == nil {
+		t.Fatalf("accepted input over MaxKeys")
+	}
+}
+
+func TestJSONReadOptionsMaxDepth(t *testing.T) {
+	nested := func(n int) []byte {
+		return []byte(strings.Repeat(`[`, n) + strings.Repeat(`]`, n))
+	}
+	if _, err := FromJSONWithOptions(nested(3), JSONReadOptions{MaxDepth: 3}); err != nil {
+		t.Fatalf("depth 3: %v", err)
+	}
+	if _, err := FromJSONWithOptions(nested(4), JSONReadOptions{MaxDepth: 3}); err == nil {
+		t.Fatalf("accepted depth 4 with MaxDepth 3")
+	}
+	if _, err := FromJSONWithOptions([]byte(`{"a":{"b":{"c":{}}}}`), JSONReadOptions{MaxDepth: 3}); err == nil {
+		t.Fatalf("accepted object depth 4 with MaxDepth 3")
+	}
+	if _, err := FromJSONWithOptions(nested(maxJSONStreamDepth+1), JSONReadOptions{}); err == nil {
+		t.Fatalf("accepted depth over the default limit")
+	}
+}
+
+// decodeAll reads every value from dec, checking that the stream ends with
+// io.EOF and stays there.
+func decodeAll(t *testing.T, dec *JSONDecoder) [][]byte {
+	t.Helper()
+	var docs [][]byte
+	for {
+		doc, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("value %d: %v", len(docs), err)
+		}
+		docs = append(docs, doc)
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Fatalf("decode after EOF: %v", err)
+	}
+	return docs
+}
+
+func TestJSONDecoderStream(t *testing.T) {
+	big := `"` + strings.Repeat("x", 100<<10) + `"`
+	want := []string{
+		`{"id":1,"tags":["a","b"]}`,
+		`{"id":2,"nested":{"deep":[1,{"x":null}]}}`,
+		`[]`,
+		`"text"`,
+		`42`,
+		`-1.5`,
+		`true`,
+		`null`,
+		`{}`,
+		big,
+		`{"id":3}`,
+	}
+	inputs := map[string]string{
+		"ndjson": strings.Join(want, "\n") + "\n",
+		"crlf":   "\r\n" + strings.Join(want, "\r\n\r\n"),
+		"spaces": " \t" + strings.Join(want, " \t ") + "\n\n  ",
+	}
+	for name, input := range inputs {
+		for _, oneByte := range []bool{false, true} {
+			var r io.Reader = strings.NewReader(input)
+			if oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			dec := NewJSONDecoder(r)
+			docs := decodeAll(t, dec)
+			if len(docs) != len(want) {
+				t.Fatalf("%s: decoded %d values, want %d", name, len(docs), len(want))
+			}
+			// Each document is independent of the decoder's buffers.
+			for i, doc := range docs {
+				if err := Verify(doc, VerifyLimits{}); err != nil {
+					t.Fatalf("%s: value %d: verify: %v", name, i, err)
+				}
+				assertDocEqual(t, doc, want[i])
+			}
+			if dec.InputOffset() != int64(len(input)) {
+				t.Fatalf("%s: input offset %d, want %d", name, dec.InputOffset(), len(input))
+			}
+		}
+	}
+	for _, input := range []string{"", " ", "\n\r\n\t"} {
+		if docs := decodeAll(t, NewJSONDecoder(strings.NewReader(input))); len(docs) != 0 {
+			t.Fatalf("%q: decoded %d values", input, len(docs))
+		}
+	}
+}
+
+func TestJSONDecoderStreamErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		good  int
+	}{
+		{`[1][2]`, 0},
+		{`{"a":1}{"b":2}`, 0},
+		{`1 2x`, 1},
+		{`"a""b"`, 0},
+		{"{\"a\":1}\n{\"a\":", 1},
+		{"[1]\n[2,", 1},
+		{"\"open", 0},
+		{`{"a" 1}`, 0},
+		{"[1]\n]", 1},
+	}
+	for _, tt := range tests {
+		dec := NewJSONDecoder(strings.NewReader(tt.input))
+		for i := range tt.good {
+			if _, err := dec.Decode(); err != nil {
+				t.Fatalf("%q: value %d: %v", tt.input, i, err)
+			}
+		}
+		_, err := dec.Decode()
+		if err == nil || err == io.EOF {
+			t.Fatalf("%q: value %d: err = %v, want a syntax error", tt.input, tt.good, err)
+		}
+	}
+	_, err := NewJSONDecoder(strings.NewReader(`{"a":[1,2`)).Decode()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated value: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	readErr := errors.New("read failed")
+	_, err = NewJSONDecoder(io.MultiReader(strings.NewReader(`[1,`), iotest.ErrReader(readErr))).Decode()
+	if !errors.Is(err, readErr) {
+		t.Fatalf("reader error: err = %v, want %v", err, readErr)
+	}
+}
+
+func TestJSONDecoderDepth(t *testing.T) {
+	arrays := func(n int) string {
+		return strings.Repeat(`[`, n) + strings.Repeat(`]`, n)
+	}
+	objects := func(n int) string {
+		return strings.Repeat(`{"a":`, n-1) + `{}` + strings.Repeat(`}`, n-1)
+	}
+	for name, nested := range map[string]func(int) string{"arrays": arrays, "objects": objects} {
+		docs := decodeAll(t, NewJSONDecoder(strings.NewReader(nested(maxJSONStreamDepth))))
+		if len(docs) != 1 {
+			t.Fatalf("%s at the default limit: decoded %d values", name, len(docs))
+		}
+		if _, err := NewJSONDecoder(strings.NewReader(nested(maxJSONStreamDepth + 1))).Decode(); err == nil {
+			t.Fatalf("%s over the default limit: accepted", name)
+		}
+	}
+	// Far deeper input fails at the limit instead of exhausting the stack.
+	if _, err := NewJSONDecoder(strings.NewReader(strings.Repeat(`[`, 1<<20))).Decode(); err == nil {
+		t.Fatalf("accepted unterminated deep input")
+	}
+	// MaxDepth applies to each value of the stream in turn.
+	dec := NewJSONDecoderWithOptions(strings.NewReader(arrays(2)+"\n"+arrays(3)+"\n"+arrays(1)), JSONReadOptions{MaxDepth: 2})
+	if _, err := dec.Decode(); err != nil {
+		t.Fatalf("depth 2: %v", err)
+	}
+	if _, err := dec.Decode(); err == nil {
+		t.Fatalf("accepted depth 3 with MaxDepth 2")
+	}
+}
@@ -0,0 +1,327 @@
+package tron
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// BinaryEncoding selects how TypeBin values are rendered as JSON.
+type BinaryEncoding uint8
+
+const (
+	// BinaryB64Prefix writes "b64:" followed by standard base64, which FromJSON maps back to bin.
+	BinaryB64Prefix BinaryEncoding = iota
+	// BinaryBase64 writes standard base64 without a prefix.
+	BinaryBase64
+	// BinaryHex writes lowercase hex.
+	BinaryHex
+	// BinaryError fails when a bin value is encountered.
+	BinaryError
+)
+
+// KeyOrder selects the order in which map keys are written.
+type KeyOrder uint8
+
+const (
+	// KeyOrderStored writes keys in the order the HAMT stores them. TRON does
+	// not record insertion order, so this is the cheapest stable order.
+	KeyOrderStored KeyOrder = iota
+	// KeyOrderSorted writes keys sorted by their bytes.
+	KeyOrderSorted
+)
+
+// JSONWriteOptions controls WriteJSONTo. The zero value writes compact JSON
+// like WriteJSON.
+type JSONWriteOptions struct {
+	// Prefix and Indent behave like the arguments of json.Indent. Output is
+	// compact when both are empty.
+	Prefix string
+	Indent string
+	// EscapeHTML escapes <, >, & and U+2028/U+2029 inside strings.
+	EscapeHTML bool
+	Binary     BinaryEncoding
+	KeyOrder   KeyOrder
+}
+
+// WriteJSONTo writes doc as JSON to w through a buffer, flushing before it
+// returns. It stops at the first error from w.
+func WriteJSONTo(w io.Writer, doc []byte, opts JSONWriteOptions) error {
+	if _, err := DetectDocType(doc); err != nil {
+		return err
+	}
+	tr, err := ParseTrailer(doc)
+	if err != nil {
+		return err
+	}
+	root, err := DecodeValueAt(doc, tr.RootOffset)
+	if err != nil {
+		return err
+	}
+	out := &stickyWriter{w: w}
+	jw := jsonWriter{
+		w:      bufio.NewWriterSize(out, 32<<10),
+		out:    out,
+		doc:    doc,
+		opts:   opts,
+		indent: opts.Prefix != "" || opts.Indent != "",
+	}
+	if err := jw.value(root, 0); err != nil {
+		return err
+	}
+	return jw.w.Flush()
+}
+
+// stickyWriter keeps the first error of the writer under the buffer so the
+// walk can stop as soon as a flush fails rather than at the end.
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *stickyWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(p)
+	s.err = err
+	return n, err
+}
+
+type jsonWriter struct {
+	w      *bufio.Writer
+	out    *stickyWriter
+	doc    []byte
+	opts   JSONWriteOptions
+	indent bool
+}
+
+func (jw *jsonWriter) newline(depth int) {
+	if !jw.indent {
+		return
+	}
+	jw.w.WriteByte('\n')
+	jw.w.WriteString(jw.opts.Prefix)
+	for i := 0; i < depth; i++ {
+		jw.w.WriteString(jw.opts.Indent)
+	}
+}
+
+func (jw *jsonWriter) value(v Value, depth int) error {
+	switch v.Type {
+	case TypeNil:
+		jw.w.WriteString("null")
+	case TypeBit:
+		if v.Bool {
+			jw.w.WriteString("true")
+		} else {
+			jw.w.WriteString("false")
+		}
+	case TypeI64:
+		jw.w.Write(strconv.AppendInt(jw.w.AvailableBuffer(), v.I64, 10))
+	case TypeF64:
+		if math.IsNaN(v.F64) || math.IsInf(v.F64, 0) {
+			return fmt.Errorf("f64 must be finite")
+		}
+		jw.w.Write(strconv.AppendFloat(jw.w.AvailableBuffer(), v.F64, 'g', -1, 64))
+	case TypeTxt:
+		jw.string(v.Bytes)
+	case TypeBin:
+		return jw.binary(v.Bytes)
+	case TypeArr:
+		return jw.array(v.Offset, depth)
+	case TypeMap:
+		return jw.object(v.Offset, depth)
+	default:
+		return fmt.Errorf("unknown value type %d", v.Type)
+	}
+	return nil
+}
+
+func (jw *jsonWriter) binary(b []byte) error {
+	switch jw.opts.Binary {
+	case BinaryB64Prefix:
+		jw.w.WriteString(`"b64:`)
+		jw.writeBase64(b)
+	case BinaryBase64:
+		jw.w.WriteByte('"')
+		jw.writeBase64(b)
+	case BinaryHex:
+		jw.w.WriteByte('"')
+		enc := hex.NewEncoder(jw.w)
+		if _, err := enc.Write(b); err != nil {
+			return err
+		}
+	case BinaryError:
+		return fmt.Errorf("bin value cannot be written as JSON")
+	default:
+		return fmt.Errorf("unknown binary encoding %d", jw.opts.Binary)
+	}
+	jw.w.WriteByte('"')
+	return nil
+}
+
+func (jw *jsonWriter) writeBase64(b []byte) {
+	enc := base64.NewEncoder(base64.StdEncoding, jw.w)
+	enc.Write(b)
+	enc.Close()
+}
+
+func (jw *jsonWriter) array(off uint32, depth int) error {
+	length, err := arrayRootLength(jw.doc, off)
+	if err != nil {
+		return err
+	}
+	if length == 0 {
+		jw.w.WriteString("[]")
+		return nil
+	}
+	jw.w.WriteByte('[')
+	next := uint32(0)
+	writeNulls := func(end uint32) error {
+		for ; next < end; next++ {
+			if jw.out.err != nil {
+				return jw.out.err
+			}
+			if next > 0 {
+				jw.w.WriteByte(',')
+			}
+			jw.newline(depth + 1)
+			jw.w.WriteString("null")
+		}
+		return nil
+	}
+	err = ArrEach(jw.doc, off, func(index uint32, val Value) error {
+		if index >= length {
+			return fmt.Errorf("array index out of range: %d", index)
+		}
+		if err := writeNulls(index); err != nil {
+			return err
+		}
+		if jw.out.err != nil {
+			return jw.out.err
+		}
+		if index > 0 {
+			jw.w.WriteByte(',')
+		}
+		jw.newline(depth + 1)
+		next = index + 1
+		return jw.value(val, depth+1)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeNulls(length); err != nil {
+		return err
+	}
+	jw.newline(depth)
+	jw.w.WriteByte(']')
+	return nil
+}
+
+func (jw *jsonWriter) object(off uint32, depth int) error {
+	first := true
+	writeEntry := func(key []byte, val Value) error {
+		if jw.out.err != nil {
+			return jw.out.err
+		}
+		if first {
+			jw.w.WriteByte('{')
+			first = false
+		} else {
+			jw.w.WriteByte(',')
+		}
+		jw.newline(depth + 1)
+		jw.string(key)
+		jw.w.WriteByte(':')
+		if jw.indent {
+			jw.w.WriteByte(' ')
+		}
+		return jw.value(val, depth+1)
+	}
+	if jw.opts.KeyOrder == KeyOrderSorted {
+		var entries []MapLeafEntry
+		err := MapEach(jw.doc, off, func(key []byte, val Value) error {
+			entries = append(entries, MapLeafEntry{Key: key, Value: val})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+		})
+		for _, e := range entries {
+			if err := writeEntry(e.Key, e.Value); err != nil {
+				return err
+			}
+		}
+	} else if err := MapEach(jw.doc, off, writeEntry); err != nil {
+		return err
+	}
+	if first {
+		jw.w.WriteString("{}")
+		return nil
+	}
+	jw.newline(depth)
+	jw.w.WriteByte('}')
+	return nil
+}
+
+func (jw *jsonWriter) string(b []byte) {
+	w := jw.w
+	w.WriteByte('"')
+	start := 0
+	for i := 0; i < len(b); {
+		c := b[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf &&
+			(!jw.opts.EscapeHTML || (c != '<' && c != '>' && c != '&')) {
+			i++
+			continue
+		}
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(b[i:])
+			if jw.opts.EscapeHTML && (r == '\u2028' || r == '\u2029') {
+				w.Write(b[start:i])
+				w.WriteString(`\u202`)
+				w.WriteByte(hexDigit(byte(r & 0xF)))
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		w.Write(b[start:i])
+		switch c {
+		case '"', '\\':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case '\b':
+			w.WriteString(`\b`)
+		case '\f':
+			w.WriteString(`\f`)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case '\t':
+			w.WriteString(`\t`)
+		default:
+			w.WriteString(`\u00`)
+			w.WriteByte(hexDigit(c >> 4))
+			w.WriteByte(hexDigit(c & 0xF))
+		}
+		i++
+		start = i
+	}
+	w.Write(b[start:])
+	w.WriteByte('"')
+}
@@ -0,0 +1,160 @@
+package tron
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var jsonWriterCases = []string{
+	`null`,
+	`[]`,
+	`{}`,
+	`[1,-2,2.5,0.001,1e+21,"x",true,false,null,[],{}]`,
+	`{"b":1,"a":[1,{"y":[[]],"x":{}}],"c":{"z":[],"y":"<a&b>"}}`,
+	`{"esc":"quote\" back\\ nl\n tab\t cr\r bs\b ff\f ctl\u0001\u001f","sep":"\u2028\u2029","utf8":"héllo 世界"}`,
+	`{"":"","a":{"":[null]}}`,
+}
+
+// unicodeEscape matches \u escapes, whose hex digits WriteJSONTo writes in
+// upper case and encoding/json in lower case.
+var unicodeEscape = regexp.MustCompile(`\\u[0-9A-Fa-f]{4}`)
+
+func lowerEscapes(s string) string {
+	return unicodeEscape.ReplaceAllStringFunc(s, strings.ToLower)
+}
+
+// marshalLike renders the JSON text src the way encoding/json would with the
+// given indentation and HTML escaping.
+func marshalLike(t *testing.T, src, prefix, indent string, escapeHTML bool) string {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unmarshal %s: %v", src, err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent(prefix, indent)
+	enc.SetEscapeHTML(escapeHTML)
+	if err := enc.Encode(v); err != nil {
+		t.Fatalf("encode %s: %v", src, err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func TestWriteJSONToMatchesEncodingJSON(t *testing.T) {
+	layouts := []struct {
+		name           string
+		prefix, indent string
+	}{
+		{"compact", "", ""},
+		{"indent", "", "  "},
+		{"tab", "", "\t"},
+		{"prefix", "> ", "  "},
+		{"prefix only", "//", ""},
+	}
+	for _, src := range jsonWriterCases {
+		doc := mustJSON(t, src)
+		for _, layout := range layouts {
+			for _, escapeHTML := range []bool{false, true} {
+				var buf bytes.Buffer
+				err := WriteJSONTo(&buf, doc, JSONWriteOptions{
+					Prefix:     layout.prefix,
+					Indent:     layout.indent,
+					EscapeHTML: escapeHTML,
+					KeyOrder:   KeyOrderSorted,
+				})
+				if err != nil {
+					t.Fatalf("%s %s: %v", layout.name, src, err)
+				}
+				want := marshalLike(t, src, layout.prefix, layout.indent, escapeHTML)
+				if !escapeHTML {
+					// encoding/json escapes the line separators regardless.
+					want = strings.NewReplacer(`\u2028`, "\u2028", `\u2029`, "\u2029").Replace(want)
+				}
+				if got := lowerEscapes(buf.String()); got != want {
+					t.Fatalf("%s escapeHTML=%v %s:\ngot  %s\nwant %s", layout.name, escapeHTML, src, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWriteJSONToStoredKeyOrder(t *testing.T) {
+	src := `{"b":1,"a":[1,{"y":[[]],"x":{}}],"c":{"z":[],"y":"<a&b>"},"d":{"k1":1,"k2":2,"k3":3}}`
+	doc := mustJSON(t, src)
+	var buf bytes.Buffer
+	if err := WriteJSONTo(&buf, doc, JSONWriteOptions{Indent: " "}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if a, b := marshalLike(t, buf.String(), "", "", false), marshalLike(t, src, "", "", false); a != b {
+		t.Fatalf("stored order changed the value:\ngot  %s\nwant %s", a, b)
+	}
+
+	// The top-level keys appear in the order MapEach visits them.
+	root := mustRoot(t, doc)
+	var keys []string
+	err := MapEach(doc, root.Offset, func(key []byte, _ Value) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("each: %v", err)
+	}
+	dec := json.NewDecoder(&buf)
+	var order []string
+	if _, err := dec.Token(); err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("token: %v", err)
+		}
+		order = append(order, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			t.Fatalf("value: %v", err)
+		}
+	}
+	if strings.Join(order, ",") != strings.Join(keys, ",") {
+		t.Fatalf("key order %v, want %v", order, keys)
+	}
+}
+
+type failingWriter struct {
+	err    error
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, w.err
+}
+
+func TestWriteJSONToStopsOnWriteError(t *testing.T) {
+	// A bin value at the end fails under BinaryError, so reaching it would
+	// mean the walk ran on after the writer failed.
+	var sb strings.Builder
+	sb.WriteString(`{"items":[`)
+	for i := range 20000 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`"some padding to fill the buffer"`)
+	}
+	sb.WriteString(`],"tail":"b64:AAEC"}`)
+	doc := mustJSON(t, sb.String())
+
+	w := &failingWriter{err: errors.New("disk full")}
+	err := WriteJSONTo(w, doc, JSONWriteOptions{Binary: BinaryError, KeyOrder: KeyOrderSorted})
+	if !errors.Is(err, w.err) {
+		t.Fatalf("error = %v, want %v", err, w.err)
+	}
+	if w.writes != 1 {
+		t.Fatalf("writer called %d times after failing", w.writes)
+	}
+}
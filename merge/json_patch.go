@@ -0,0 +1,487 @@
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+// ApplyJSONPatch applies a JSON Patch (RFC 6902) to a target document.
+// The patch is a TRON document or JSON text whose root is an array of
+// operation objects. Operations are applied copy-on-write to a copy of the
+// target, so on any error, including a failing "test" operation, the target
+// is left unchanged and no document is returned.
+func ApplyJSONPatch(target, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, tron.HeaderMagic[:]) {
+		converted, err := tron.FromJSON(patch)
+		if err != nil {
+			return nil, fmt.Errorf("json patch: %w", err)
+		}
+		patch = converted
+	}
+	if _, err := tron.DetectDocType(patch); err != nil {
+		return nil, err
+	}
+	patchTrailer, err := tron.ParseTrailer(patch)
+	if err != nil {
+		return nil, err
+	}
+	patchRoot, err := tron.DecodeValueAt(patch, patchTrailer.RootOffset)
+	if err != nil {
+		return nil, err
+	}
+	if patchRoot.Type != tron.TypeArr {
+		return nil, fmt.Errorf("json patch must be an array of operations")
+	}
+
+	if _, err := tron.DetectDocType(target); err != nil {
+		return nil, err
+	}
+	builder, targetTrailer, err := tron.NewBuilderFromDocument(target)
+	if err != nil {
+		return nil, err
+	}
+	root, err := tron.DecodeValueAt(target, targetTrailer.RootOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	applier := jsonPatchApplier{
+		builder: builder,
+		patch:   patch,
+	}
+	err = tron.ArrEach(patch, patchRoot.Offset, func(index uint32, opVal tron.Value) error {
+		op, err := applier.parseOp(opVal)
+		if err != nil {
+			return fmt.Errorf("json patch operation %d: %w", index, err)
+		}
+		root, err = applier.apply(root, op)
+		if err != nil {
+			return fmt.Errorf("json patch operation %d (%s %q): %w", index, op.op, op.path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rootOff, err := applier.address(root)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BytesWithTrailer(rootOff, targetTrailer.RootOffset), nil
+}
+
+type jsonPatchOp struct {
+	op    string
+	path  string
+	from  string
+	value tron.Value
+}
+
+type jsonPatchApplier struct {
+	builder *tron.Builder
+	patch   []byte
+}
+
+func (a *jsonPatchApplier) parseOp(v tron.Value) (jsonPatchOp, error) {
+	if v.Type != tron.TypeMap {
+		return jsonPatchOp{}, fmt.Errorf("operation must be an object")
+	}
+	var op jsonPatchOp
+	opVal, ok, err := tron.MapGet(a.patch, v.Offset, []byte("op"))
+	if err != nil {
+		return jsonPatchOp{}, err
+	}
+	if !ok || opVal.Type != tron.TypeTxt {
+		return jsonPatchOp{}, fmt.Errorf("missing \"op\" string")
+	}
+	op.op = string(opVal.Bytes)
+	pathVal, ok, err := tron.MapGet(a.patch, v.Offset, []byte("path"))
+	if err != nil {
+		return jsonPatchOp{}, err
+	}
+	if !ok || pathVal.Type != tron.TypeTxt {
+		return jsonPatchOp{}, fmt.Errorf("missing \"path\" string")
+	}
+	op.path = string(pathVal.Bytes)
+	switch op.op {
+	case "add", "replace", "test":
+		val, ok, err := tron.MapGet(a.patch, v.Offset, []byte("value"))
+		if err != nil {
+			return jsonPatchOp{}, err
+		}
+		if !ok {
+			return jsonPatchOp{}, fmt.Errorf("%s requires \"value\"", op.op)
+		}
+		op.value = val
+	case "move", "copy":
+		fromVal, ok, err := tron.MapGet(a.patch, v.Offset, []byte("from"))
+		if err != nil {
+			return jsonPatchOp{}, err
+		}
+		if !ok || fromVal.Type != tron.TypeTxt {
+			return jsonPatchOp{}, fmt.Errorf("%s requires \"from\" string", op.op)
+		}
+		op.from = string(fromVal.Bytes)
+	case "remove":
+	default:
+		return jsonPatchOp{}, fmt.Errorf("unknown op %q", op.op)
+	}
+	return op, nil
+}
+
+func (a *jsonPatchApplier) apply(root tron.Value, op jsonPatchOp) (tron.Value, error) {
+	tokens, err := tron.ParsePointer(op.path)
+	if err != nil {
+		return tron.Value{}, err
+	}
+	switch op.op {
+	case "add":
+		val, err := tron.CloneValueFromDoc(a.patch, op.value, a.builder)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		return a.add(root, tokens, val)
+	case "remove":
+		return a.remove(root, tokens)
+	case "replace":
+		val, err := tron.CloneValueFromDoc(a.patch, op.value, a.builder)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		return a.replace(root, tokens, val)
+	case "move":
+		fromTokens, err := tron.ParsePointer(op.from)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		if op.from == op.path {
+			if _, err := a.get(root, fromTokens); err != nil {
+				return tron.Value{}, err
+			}
+			return root, nil
+		}
+		if strings.HasPrefix(op.path, op.from+"/") {
+			return tron.Value{}, fmt.Errorf("cannot move %q into its own child", op.from)
+		}
+		val, err := a.get(root, fromTokens)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		root, err = a.remove(root, fromTokens)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		return a.add(root, tokens, val)
+	case "copy":
+		fromTokens, err := tron.ParsePointer(op.from)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		val, err := a.get(root, fromTokens)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		return a.add(root, tokens, val)
+	case "test":
+		val, err := a.get(root, tokens)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		equal, err := jsonValuesEqual(a.builder.Buffer(), val, a.patch, op.value)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		if !equal {
+			return tron.Value{}, fmt.Errorf("test failed")
+		}
+		return root, nil
+	default:
+		return tron.Value{}, fmt.Errorf("unknown op %q", op.op)
+	}
+}
+
+// get resolves tokens against cur.
+func (a *jsonPatchApplier) get(cur tron.Value, tokens []string) (tron.Value, error) {
+	for _, tok := range tokens {
+		doc := a.builder.Buffer()
+		switch cur.Type {
+		case tron.TypeMap:
+			val, ok, err := tron.MapGet(doc, cur.Offset, []byte(tok))
+			if err != nil {
+				return tron.Value{}, err
+			}
+			if !ok {
+				return tron.Value{}, fmt.Errorf("member %q not found", tok)
+			}
+			cur = val
+		case tron.TypeArr:
+			length, err := tron.ArrayRootLength(doc, cur.Offset)
+			if err != nil {
+				return tron.Value{}, err
+			}
+			index, err := parseArrayIndex(tok, length, false)
+			if err != nil {
+				return tron.Value{}, err
+			}
+			val, ok, err := tron.ArrGet(doc, cur.Offset, index)
+			if err != nil {
+				return tron.Value{}, err
+			}
+			if !ok {
+				val = tron.Value{Type: tron.TypeNil}
+			}
+			cur = val
+		default:
+			return tron.Value{}, fmt.Errorf("cannot index %s value with %q", cur.Type, tok)
+		}
+	}
+	return cur, nil
+}
+
+// update replaces the container at tokens[:len(tokens)-1] with the result of
+// fn, rewriting every ancestor copy-on-write.
+func (a *jsonPatchApplier) update(cur tron.Value, tokens []string, fn func(parent tron.Value, tok string) (tron.Value, error)) (tron.Value, error) {
+	if len(tokens) == 1 {
+		return fn(cur, tokens[0])
+	}
+	child, err := a.get(cur, tokens[:1])
+	if err != nil {
+		return tron.Value{}, err
+	}
+	newChild, err := a.update(child, tokens[1:], fn)
+	if err != nil {
+		return tron.Value{}, err
+	}
+	return a.set(cur, tokens[0], newChild, false)
+}
+
+func (a *jsonPatchApplier) add(root tron.Value, tokens []string, val tron.Value) (tron.Value, error) {
+	if len(tokens) == 0 {
+		return val, nil
+	}
+	return a.update(root, tokens, func(parent tron.Value, tok string) (tron.Value, error) {
+		return a.set(parent, tok, val, true)
+	})
+}
+
+func (a *jsonPatchApplier) replace(root tron.Value, tokens []string, val tron.Value) (tron.Value, error) {
+	if len(tokens) == 0 {
+		return val, nil
+	}
+	return a.update(root, tokens, func(parent tron.Value, tok string) (tron.Value, error) {
+		if _, err := a.get(parent, []string{tok}); err != nil {
+			return tron.Value{}, err
+		}
+		return a.set(parent, tok, val, false)
+	})
+}
+
+func (a *jsonPatchApplier) remove(root tron.Value, tokens []string) (tron.Value, error) {
+	if len(tokens) == 0 {
+		return tron.Value{}, fmt.Errorf("cannot remove the document root")
+	}
+	return a.update(root, tokens, func(parent tron.Value, tok string) (tron.Value, error) {
+		doc := a.builder.Buffer()
+		switch parent.Type {
+		case tron.TypeMap:
+			off, removed, err := tron.MapDelNode(a.builder, parent.Offset, []byte(tok))
+			if err != nil {
+				return tron.Value{}, err
+			}
+			if !removed {
+				return tron.Value{}, fmt.Errorf("member %q not found", tok)
+			}
+			return tron.Value{Type: tron.TypeMap, Offset: off}, nil
+		case tron.TypeArr:
+			length, err := tron.ArrayRootLength(doc, parent.Offset)
+			if err != nil {
+				return tron.Value{}, err
+			}
+			index, err := parseArrayIndex(tok, length, false)
+			if err != nil {
+				return tron.Value{}, err
+			}
+			return a.splice(parent.Offset, index, 1)
+		default:
+			return tron.Value{}, fmt.Errorf("cannot index %s value with %q", parent.Type, tok)
+		}
+	})
+}
+
+// set stores val under tok in parent. With insert, array tokens insert before
+// the index (or append for "-"); otherwise the index must exist.
+func (a *jsonPatchApplier) set(parent tron.Value, tok string, val tron.Value, insert bool) (tron.Value, error) {
+	doc := a.builder.Buffer()
+	switch parent.Type {
+	case tron.TypeMap:
+		off, _, err := tron.MapSetNode(a.builder, parent.Offset, []byte(tok), val)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		return tron.Value{Type: tron.TypeMap, Offset: off}, nil
+	case tron.TypeArr:
+		length, err := tron.ArrayRootLength(doc, parent.Offset)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		index, err := parseArrayIndex(tok, length, insert)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		if insert && index < length {
+			return a.splice(parent.Offset, index, 0, val)
+		}
+		newLength := length
+		if index == length {
+			newLength++
+		}
+		off, err := tron.ArraySetNode(a.builder, parent.Offset, index, val, newLength)
+		if err != nil {
+			return tron.Value{}, err
+		}
+		return tron.Value{Type: tron.TypeArr, Offset: off}, nil
+	default:
+		return tron.Value{}, fmt.Errorf("cannot index %s value with %q", parent.Type, tok)
+	}
+}
+
+// splice replaces count elements at index in the array at off with values.
+func (a *jsonPatchApplier) splice(off uint32, index, count uint32, values ...tron.Value) (tron.Value, error) {
+	newOff, err := tron.ArraySpliceNode(a.builder, off, index, count, values...)
+	if err != nil {
+		return tron.Value{}, err
+	}
+	return tron.Value{Type: tron.TypeArr, Offset: newOff}, nil
+}
+
+// address returns the offset of v in the builder, appending scalar nodes.
+func (a *jsonPatchApplier) address(v tron.Value) (uint32, error) {
+	if v.Type == tron.TypeArr || v.Type == tron.TypeMap {
+		return v.Offset, nil
+	}
+	enc, err := tron.EncodeValue(v)
+	if err != nil {
+		return 0, err
+	}
+	return a.builder.AppendNode(enc), nil
+}
+
+// parseArrayIndex parses an array reference token and checks it against the
+// array length. With insert, "-" and length itself are accepted and address
+// the end of the array.
+func parseArrayIndex(tok string, length uint32, insert bool) (uint32, error) {
+	index, err := tron.ParsePointerIndex(tok, length)
+	if err != nil {
+		return 0, err
+	}
+	if index < length || (index == length && insert) {
+		return index, nil
+	}
+	if tok == "-" {
+		return 0, fmt.Errorf("array index \"-\" is past the end")
+	}
+	return 0, fmt.Errorf("array index %d out of range", index)
+}
+
+// jsonValuesEqual compares two values with JSON semantics: numbers compare by
+// value regardless of i64/f64 encoding, and map key order is irrelevant.
+func jsonValuesEqual(docA []byte, a tron.Value, docB []byte, b tron.Value) (bool, error) {
+	if a.Type == tron.TypeI64 && b.Type == tron.TypeI64 {
+		return a.I64 == b.I64, nil
+	}
+	if isNumber(a) && isNumber(b) {
+		return numberValue(a) == numberValue(b), nil
+	}
+	if a.Type != b.Type {
+		return false, nil
+	}
+	switch a.Type {
+	case tron.TypeNil:
+		return true, nil
+	case tron.TypeBit:
+		return a.Bool == b.Bool, nil
+	case tron.TypeTxt, tron.TypeBin:
+		return bytes.Equal(a.Bytes, b.Bytes), nil
+	case tron.TypeArr:
+		lenA, err := tron.ArrayRootLength(docA, a.Offset)
+		if err != nil {
+			return false, err
+		}
+		lenB, err := tron.ArrayRootLength(docB, b.Offset)
+		if err != nil {
+			return false, err
+		}
+		if lenA != lenB {
+			return false, nil
+		}
+		for i := uint32(0); i < lenA; i++ {
+			va, okA, err := tron.ArrGet(docA, a.Offset, i)
+			if err != nil {
+				return false, err
+			}
+			vb, okB, err := tron.ArrGet(docB, b.Offset, i)
+			if err != nil {
+				return false, err
+			}
+			if !okA {
+				va = tron.Value{Type: tron.TypeNil}
+			}
+			if !okB {
+				vb = tron.Value{Type: tron.TypeNil}
+			}
+			equal, err := jsonValuesEqual(docA, va, docB, vb)
+			if err != nil || !equal {
+				return false, err
+			}
+		}
+		return true, nil
+	case tron.TypeMap:
+		lenA, err := tron.MapLen(docA, a.Offset)
+		if err != nil {
+			return false, err
+		}
+		lenB, err := tron.MapLen(docB, b.Offset)
+		if err != nil {
+			return false, err
+		}
+		if lenA != lenB {
+			return false, nil
+		}
+		entries, entriesErr := tron.MapRangeErr(docA, a.Offset)
+		for key, va := range entries {
+			vb, ok, err := tron.MapGet(docB, b.Offset, key)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				ok, err = jsonValuesEqual(docA, va, docB, vb)
+				if err != nil {
+					return false, err
+				}
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+		if err := entriesErr(); err != nil {
+			return false, err
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func isNumber(v tron.Value) bool {
+	return v.Type == tron.TypeI64 || v.Type == tron.TypeF64
+}
+
+func numberValue(v tron.Value) float64 {
+	if v.Type == tron.TypeI64 {
+		return float64(v.I64)
+	}
+	return v.F64
+}
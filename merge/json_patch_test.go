@@ -0,0 +1,147 @@
+package merge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+// TestApplyJSONPatchRFC6902 runs the examples from RFC 6902 appendix A.
+func TestApplyJSONPatchRFC6902(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string // empty when the patch must fail
+	}{
+		{"A.1 adding an object member",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"baz":"qux","foo":"bar"}`},
+		{"A.2 adding an array element",
+			`{"foo":["bar","baz"]}`,
+			`[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`},
+		{"A.3 removing an object member",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"remove","path":"/baz"}]`,
+			`{"foo":"bar"}`},
+		{"A.4 removing an array element",
+			`{"foo":["bar","qux","baz"]}`,
+			`[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`},
+		{"A.5 replacing a value",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`},
+		{"A.6 moving a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"A.7 moving an array element",
+			`{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`},
+		{"A.8 testing a value: success",
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{"A.9 testing a value: error",
+			`{"baz":"qux"}`,
+			`[{"op":"test","path":"/baz","value":"bar"}]`,
+			``},
+		{"A.10 adding a nested member object",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`},
+		{"A.11 ignoring unrecognized elements",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			`{"foo":"bar","baz":"qux"}`},
+		{"A.12 adding to a nonexistent target",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			``},
+		{"A.13 invalid JSON patch document",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux","op":"remove"}]`,
+			``},
+		{"A.14 ~ escape ordering",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":10}]`,
+			`{"/":9,"~1":10}`},
+		{"A.15 comparing strings and numbers",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":"10"}]`,
+			``},
+		{"A.16 adding an array value",
+			`{"foo":["bar"]}`,
+			`[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := mustFromJSON(t, tt.target)
+			before := append([]byte{}, target...)
+			got, err := ApplyJSONPatch(target, []byte(tt.patch))
+			if string(target) != string(before) {
+				t.Fatalf("patch modified the target")
+			}
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected error, got %s", mustToJSON(t, got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyJSONPatchTronPatch(t *testing.T) {
+	patch := mustFromJSON(t, `[{"op":"copy","from":"/a","path":"/b"},{"op":"replace","path":"/a/0","value":null}]`)
+	got, err := ApplyJSONPatch(mustFromJSON(t, `{"a":[1,2]}`), patch)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	assertJSON(t, got, `{"a":[null,2],"b":[1,2]}`)
+}
+
+func mustFromJSON(t *testing.T, s string) []byte {
+	t.Helper()
+	doc, err := tron.FromJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("from json %s: %v", s, err)
+	}
+	return doc
+}
+
+func mustToJSON(t *testing.T, doc []byte) string {
+	t.Helper()
+	s, err := tron.ToJSON(doc)
+	if err != nil {
+		t.Fatalf("to json: %v", err)
+	}
+	return s
+}
+
+// assertJSON compares doc with the JSON text want, ignoring key order.
+func assertJSON(t *testing.T, doc []byte, want string) {
+	t.Helper()
+	got := mustToJSON(t, doc)
+	var gotAny, wantAny any
+	if err := json.Unmarshal([]byte(got), &gotAny); err != nil {
+		t.Fatalf("parse %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantAny); err != nil {
+		t.Fatalf("parse %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotAny, wantAny) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,267 @@
+package tron
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergeValue is a value taking part in a three-way merge. Doc holds Value when
+// it is a map or array; Present is false when the key or index is absent.
+type MergeValue struct {
+	Doc     []byte
+	Value   Value
+	Present bool
+}
+
+// Conflict describes a path that ours and theirs both changed from base in
+// different ways. Values refer to their own documents.
+type Conflict struct {
+	Path   string
+	Base   MergeValue
+	Ours   MergeValue
+	Theirs MergeValue
+}
+
+// ConflictResolver picks the merged value for a conflict. Returning a value
+// that is not Present removes the key or index from the result.
+type ConflictResolver func(c Conflict) (MergeValue, error)
+
+// ResolveOurs resolves every conflict in favour of ours.
+func ResolveOurs(c Conflict) (MergeValue, error) {
+	return c.Ours, nil
+}
+
+// ResolveTheirs resolves every conflict in favour of theirs.
+func ResolveTheirs(c Conflict) (MergeValue, error) {
+	return c.Theirs, nil
+}
+
+// Merge3 merges the changes ours and theirs each made to base and returns the
+// merged document with every conflict found, resolved or not.
+//
+// Maps are merged key by key and arrays index by index, recursively. A change
+// made on one side only is kept. Both sides making the same change is not a
+// conflict. Otherwise the paths conflict: equal paths, and also a change on
+// one side inside a value the other side replaced or removed, which is
+// reported once at the outer path. Each conflict is passed to resolve, and a
+// nil resolve keeps ours.
+//
+// The result is built on a copy of ours and its trailer links back to the
+// ours root. Subtrees at the same offset inside the byte prefix a side shares
+// with base, as when both sides were appended to the base buffer, are not
+// walked; see DiffValues.
+func Merge3(base, ours, theirs []byte, resolve ConflictResolver) ([]byte, []Conflict, error) {
+	if resolve == nil {
+		resolve = ResolveOurs
+	}
+	baseRoot, err := documentRoot(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	oursRoot, err := documentRoot(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	theirsRoot, err := documentRoot(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := merger3{
+		base:     base,
+		ours:     ours,
+		theirs:   theirs,
+		resolve:  resolve,
+		oursDiff: make(map[string]Change),
+		handled:  make(map[string]bool),
+	}
+	err = DiffValues(base, baseRoot, ours, oursRoot, func(c Change) error {
+		m.oursDiff[c.Path] = c
+		m.oursPaths = append(m.oursPaths, c.Path)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(m.oursPaths)
+	var theirsDiff []Change
+	err = DiffValues(base, baseRoot, theirs, theirsRoot, func(c Change) error {
+		theirsDiff = append(theirsDiff, c)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := NewDoc(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = doc.Update(func(tx *Txn) error {
+		m.tx = tx
+		for _, c := range theirsDiff {
+			if err := m.apply(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc.Bytes(), m.conflicts, nil
+}
+
+type merger3 struct {
+	base, ours, theirs []byte
+	resolve            ConflictResolver
+	tx                 *Txn
+	// oursDiff indexes the changes from base to ours by path; oursPaths
+	// holds the same paths sorted.
+	oursDiff  map[string]Change
+	oursPaths []string
+	// handled records conflict paths already resolved, so later changes
+	// beneath them are skipped.
+	handled   map[string]bool
+	conflicts []Conflict
+}
+
+// apply merges one change from base to theirs into the result.
+func (m *merger3) apply(c Change) error {
+	if at, ok := m.conflictPath(c.Path); ok {
+		if m.handled[at] {
+			return nil
+		}
+		m.handled[at] = true
+		return m.conflict(at)
+	}
+	if c.Kind == ChangeRemoved {
+		return m.write(c.Path, MergeValue{})
+	}
+	return m.write(c.Path, MergeValue{Doc: m.theirs, Value: c.New, Present: true})
+}
+
+// conflictPath returns the outermost path at which ours also changed path,
+// its ancestors or its descendants.
+func (m *merger3) conflictPath(path string) (string, bool) {
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		if _, ok := m.oursDiff[path[:i]]; ok {
+			return path[:i], true
+		}
+	}
+	if _, ok := m.oursDiff[path]; ok {
+		return path, true
+	}
+	i := sort.SearchStrings(m.oursPaths, path+"/")
+	if i < len(m.oursPaths) && strings.HasPrefix(m.oursPaths[i], path+"/") {
+		return path, true
+	}
+	return "", false
+}
+
+func (m *merger3) conflict(path string) error {
+	c := Conflict{Path: path}
+	var err error
+	if c.Base, err = mergeValueAt(m.base, path); err != nil {
+		return err
+	}
+	if c.Ours, err = mergeValueAt(m.ours, path); err != nil {
+		return err
+	}
+	if c.Theirs, err = mergeValueAt(m.theirs, path); err != nil {
+		return err
+	}
+	if c.Ours.Present == c.Theirs.Present {
+		same := !c.Ours.Present
+		if c.Ours.Present {
+			same, err = Equal(m.ours, c.Ours.Value, m.theirs, c.Theirs.Value)
+			if err != nil {
+				return err
+			}
+		}
+		if same {
+			return nil
+		}
+	}
+	m.conflicts = append(m.conflicts, c)
+	resolved, err := m.resolve(c)
+	if err != nil {
+		return err
+	}
+	return m.write(path, resolved)
+}
+
+func mergeValueAt(doc []byte, path string) (MergeValue, error) {
+	root, err := documentRoot(doc)
+	if err != nil {
+		return MergeValue{}, err
+	}
+	tokens, err := ParsePointer(path)
+	if err != nil {
+		return MergeValue{}, err
+	}
+	val, ok, err := pointerGet(doc, root, tokens)
+	if err != nil {
+		return MergeValue{}, err
+	}
+	return MergeValue{Doc: doc, Value: val, Present: ok}, nil
+}
+
+// write sets or removes path in the result. An array index past the end of
+// the result appends, since ours may have removed elements before it.
+func (m *merger3) write(path string, mv MergeValue) error {
+	tokens, err := ParsePointer(path)
+	if err != nil {
+		return err
+	}
+	builder := m.tx.Builder()
+	root, err := m.tx.Root()
+	if err != nil {
+		return err
+	}
+	if !mv.Present {
+		if len(tokens) == 0 {
+			return fmt.Errorf("cannot remove the document root")
+		}
+		updated, removed, err := pointerDelete(builder, root, tokens)
+		if err != nil || !removed {
+			return err
+		}
+		return m.tx.SetRoot(updated)
+	}
+	val := mv.Value
+	if (val.Type == TypeArr || val.Type == TypeMap) && !sameBuffer(mv.Doc, m.ours) {
+		if val, err = cloneValueFromDoc(mv.Doc, val, builder); err != nil {
+			return err
+		}
+	}
+	if len(tokens) > 0 {
+		parent, ok, err := pointerGet(builder.buf, root, tokens[:len(tokens)-1])
+		if err != nil {
+			return err
+		}
+		if ok && parent.Type == TypeArr {
+			length, err := arrayRootLength(builder.buf, parent.Offset)
+			if err != nil {
+				return err
+			}
+			if index, err := ParsePointerIndex(tokens[len(tokens)-1], length); err == nil && index > length {
+				tokens[len(tokens)-1] = "-"
+			}
+		}
+	}
+	updated, err := pointerSet(builder, root, tokens, val, PointerCreateNone)
+	if err != nil {
+		return err
+	}
+	return m.tx.SetRoot(updated)
+}
+
+// sameBuffer reports whether a and b start at the same address. The result
+// document is a copy of ours with the same offsets, so ours values can be
+// used in it directly.
+func sameBuffer(a, b []byte) bool {
+	return len(a) > 0 && len(b) > 0 && &a[0] == &b[0]
+}
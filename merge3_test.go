@@ -0,0 +1,173 @@
+package tron
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          []string
+	}{
+		{"one-sided edits",
+			`{"a":1,"b":1,"c":{"d":1}}`, `{"a":2,"b":1,"c":{"d":1}}`, `{"a":1,"b":3,"c":{"d":1,"e":2}}`,
+			`{"a":2,"b":3,"c":{"d":1,"e":2}}`, nil},
+		{"one side removes, other untouched",
+			`{"a":1,"b":1}`, `{"b":1}`, `{"a":1,"b":2}`,
+			`{"b":2}`, nil},
+		{"identical edits",
+			`{"a":1,"l":[1]}`, `{"a":2,"l":[1,2],"n":null}`, `{"a":2,"l":[1,2],"n":null}`,
+			`{"a":2,"l":[1,2],"n":null}`, nil},
+		{"identical removals",
+			`{"a":1,"b":2}`, `{"b":2}`, `{"b":2}`,
+			`{"b":2}`, nil},
+		{"both change a key",
+			`{"a":1}`, `{"a":2}`, `{"a":3}`,
+			`{"a":2}`, []string{"/a"}},
+		{"both add a key",
+			`{}`, `{"a":1}`, `{"a":"x"}`,
+			`{"a":1}`, []string{"/a"}},
+		{"ancestor replaced",
+			`{"a":{"b":1,"c":1}}`, `{"a":{"b":2,"c":1}}`, `{"a":"gone"}`,
+			`{"a":{"b":2,"c":1}}`, []string{"/a"}},
+		{"ancestor removed",
+			`{"a":{"b":{"c":1}},"z":0}`, `{"a":{"b":{"c":2}},"z":0}`, `{"z":1}`,
+			`{"a":{"b":{"c":2}},"z":1}`, []string{"/a"}},
+		{"array tail removed on one side",
+			`{"l":[1,2,3,4]}`, `{"l":[1,2]}`, `{"l":[1,2,3,4],"x":1}`,
+			`{"l":[1,2],"x":1}`, nil},
+		{"array tail removed on both sides",
+			`{"l":[1,2,3,4]}`, `{"l":[1,2]}`, `{"l":[1,2]}`,
+			`{"l":[1,2]}`, nil},
+		{"array tail removed against an edit",
+			`{"l":[1,2,3,4]}`, `{"l":[1,2]}`, `{"l":[1,2,3,5]}`,
+			`{"l":[1,2]}`, []string{"/l/3"}},
+		{"array elements edited on each side",
+			`[1,2,3]`, `[9,2,3]`, `[1,2,8]`,
+			`[9,2,8]`, nil},
+		{"scalar roots",
+			`1`, `2`, `1`,
+			`2`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts, err := Merge3(mustJSON(t, tt.base), mustJSON(t, tt.ours), mustJSON(t, tt.theirs), nil)
+			if err != nil {
+				t.Fatalf("merge: %v", err)
+			}
+			if err := Verify(got, VerifyLimits{}); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			assertDocEqual(t, got, tt.want)
+			if len(conflicts) != len(tt.conflicts) {
+				t.Fatalf("got %d conflicts %v, want %v", len(conflicts), conflicts, tt.conflicts)
+			}
+			for i, c := range conflicts {
+				if c.Path != tt.conflicts[i] {
+					t.Fatalf("conflict %d at %q, want %q", i, c.Path, tt.conflicts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMerge3Resolvers(t *testing.T) {
+	base := mustJSON(t, `{"a":1,"b":{"c":1},"d":1}`)
+	ours := mustJSON(t, `{"a":2,"b":{"c":2},"d":1}`)
+	theirs := mustJSON(t, `{"a":3,"d":2}`)
+
+	got, conflicts, err := Merge3(base, ours, theirs, ResolveTheirs)
+	if err != nil {
+		t.Fatalf("theirs: %v", err)
+	}
+	assertDocEqual(t, got, `{"a":3,"d":2}`)
+	if len(conflicts) != 2 {
+		t.Fatalf("theirs: got conflicts %v", conflicts)
+	}
+
+	// A custom resolver sees all three sides and may build its own value.
+	got, _, err = Merge3(base, ours, theirs, func(c Conflict) (MergeValue, error) {
+		switch c.Path {
+		case "/a":
+			if !c.Base.Present || c.Base.Value.I64 != 1 || c.Ours.Value.I64 != 2 || c.Theirs.Value.I64 != 3 {
+				t.Fatalf("conflict /a: %+v", c)
+			}
+			return MergeValue{Value: Value{Type: TypeI64, I64: c.Ours.Value.I64 + c.Theirs.Value.I64}, Present: true}, nil
+		case "/b":
+			if c.Theirs.Present || c.Ours.Value.Type != TypeMap {
+				t.Fatalf("conflict /b: %+v", c)
+			}
+			return MergeValue{}, nil
+		}
+		t.Fatalf("unexpected conflict at %q", c.Path)
+		return MergeValue{}, nil
+	})
+	if err != nil {
+		t.Fatalf("custom: %v", err)
+	}
+	assertDocEqual(t, got, `{"a":5,"d":2}`)
+
+	// A container taken from another document is copied into the result.
+	other := mustJSON(t, `{"x":[1,{"y":true}]}`)
+	otherRoot, err := documentRoot(other)
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	got, _, err = Merge3(base, ours, theirs, func(c Conflict) (MergeValue, error) {
+		return MergeValue{Doc: other, Value: otherRoot, Present: true}, nil
+	})
+	if err != nil {
+		t.Fatalf("container: %v", err)
+	}
+	assertDocEqual(t, got, `{"a":{"x":[1,{"y":true}]},"b":{"x":[1,{"y":true}]},"d":2}`)
+
+	errStop := errors.New("stop")
+	if _, _, err := Merge3(base, ours, theirs, func(Conflict) (MergeValue, error) {
+		return MergeValue{}, errStop
+	}); !errors.Is(err, errStop) {
+		t.Fatalf("resolver error: got %v", err)
+	}
+}
+
+func TestMerge3SharedBase(t *testing.T) {
+	base := mustJSON(t, `{"a":{"b":[1,2,3]},"c":"x","d":0}`)
+	ours, err := SetPointer(base, "/c", Value{Type: TypeTxt, Bytes: []byte("ours")}, PointerCreateNone)
+	if err != nil {
+		t.Fatalf("ours: %v", err)
+	}
+	theirs, err := SetPointer(base, "/a/b/1", Value{Type: TypeI64, I64: 20}, PointerCreateNone)
+	if err != nil {
+		t.Fatalf("theirs: %v", err)
+	}
+	got, conflicts, err := Merge3(base, ours, theirs, nil)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("merge: %v %v", err, conflicts)
+	}
+	assertDocEqual(t, got, `{"a":{"b":[1,20,3]},"c":"ours","d":0}`)
+}
+
+func mustJSON(t *testing.T, s string) []byte {
+	t.Helper()
+	doc, err := FromJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("from json %s: %v", s, err)
+	}
+	return doc
+}
+
+// assertDocEqual compares the root of doc with the JSON text want.
+func assertDocEqual(t *testing.T, doc []byte, want string) {
+	t.Helper()
+	wantDoc := mustJSON(t, want)
+	ok, err := Equal(doc, mustRoot(t, doc), wantDoc, mustRoot(t, wantDoc))
+	if err != nil {
+		t.Fatalf("equal: %v", err)
+	}
+	if !ok {
+		got, _ := ToJSON(doc)
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
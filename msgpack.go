@@ -0,0 +1,466 @@
+package tron
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// maxMsgPackDepth bounds nesting in FromMsgPack input.
+const maxMsgPackDepth = 10000
+
+// IntOverflow selects how integers outside the i64 range are imported.
+type IntOverflow uint8
+
+const (
+	// IntOverflowFloat stores the integer as the nearest f64.
+	IntOverflowFloat IntOverflow = iota
+	// IntOverflowError rejects the input.
+	IntOverflowError
+	// IntOverflowText stores the integer's decimal digits as a txt value.
+	IntOverflowText
+)
+
+// MsgPackOptions configures FromMsgPack.
+type MsgPackOptions struct {
+	// IntOverflow handles uint64 values above the i64 range.
+	IntOverflow IntOverflow
+}
+
+// FromMsgPack converts a single MessagePack value into a TRON document.
+//
+// Str values become txt and must be valid UTF-8, bin values become bin, and
+// float 32 and float 64 become f64. Ints and uints become i64, with uints
+// beyond the i64 range handled by opts.IntOverflow. Extension values,
+// timestamps included, become bin values holding their payload; the extension
+// type is dropped.
+//
+// Map keys must be str or integers; integer keys are stored as their decimal
+// text. Other key types are rejected. When keys repeat, including an integer
+// key and a str key with the same text, the last value wins. Arrays and maps
+// nested more than 10000 deep are rejected.
+func FromMsgPack(data []byte, opts MsgPackOptions) ([]byte, error) {
+	builder := NewBuilder()
+	d := msgpackDecoder{data: data, opts: opts, builder: builder, workspace: newEncodeWorkspace()}
+	val, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(data) {
+		return nil, fmt.Errorf("%d bytes of trailing data after msgpack value", len(data)-d.off)
+	}
+	switch val.Type {
+	case TypeArr, TypeMap:
+		return builder.BytesWithTrailer(val.Offset, 0), nil
+	default:
+		return EncodeScalarDocument(val)
+	}
+}
+
+type msgpackDecoder struct {
+	data      []byte
+	off       int
+	opts      MsgPackOptions
+	builder   *Builder
+	workspace *encodeWorkspace
+}
+
+func (d *msgpackDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, fmt.Errorf("unexpected end of msgpack input at offset %d", d.off)
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// int reads a big-endian signed integer of size bytes.
+func (d *msgpackDecoder) int(size int) (int64, error) {
+	u, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	shift := 64 - 8*size
+	return int64(u<<shift) >> shift, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (Value, error) {
+	if d.off >= len(d.data) {
+		return Value{}, fmt.Errorf("unexpected end of msgpack input at offset %d", d.off)
+	}
+	c := d.data[d.off]
+	d.off++
+	switch {
+	case c <= 0x7f:
+		return Value{Type: TypeI64, I64: int64(c)}, nil
+	case c >= 0xe0:
+		return Value{Type: TypeI64, I64: int64(int8(c))}, nil
+	case c <= 0x8f:
+		return d.object(uint64(c&0x0f), depth)
+	case c <= 0x9f:
+		return d.array(uint64(c&0x0f), depth)
+	case c <= 0xbf:
+		return d.str(uint64(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return Value{Type: TypeNil}, nil
+	case 0xc2:
+		return Value{Type: TypeBit, Bool: false}, nil
+	case 0xc3:
+		return Value{Type: TypeBit, Bool: true}, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return Value{}, err
+		}
+		b, err := d.take(n)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeBin, Bytes: b}, nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return Value{}, err
+		}
+		return d.ext(n)
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeF64, F64: float64(math.Float32frombits(uint32(u)))}, nil
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeF64, F64: math.Float64frombits(u)}, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return Value{}, err
+		}
+		return d.uintValue(u)
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		i, err := d.int(1 << (c - 0xd0))
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeI64, I64: i}, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return Value{}, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return Value{}, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return Value{}, err
+		}
+		return d.object(n, depth)
+	default:
+		return Value{}, fmt.Errorf("invalid msgpack type byte 0x%02x at offset %d", c, d.off-1)
+	}
+}
+
+func (d *msgpackDecoder) uintValue(u uint64) (Value, error) {
+	if u <= math.MaxInt64 {
+		return Value{Type: TypeI64, I64: int64(u)}, nil
+	}
+	switch d.opts.IntOverflow {
+	case IntOverflowFloat:
+		return Value{Type: TypeF64, F64: float64(u)}, nil
+	case IntOverflowError:
+		return Value{}, fmt.Errorf("msgpack integer %d overflows i64", u)
+	case IntOverflowText:
+		return Value{Type: TypeTxt, Bytes: strconv.AppendUint(nil, u, 10)}, nil
+	default:
+		return Value{}, fmt.Errorf("unknown int overflow policy %d", d.opts.IntOverflow)
+	}
+}
+
+func (d *msgpackDecoder) str(n uint64) (Value, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return Value{}, err
+	}
+	if !utf8.Valid(b) {
+		return Value{}, fmt.Errorf("invalid utf-8 in msgpack str at offset %d", d.off-len(b))
+	}
+	return Value{Type: TypeTxt, Bytes: b}, nil
+}
+
+func (d *msgpackDecoder) ext(n uint64) (Value, error) {
+	if _, err := d.take(1); err != nil {
+		return Value{}, err
+	}
+	b, err := d.take(n)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeBin, Bytes: b}, nil
+}
+
+func (d *msgpackDecoder) array(n uint64, depth int) (Value, error) {
+	if depth >= maxMsgPackDepth {
+		return Value{}, fmt.Errorf("msgpack nesting exceeds depth %d at offset %d", maxMsgPackDepth, d.off-1)
+	}
+	// Every element takes at least one byte.
+	if n > uint64(len(d.data)-d.off) {
+		return Value{}, fmt.Errorf("msgpack array length %d exceeds input", n)
+	}
+	ab := newArrayBuilderWithWorkspace(d.workspace)
+	for i := uint64(0); i < n; i++ {
+		val, err := d.value(depth + 1)
+		if err != nil {
+			return Value{}, err
+		}
+		ab.Append(val)
+	}
+	off, err := ab.Build(d.builder)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeArr, Offset: off}, nil
+}
+
+func (d *msgpackDecoder) object(n uint64, depth int) (Value, error) {
+	if depth >= maxMsgPackDepth {
+		return Value{}, fmt.Errorf("msgpack nesting exceeds depth %d at offset %d", maxMsgPackDepth, d.off-1)
+	}
+	// Every entry takes at least two bytes.
+	if n > uint64(len(d.data)-d.off)/2 {
+		return Value{}, fmt.Errorf("msgpack map length %d exceeds input", n)
+	}
+	mb := newMapBuilderWithWorkspace(d.workspace)
+	for i := uint64(0); i < n; i++ {
+		k, err := d.key()
+		if err != nil {
+			return Value{}, err
+		}
+		val, err := d.value(depth + 1)
+		if err != nil {
+			return Value{}, err
+		}
+		mb.Set(k, val)
+	}
+	off, err := mb.Build(d.builder)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeMap, Offset: off}, nil
+}
+
+// key reads a map key, formatting integer keys as decimal text.
+func (d *msgpackDecoder) key() ([]byte, error) {
+	if d.off >= len(d.data) {
+		return nil, fmt.Errorf("unexpected end of msgpack input at offset %d", d.off)
+	}
+	start := d.off
+	switch c := d.data[d.off]; {
+	case c == 0xcf:
+		d.off++
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendUint(nil, u, 10), nil
+	case c <= 0x7f, c >= 0xe0, c >= 0xcc && c <= 0xce, c >= 0xd0 && c <= 0xd3,
+		c >= 0xa0 && c <= 0xbf, c >= 0xd9 && c <= 0xdb:
+		// Only scalar type bytes reach here, so depth does not matter.
+		key, err := d.value(0)
+		if err != nil {
+			return nil, err
+		}
+		if key.Type == TypeI64 {
+			return strconv.AppendInt(nil, key.I64, 10), nil
+		}
+		return key.Bytes, nil
+	default:
+		return nil, fmt.Errorf("unsupported msgpack map key type 0x%02x at offset %d", c, start)
+	}
+}
+
+// ToMsgPack encodes a TRON document as MessagePack.
+func ToMsgPack(doc []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteMsgPack(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteMsgPack writes doc as a single MessagePack value to w through a
+// buffer, flushing before it returns.
+//
+// Txt values become str and bin values bin, each in its smallest format.
+// Integers use the smallest int or uint format that holds them. An f64 is
+// written as float 32 when that holds it exactly and as float 64 otherwise.
+// Map keys are str in stored order, and array holes are written as nil.
+func WriteMsgPack(w io.Writer, doc []byte) error {
+	root, err := documentRoot(doc)
+	if err != nil {
+		return err
+	}
+	mw := msgpackWriter{w: bufio.NewWriterSize(w, 32<<10), doc: doc}
+	if err := mw.value(root); err != nil {
+		return err
+	}
+	return mw.w.Flush()
+}
+
+type msgpackWriter struct {
+	w       *bufio.Writer
+	doc     []byte
+	scratch [9]byte
+}
+
+// head writes a length or unsigned integer in the fixed format fix when n is
+// below limit, and otherwise in the smallest of the 8-, 16-, 32- and 64-bit
+// formats in codes. A zero code skips that width.
+func (mw *msgpackWriter) head(n uint64, fix byte, limit uint64, codes [4]byte) {
+	b := mw.scratch[:0]
+	switch {
+	case n < limit:
+		b = append(b, fix|byte(n))
+	case codes[0] != 0 && n <= math.MaxUint8:
+		b = append(b, codes[0], byte(n))
+	case codes[1] != 0 && n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, codes[1]), uint16(n))
+	case n <= math.MaxUint32:
+		b = binary.BigEndian.AppendUint32(append(b, codes[2]), uint32(n))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, codes[3]), n)
+	}
+	mw.w.Write(b)
+}
+
+func (mw *msgpackWriter) int(i int64) {
+	b := mw.scratch[:0]
+	switch {
+	case i >= 0:
+		mw.head(uint64(i), 0x00, 0x80, [4]byte{0xcc, 0xcd, 0xce, 0xcf})
+		return
+	case i >= -32:
+		b = append(b, byte(int8(i)))
+	case i >= math.MinInt8:
+		b = append(b, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32:
+		b = binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(i)))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+	mw.w.Write(b)
+}
+
+func (mw *msgpackWriter) str(s []byte) {
+	mw.head(uint64(len(s)), 0xa0, 32, [4]byte{0xd9, 0xda, 0xdb})
+	mw.w.Write(s)
+}
+
+func (mw *msgpackWriter) value(v Value) error {
+	switch v.Type {
+	case TypeNil:
+		mw.w.WriteByte(0xc0)
+	case TypeBit:
+		if v.Bool {
+			mw.w.WriteByte(0xc3)
+		} else {
+			mw.w.WriteByte(0xc2)
+		}
+	case TypeI64:
+		mw.int(v.I64)
+	case TypeF64:
+		if f := float32(v.F64); float64(f) == v.F64 {
+			mw.w.Write(binary.BigEndian.AppendUint32(append(mw.scratch[:0], 0xca), math.Float32bits(f)))
+		} else {
+			mw.w.Write(binary.BigEndian.AppendUint64(append(mw.scratch[:0], 0xcb), math.Float64bits(v.F64)))
+		}
+	case TypeTxt:
+		mw.str(v.Bytes)
+	case TypeBin:
+		mw.head(uint64(len(v.Bytes)), 0, 0, [4]byte{0xc4, 0xc5, 0xc6})
+		mw.w.Write(v.Bytes)
+	case TypeArr:
+		return mw.array(v.Offset)
+	case TypeMap:
+		return mw.object(v.Offset)
+	default:
+		return fmt.Errorf("unknown value type %d", v.Type)
+	}
+	return nil
+}
+
+func (mw *msgpackWriter) array(off uint32) error {
+	length, err := arrayRootLength(mw.doc, off)
+	if err != nil {
+		return err
+	}
+	mw.head(uint64(length), 0x90, 16, [4]byte{0, 0xdc, 0xdd})
+	next := uint32(0)
+	err = ArrEach(mw.doc, off, func(index uint32, val Value) error {
+		if index >= length {
+			return fmt.Errorf("array index out of range: %d", index)
+		}
+		for ; next < index; next++ {
+			mw.w.WriteByte(0xc0)
+		}
+		next = index + 1
+		return mw.value(val)
+	})
+	if err != nil {
+		return err
+	}
+	for ; next < length; next++ {
+		mw.w.WriteByte(0xc0)
+	}
+	return nil
+}
+
+func (mw *msgpackWriter) object(off uint32) error {
+	n, err := MapLen(mw.doc, off)
+	if err != nil {
+		return err
+	}
+	mw.head(uint64(n), 0x80, 16, [4]byte{0, 0xde, 0xdf})
+	return MapEach(mw.doc, off, func(key []byte, val Value) error {
+		mw.str(key)
+		return mw.value(val)
+	})
+}
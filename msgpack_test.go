@@ -0,0 +1,175 @@
+package tron
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	inputs := []string{
+		`null`,
+		`true`,
+		`0`,
+		`-33`,
+		`4294967296`,
+		`-9223372036854775808`,
+		`1.5`,
+		`0.1`,
+		`""`,
+		`"` + strings.Repeat("x", 300) + `"`,
+		`[]`,
+		`{}`,
+		`[1,-1,127,128,-32,-33,255,256,65535,65536,null,false,"é"]`,
+		`{"a":{"b":[1,{"c":null}]},"d":"text","e":[[],{}]}`,
+		`"b64:AAECAw=="`,
+	}
+	for _, in := range inputs {
+		doc := mustJSON(t, in)
+		mp, err := ToMsgPack(doc)
+		if err != nil {
+			t.Fatalf("to msgpack %s: %v", in, err)
+		}
+		back, err := FromMsgPack(mp, MsgPackOptions{})
+		if err != nil {
+			t.Fatalf("from msgpack %s: %v", in, err)
+		}
+		assertDocEqual(t, back, in)
+		again, err := ToMsgPack(back)
+		if err != nil {
+			t.Fatalf("to msgpack again %s: %v", in, err)
+		}
+		if !bytes.Equal(mp, again) {
+			t.Fatalf("%s: msgpack changed on the second pass: % x then % x", in, mp, again)
+		}
+	}
+}
+
+func TestMsgPackEncodings(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+	}{
+		{`null`, []byte{0xc0}},
+		{`false`, []byte{0xc2}},
+		{`127`, []byte{0x7f}},
+		{`-32`, []byte{0xe0}},
+		{`200`, []byte{0xcc, 0xc8}},
+		{`-200`, []byte{0xd1, 0xff, 0x38}},
+		{`1.5`, []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}},
+		{`0.1`, []byte{0xcb, 0x3f, 0xb9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}},
+		{`"ab"`, []byte{0xa2, 'a', 'b'}},
+		{`"b64:AAE="`, []byte{0xc4, 0x02, 0x00, 0x01}},
+		{`[1]`, []byte{0x91, 0x01}},
+		{`{"a":1}`, []byte{0x81, 0xa1, 'a', 0x01}},
+	}
+	for _, tt := range tests {
+		got, err := ToMsgPack(mustJSON(t, tt.in))
+		if err != nil {
+			t.Fatalf("to msgpack %s: %v", tt.in, err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Fatalf("%s: got % x, want % x", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMsgPackIntOverflow(t *testing.T) {
+	maxUint := []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	doc, err := FromMsgPack(maxUint, MsgPackOptions{IntOverflow: IntOverflowFloat})
+	if err != nil {
+		t.Fatalf("float: %v", err)
+	}
+	if c := NewCursor(doc); c.Type() != TypeF64 || c.Float64() != math.MaxUint64 {
+		t.Fatalf("float: got %v", c.Value())
+	}
+	doc, err = FromMsgPack(maxUint, MsgPackOptions{IntOverflow: IntOverflowText})
+	if err != nil {
+		t.Fatalf("text: %v", err)
+	}
+	if c := NewCursor(doc); c.Text() != "18446744073709551615" {
+		t.Fatalf("text: got %v", c.Value())
+	}
+	if _, err := FromMsgPack(maxUint, MsgPackOptions{IntOverflow: IntOverflowError}); err == nil {
+		t.Fatalf("error: accepted uint64 above the i64 range")
+	}
+	// uint64 values in range are not affected by the policy.
+	inRange := []byte{0xcf, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	doc, err = FromMsgPack(inRange, MsgPackOptions{IntOverflow: IntOverflowError})
+	if err != nil {
+		t.Fatalf("in range: %v", err)
+	}
+	if c := NewCursor(doc); c.Int64() != math.MaxInt64 {
+		t.Fatalf("in range: got %v", c.Value())
+	}
+}
+
+func TestFromMsgPackTruncated(t *testing.T) {
+	mp, err := ToMsgPack(mustJSON(t, `{"a":[1,300,70000,-1.5,"text","b64:AAE="],"b":{"c":null}}`))
+	if err != nil {
+		t.Fatalf("to msgpack: %v", err)
+	}
+	for n := range len(mp) {
+		if _, err := FromMsgPack(mp[:n], MsgPackOptions{}); err == nil {
+			t.Fatalf("accepted input truncated to %d of %d bytes", n, len(mp))
+		}
+	}
+	if _, err := FromMsgPack(append(mp, 0xc0), MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted trailing data")
+	}
+	// A length prefix larger than the input must fail without allocating it.
+	if _, err := FromMsgPack([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted array 32 longer than the input")
+	}
+}
+
+func TestFromMsgPackKeysAndExtensions(t *testing.T) {
+	// {1: "one", "1": "uno", -2: true}: integer keys become decimal text and
+	// the later "1" wins.
+	mp := []byte{0x83, 0x01, 0xa3, 'o', 'n', 'e', 0xa1, '1', 0xa3, 'u', 'n', 'o', 0xfe, 0xc3}
+	doc, err := FromMsgPack(mp, MsgPackOptions{})
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	assertDocEqual(t, doc, `{"1":"uno","-2":true}`)
+	// A nil key is rejected.
+	if _, err := FromMsgPack([]byte{0x81, 0xc0, 0x01}, MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted nil map key")
+	}
+	// fixext 4 timestamp becomes bin holding its payload.
+	doc, err = FromMsgPack([]byte{0xd6, 0xff, 0x00, 0x00, 0x00, 0x01}, MsgPackOptions{})
+	if err != nil {
+		t.Fatalf("ext: %v", err)
+	}
+	if c := NewCursor(doc); c.Type() != TypeBin || !bytes.Equal(c.Bytes(), []byte{0, 0, 0, 1}) {
+		t.Fatalf("ext: got %v", c.Value())
+	}
+	if _, err := FromMsgPack([]byte{0xa2, 0xff, 0xfe}, MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted invalid UTF-8 str")
+	}
+	if _, err := FromMsgPack([]byte{0xc1}, MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted never-used byte 0xc1")
+	}
+}
+
+func TestFromMsgPackDepth(t *testing.T) {
+	// nested repeats open, a fixarray or fixmap header with its key, n times
+	// around a nil.
+	nested := func(n int, open ...byte) []byte {
+		return append(bytes.Repeat(open, n), 0xc0)
+	}
+	if _, err := FromMsgPack(nested(maxMsgPackDepth, 0x91), MsgPackOptions{}); err != nil {
+		t.Fatalf("depth %d: %v", maxMsgPackDepth, err)
+	}
+	if _, err := FromMsgPack(nested(maxMsgPackDepth+1, 0x91), MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted arrays nested %d deep", maxMsgPackDepth+1)
+	}
+	if _, err := FromMsgPack(nested(maxMsgPackDepth+1, 0x81, 0xa1, 'k'), MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted maps nested %d deep", maxMsgPackDepth+1)
+	}
+	// Deep enough to overflow the stack without a limit.
+	if _, err := FromMsgPack(nested(5_000_000, 0x91), MsgPackOptions{}); err == nil {
+		t.Fatalf("accepted arrays nested 5000000 deep")
+	}
+}
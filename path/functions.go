@@ -342,11 +342,8 @@ func jpfLength(arguments []jValue, _ *interpreter) (jValue, error) {
 		}
 		return jValue{kind: kindNumber, n: float64(length)}, nil
 	case kindTRONMap:
-		count := 0
-		if err := mapIterEntries(arg.doc, arg.off, func(_ []byte, _ tron.Value) error {
-			count++
-			return nil
-		}); err != nil {
+		count, err := tron.MapLen(arg.doc, arg.off)
+		if err != nil {
 			return nullValue(), err
 		}
 		return jValue{kind: kindNumber, n: float64(count)}, nil
@@ -53,71 +53,13 @@ func mapGetBytesHashed(doc []byte, off uint32, key []byte, hash uint32, depth in
 }
 
 func mapIterValues(doc []byte, off uint32, fn func(tron.Value) error) error {
-	h, node, err := tron.NodeSliceAt(doc, off)
-	if err != nil {
-		return err
-	}
-	if h.KeyType != tron.KeyMap {
-		return fmt.Errorf("node is not a map")
-	}
-	if h.Kind == tron.NodeLeaf {
-		leaf, err := tron.ParseMapLeafNode(doc, node)
-		if err != nil {
-			return err
-		}
-		defer tron.ReleaseMapLeafNode(&leaf)
-		for _, entry := range leaf.Entries {
-			if err := fn(entry.Value); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	branch, err := tron.ParseMapBranchNode(node)
-	if err != nil {
-		return err
-	}
-	defer tron.ReleaseMapBranchNode(&branch)
-	for _, child := range branch.Children {
-		if err := mapIterValues(doc, child, fn); err != nil {
-			return err
-		}
-	}
-	return nil
+	return tron.MapEach(doc, off, func(_ []byte, val tron.Value) error {
+		return fn(val)
+	})
 }
 
 func mapIterEntries(doc []byte, off uint32, fn func(key []byte, val tron.Value) error) error {
-	h, node, err := tron.NodeSliceAt(doc, off)
-	if err != nil {
-		return err
-	}
-	if h.KeyType != tron.KeyMap {
-		return fmt.Errorf("node is not a map")
-	}
-	if h.Kind == tron.NodeLeaf {
-		leaf, err := tron.ParseMapLeafNode(doc, node)
-		if err != nil {
-			return err
-		}
-		defer tron.ReleaseMapLeafNode(&leaf)
-		for _, entry := range leaf.Entries {
-			if err := fn(entry.Key, entry.Value); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	branch, err := tron.ParseMapBranchNode(node)
-	if err != nil {
-		return err
-	}
-	defer tron.ReleaseMapBranchNode(&branch)
-	for _, child := range branch.Children {
-		if err := mapIterEntries(doc, child, fn); err != nil {
-			return err
-		}
-	}
-	return nil
+	return tron.MapEach(doc, off, fn)
 }
 
 func arrGetRaw(doc []byte, off uint32, index uint32) (tron.Value, bool, error) {
@@ -168,41 +110,9 @@ func arrayLength(doc []byte, off uint32) (uint32, error) {
 }
 
 func arrIterValues(doc []byte, off uint32, fn func(tron.Value) error) error {
-	h, node, err := tron.NodeSliceAt(doc, off)
-	if err != nil {
-		return err
-	}
-	if h.KeyType != tron.KeyArr {
-		return fmt.Errorf("node is not an array")
-	}
-	if h.Kind == tron.NodeLeaf {
-		leaf, err := tron.ParseArrayLeafNode(node)
-		if err != nil {
-			return err
-		}
-		defer tron.ReleaseArrayLeafNode(&leaf)
-		for _, addr := range leaf.ValueAddrs {
-			val, err := tron.DecodeValueAt(doc, addr)
-			if err != nil {
-				return err
-			}
-			if err := fn(val); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	branch, err := tron.ParseArrayBranchNode(node)
-	if err != nil {
-		return err
-	}
-	defer tron.ReleaseArrayBranchNode(&branch)
-	for _, child := range branch.Children {
-		if err := arrIterValues(doc, child, fn); err != nil {
-			return err
-		}
-	}
-	return nil
+	return tron.ArrEach(doc, off, func(_ uint32, val tron.Value) error {
+		return fn(val)
+	})
 }
 
 func arrCollectValues(doc []byte, off uint32, base uint32, values []tron.Value, present []bool) error {
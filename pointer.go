@@ -0,0 +1,404 @@
+package tron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PointerCreate selects how SetPointer handles missing intermediate containers.
+type PointerCreate uint8
+
+const (
+	// PointerCreateNone fails when an intermediate container is missing.
+	PointerCreateNone PointerCreate = iota
+	// PointerCreateMaps creates missing intermediates as maps.
+	PointerCreateMaps
+	// PointerCreateAuto creates an array when the next token is "0" or "-"
+	// and a map otherwise.
+	PointerCreateAuto
+)
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// ParsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens.
+// The empty pointer refers to the whole document and yields no tokens.
+func ParsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("json pointer %q must start with '/'", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, tok := range tokens {
+		if !strings.Contains(tok, "~") {
+			continue
+		}
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 == len(tok) || (tok[j+1] != '0' && tok[j+1] != '1')) {
+				return nil, fmt.Errorf("json pointer %q has invalid escape", ptr)
+			}
+		}
+		tokens[i] = pointerUnescaper.Replace(tok)
+	}
+	return tokens, nil
+}
+
+// GetPointer returns the value ptr refers to in doc. A missing key or an
+// index past the end reports false without an error.
+func GetPointer(doc []byte, ptr string) (Value, bool, error) {
+	tokens, err := ParsePointer(ptr)
+	if err != nil {
+		return Value{}, false, err
+	}
+	root, err := documentRoot(doc)
+	if err != nil {
+		return Value{}, false, err
+	}
+	return pointerGet(doc, root, tokens)
+}
+
+// SetPointer sets the value ptr refers to and returns the updated document.
+// Array tokens may name an existing index, or the length or "-" to append.
+// Missing intermediate containers are created according to create.
+// Arr and map values must refer to nodes in doc.
+func SetPointer(doc []byte, ptr string, val Value, create PointerCreate) ([]byte, error) {
+	tokens, err := ParsePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	root, err := documentRoot(doc)
+	if err != nil {
+		return nil, err
+	}
+	builder, tr, err := NewBuilderFromDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := pointerSet(builder, root, tokens, val, create)
+	if err != nil {
+		return nil, err
+	}
+	newRoot, err := valueAddress(builder, updated)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BytesWithTrailer(newRoot, tr.RootOffset), nil
+}
+
+// DeletePointer removes the value ptr refers to and returns the updated
+// document. When the target is missing, doc is returned unchanged with false.
+// Removing an array element shifts the following elements down.
+func DeletePointer(doc []byte, ptr string) ([]byte, bool, error) {
+	tokens, err := ParsePointer(ptr)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(tokens) == 0 {
+		return nil, false, fmt.Errorf("cannot delete the document root")
+	}
+	root, err := documentRoot(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	builder, tr, err := NewBuilderFromDocument(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	updated, removed, err := pointerDelete(builder, root, tokens)
+	if err != nil || !removed {
+		return doc, false, err
+	}
+	return builder.BytesWithTrailer(updated.Offset, tr.RootOffset), true, nil
+}
+
+// GetPointer returns the value ptr refers to under the transaction root.
+func (tx *Txn) GetPointer(ptr string) (Value, bool, error) {
+	tokens, err := ParsePointer(ptr)
+	if err != nil {
+		return Value{}, false, err
+	}
+	root, err := tx.Root()
+	if err != nil {
+		return Value{}, false, err
+	}
+	return pointerGet(tx.doc.builder.buf, root, tokens)
+}
+
+// SetPointer sets the value ptr refers to under the transaction root.
+func (tx *Txn) SetPointer(ptr string, val Value, create PointerCreate) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	tokens, err := ParsePointer(ptr)
+	if err != nil {
+		return tx.fail(err)
+	}
+	root, err := tx.Root()
+	if err != nil {
+		return tx.fail(err)
+	}
+	updated, err := pointerSet(tx.doc.builder, root, tokens, val, create)
+	if err != nil {
+		return tx.fail(err)
+	}
+	return tx.SetRoot(updated)
+}
+
+// DeletePointer removes the value ptr refers to under the transaction root
+// and reports whether it was present.
+func (tx *Txn) DeletePointer(ptr string) (bool, error) {
+	if err := tx.check(); err != nil {
+		return false, err
+	}
+	tokens, err := ParsePointer(ptr)
+	if err != nil {
+		return false, tx.fail(err)
+	}
+	if len(tokens) == 0 {
+		return false, tx.fail(fmt.Errorf("cannot delete the document root"))
+	}
+	root, err := tx.Root()
+	if err != nil {
+		return false, tx.fail(err)
+	}
+	updated, removed, err := pointerDelete(tx.doc.builder, root, tokens)
+	if err != nil {
+		return false, tx.fail(err)
+	}
+	if removed {
+		tx.root = updated.Offset
+	}
+	return removed, nil
+}
+
+func documentRoot(doc []byte) (Value, error) {
+	if _, err := DetectDocType(doc); err != nil {
+		return Value{}, err
+	}
+	tr, err := ParseTrailer(doc)
+	if err != nil {
+		return Value{}, err
+	}
+	return DecodeValueAt(doc, tr.RootOffset)
+}
+
+func pointerGet(doc []byte, cur Value, tokens []string) (Value, bool, error) {
+	for i, tok := range tokens {
+		switch cur.Type {
+		case TypeMap:
+			val, ok, err := MapGet(doc, cur.Offset, []byte(tok))
+			if err != nil || !ok {
+				return Value{}, false, err
+			}
+			cur = val
+		case TypeArr:
+			length, err := arrayRootLength(doc, cur.Offset)
+			if err != nil {
+				return Value{}, false, err
+			}
+			index, err := ParsePointerIndex(tok, length)
+			if err != nil {
+				return Value{}, false, err
+			}
+			if index >= length {
+				return Value{}, false, nil
+			}
+			val, ok, err := arrGet(doc, cur.Offset, index, true)
+			if err != nil {
+				return Value{}, false, err
+			}
+			if !ok {
+				val = Value{Type: TypeNil}
+			}
+			cur = val
+		default:
+			return Value{}, false, pointerTraverseError(tokens[:i], cur)
+		}
+	}
+	return cur, true, nil
+}
+
+func pointerSet(builder *Builder, cur Value, tokens []string, val Value, create PointerCreate) (Value, error) {
+	if len(tokens) == 0 {
+		return val, nil
+	}
+	tok, rest := tokens[0], tokens[1:]
+	switch cur.Type {
+	case TypeMap:
+		child, ok, err := MapGet(builder.buf, cur.Offset, []byte(tok))
+		if err != nil {
+			return Value{}, err
+		}
+		if !ok && len(rest) > 0 {
+			if child, err = pointerCreate(builder, tok, rest[0], create); err != nil {
+				return Value{}, err
+			}
+		}
+		updated, err := pointerSet(builder, child, rest, val, create)
+		if err != nil {
+			return Value{}, err
+		}
+		off, _, err := MapSetNode(builder, cur.Offset, []byte(tok), updated)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeMap, Offset: off}, nil
+	case TypeArr:
+		length, err := arrayRootLength(builder.buf, cur.Offset)
+		if err != nil {
+			return Value{}, err
+		}
+		index, err := ParsePointerIndex(tok, length)
+		if err != nil {
+			return Value{}, err
+		}
+		if index > length {
+			return Value{}, fmt.Errorf("array index %d out of range", index)
+		}
+		var child Value
+		if index < length {
+			val, ok, err := arrGet(builder.buf, cur.Offset, index, true)
+			if err != nil {
+				return Value{}, err
+			}
+			if ok {
+				child = val
+			}
+		} else {
+			length++
+			if len(rest) > 0 {
+				if child, err = pointerCreate(builder, tok, rest[0], create); err != nil {
+					return Value{}, err
+				}
+			}
+		}
+		updated, err := pointerSet(builder, child, rest, val, create)
+		if err != nil {
+			return Value{}, err
+		}
+		off, err := ArraySetNode(builder, cur.Offset, index, updated, length)
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeArr, Offset: off}, nil
+	default:
+		return Value{}, fmt.Errorf("cannot set %q in %s value", tok, cur.Type)
+	}
+}
+
+// pointerCreate returns a new empty container for the missing intermediate
+// tok whose first child token is next.
+func pointerCreate(builder *Builder, tok, next string, create PointerCreate) (Value, error) {
+	switch create {
+	case PointerCreateNone:
+		return Value{}, fmt.Errorf("missing intermediate value %q", tok)
+	case PointerCreateMaps:
+	case PointerCreateAuto:
+		if next == "0" || next == "-" {
+			off, err := NewArrayBuilder().Build(builder)
+			if err != nil {
+				return Value{}, err
+			}
+			return Value{Type: TypeArr, Offset: off}, nil
+		}
+	default:
+		return Value{}, fmt.Errorf("unknown pointer create policy %d", create)
+	}
+	off, err := EmptyMapRoot(builder)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeMap, Offset: off}, nil
+}
+
+func pointerDelete(builder *Builder, cur Value, tokens []string) (Value, bool, error) {
+	tok, rest := tokens[0], tokens[1:]
+	switch cur.Type {
+	case TypeMap:
+		if len(rest) == 0 {
+			off, removed, err := MapDelNode(builder, cur.Offset, []byte(tok))
+			if err != nil || !removed {
+				return Value{}, false, err
+			}
+			return Value{Type: TypeMap, Offset: off}, true, nil
+		}
+		child, ok, err := MapGet(builder.buf, cur.Offset, []byte(tok))
+		if err != nil || !ok {
+			return Value{}, false, err
+		}
+		updated, removed, err := pointerDelete(builder, child, rest)
+		if err != nil || !removed {
+			return Value{}, false, err
+		}
+		off, _, err := MapSetNode(builder, cur.Offset, []byte(tok), updated)
+		if err != nil {
+			return Value{}, false, err
+		}
+		return Value{Type: TypeMap, Offset: off}, true, nil
+	case TypeArr:
+		length, err := arrayRootLength(builder.buf, cur.Offset)
+		if err != nil {
+			return Value{}, false, err
+		}
+		index, err := ParsePointerIndex(tok, length)
+		if err != nil {
+			return Value{}, false, err
+		}
+		if index >= length {
+			return Value{}, false, nil
+		}
+		if len(rest) == 0 {
+			off, err := ArraySpliceNode(builder, cur.Offset, index, 1)
+			if err != nil {
+				return Value{}, false, err
+			}
+			return Value{Type: TypeArr, Offset: off}, true, nil
+		}
+		child, ok, err := arrGet(builder.buf, cur.Offset, index, true)
+		if err != nil || !ok {
+			return Value{}, false, err
+		}
+		updated, removed, err := pointerDelete(builder, child, rest)
+		if err != nil || !removed {
+			return Value{}, false, err
+		}
+		off, err := ArraySetNode(builder, cur.Offset, index, updated, length)
+		if err != nil {
+			return Value{}, false, err
+		}
+		return Value{Type: TypeArr, Offset: off}, true, nil
+	default:
+		return Value{}, false, fmt.Errorf("cannot delete %q in %s value", tok, cur.Type)
+	}
+}
+
+// ParsePointerIndex parses an RFC 6901 array reference token: a decimal
+// index without leading zeros, or "-" for the element past the end, which is
+// returned as length. The index is not checked against length.
+func ParsePointerIndex(tok string, length uint32) (uint32, error) {
+	if tok == "-" {
+		return length, nil
+	}
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	n, err := strconv.ParseUint(tok, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	return uint32(n), nil
+}
+
+func pointerTraverseError(tokens []string, cur Value) error {
+	var sb strings.Builder
+	for _, tok := range tokens {
+		sb.WriteByte('/')
+		sb.WriteString(pointerEscaper.Replace(tok))
+	}
+	return fmt.Errorf("json pointer %q refers to %s value", sb.String(), cur.Type)
+}
@@ -0,0 +1,261 @@
+package tron
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		ptr  string
+		want []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/foo/0", []string{"foo", "0"}},
+		{"/a~1b/m~0n", []string{"a/b", "m~n"}},
+		{"/~01", []string{"~1"}},
+		{"/~10", []string{"/0"}},
+		{"//x", []string{"", "x"}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePointer(tt.ptr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.ptr, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("parse %q = %q, want %q", tt.ptr, got, tt.want)
+		}
+	}
+	for _, ptr := range []string{"foo", "/~", "/a~2", "/~~0"} {
+		if _, err := ParsePointer(ptr); err == nil {
+			t.Fatalf("parse %q: expected error", ptr)
+		}
+	}
+}
+
+const pointerTestJSON = `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str"}`
+
+func TestGetPointer(t *testing.T) {
+	doc := mustJSON(t, pointerTestJSON)
+	tests := []struct {
+		ptr  string
+		want string
+		ok   bool
+		err  bool
+	}{
+		{ptr: "", want: pointerTestJSON, ok: true},
+		{ptr: "/a~1b/m~0n", want: `1`, ok: true},
+		{ptr: "/a~1b", want: `{"m~n":1}`, ok: true},
+		{ptr: "//", want: `"empty"`, ok: true},
+		{ptr: "/arr/0", want: `10`, ok: true},
+		{ptr: "/arr/2/x", want: `true`, ok: true},
+		{ptr: "/arr/3"},
+		{ptr: "/arr/-"},
+		{ptr: "/arr/4294967295"},
+		{ptr: "/missing"},
+		{ptr: "/missing/x"},
+		{ptr: "/a/b"},
+		{ptr: "/arr/01", err: true},
+		{ptr: "/arr/x", err: true},
+		{ptr: "/arr/-1", err: true},
+		{ptr: "/arr/4294967296", err: true},
+		{ptr: "/s/x", err: true},
+		{ptr: "/arr/0/x", err: true},
+		{ptr: "/a~2b", err: true},
+		{ptr: "arr", err: true},
+	}
+	for _, tt := range tests {
+		got, ok, err := GetPointer(doc, tt.ptr)
+		if (err != nil) != tt.err {
+			t.Fatalf("get %q: err = %v, want error %v", tt.ptr, err, tt.err)
+		}
+		if ok != tt.ok {
+			t.Fatalf("get %q: ok = %v, want %v", tt.ptr, ok, tt.ok)
+		}
+		if !ok {
+			continue
+		}
+		want := mustJSON(t, tt.want)
+		if eq, err := Equal(doc, got, want, mustRoot(t, want)); err != nil || !eq {
+			t.Fatalf("get %q: not %s (err %v)", tt.ptr, tt.want, err)
+		}
+	}
+}
+
+func TestSetPointer(t *testing.T) {
+	doc := mustJSON(t, pointerTestJSON)
+	seven := Value{Type: TypeI64, I64: 7}
+	tests := []struct {
+		ptr    string
+		create PointerCreate
+		want   string
+	}{
+		{"", PointerCreateNone, `7`},
+		{"/a~1b/m~0n", PointerCreateNone, `{"a/b":{"m~n":7},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str"}`},
+		{"/a~1b/~1~0", PointerCreateNone, `{"a/b":{"m~n":1,"/~":7},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str"}`},
+		{"//", PointerCreateNone, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":7},"s":"str"}`},
+		{"/arr/1", PointerCreateNone, `{"a/b":{"m~n":1},"arr":[10,7,{"x":true}],"":{"":"empty"},"s":"str"}`},
+		{"/arr/-", PointerCreateNone, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true},7],"":{"":"empty"},"s":"str"}`},
+		{"/arr/3", PointerCreateNone, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true},7],"":{"":"empty"},"s":"str"}`},
+		{"/arr/2/y", PointerCreateNone, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true,"y":7}],"":{"":"empty"},"s":"str"}`},
+		{"/new/0", PointerCreateMaps, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str","new":{"0":7}}`},
+		{"/new/x/y", PointerCreateMaps, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str","new":{"x":{"y":7}}}`},
+		{"/new/0/x", PointerCreateAuto, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str","new":[{"x":7}]}`},
+		{"/new/-", PointerCreateAuto, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str","new":[7]}`},
+		{"/new/1", PointerCreateAuto, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str","new":{"1":7}}`},
+		{"/arr/-/x", PointerCreateAuto, `{"a/b":{"m~n":1},"arr":[10,20,{"x":true},{"x":7}],"":{"":"empty"},"s":"str"}`},
+	}
+	for _, tt := range tests {
+		got, err := SetPointer(doc, tt.ptr, seven, tt.create)
+		if err != nil {
+			t.Fatalf("set %q: %v", tt.ptr, err)
+		}
+		assertDocEqual(t, got, tt.want)
+	}
+	assertDocEqual(t, doc, pointerTestJSON)
+
+	for _, tt := range []struct {
+		ptr    string
+		create PointerCreate
+	}{
+		{"/new/x", PointerCreateNone},
+		{"/arr/-/x", PointerCreateNone},
+		{"/arr/4", PointerCreateAuto},
+		{"/arr/01", PointerCreateAuto},
+		{"/s/x", PointerCreateAuto},
+		{"/arr/0/x", PointerCreateAuto},
+		{"/~", PointerCreateAuto},
+		{"/new/x", PointerCreate(9)},
+	} {
+		if _, err := SetPointer(doc, tt.ptr, seven, tt.create); err == nil {
+			t.Fatalf("set %q with create %d: expected error", tt.ptr, tt.create)
+		}
+	}
+}
+
+func TestDeletePointer(t *testing.T) {
+	doc := mustJSON(t, pointerTestJSON)
+	tests := []struct {
+		ptr  string
+		want string
+	}{
+		{"/arr/0", `{"a/b":{"m~n":1},"arr":[20,{"x":true}],"":{"":"empty"},"s":"str"}`},
+		{"/arr/2/x", `{"a/b":{"m~n":1},"arr":[10,20,{}],"":{"":"empty"},"s":"str"}`},
+		{"/a~1b/m~0n", `{"a/b":{},"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str"}`},
+		{"/a~1b", `{"arr":[10,20,{"x":true}],"":{"":"empty"},"s":"str"}`},
+		{"//", `{"a/b":{"m~n":1},"arr":[10,20,{"x":true}],"":{},"s":"str"}`},
+	}
+	for _, tt := range tests {
+		got, removed, err := DeletePointer(doc, tt.ptr)
+		if err != nil || !removed {
+			t.Fatalf("delete %q: removed=%v err=%v", tt.ptr, removed, err)
+		}
+		assertDocEqual(t, got, tt.want)
+	}
+	for _, ptr := range []string{"/missing", "/missing/x", "/arr/3", "/arr/-", "/a~1b/x"} {
+		got, removed, err := DeletePointer(doc, ptr)
+		if err != nil || removed {
+			t.Fatalf("delete %q: removed=%v err=%v", ptr, removed, err)
+		}
+		if !bytes.Equal(got, doc) {
+			t.Fatalf("delete %q changed the document", ptr)
+		}
+	}
+	for _, ptr := range []string{"", "/arr/01", "/s/x", "/arr/0/x", "/~"} {
+		if _, _, err := DeletePointer(doc, ptr); err == nil {
+			t.Fatalf("delete %q: expected error", ptr)
+		}
+	}
+}
+
+func TestTxnPointer(t *testing.T) {
+	d, err := NewDoc(mustJSON(t, pointerTestJSON))
+	if err != nil {
+		t.Fatalf("new doc: %v", err)
+	}
+	err = d.Update(func(tx *Txn) error {
+		if err := tx.SetPointer("/arr/-", Value{Type: TypeI64, I64: 30}, PointerCreateNone); err != nil {
+			return err
+		}
+		if err := tx.SetPointer("/new/0/k~1", Value{Type: TypeBit, Bool: true}, PointerCreateAuto); err != nil {
+			return err
+		}
+		got, ok, err := tx.GetPointer("/arr/3")
+		if err != nil || !ok || got.I64 != 30 {
+			t.Fatalf("get appended: %v %v %v", got, ok, err)
+		}
+		if _, ok, err := tx.GetPointer("/arr/4"); err != nil || ok {
+			t.Fatalf("get past end: %v %v", ok, err)
+		}
+		removed, err := tx.DeletePointer("/arr/0")
+		if err != nil || !removed {
+			t.Fatalf("delete: %v %v", removed, err)
+		}
+		removed, err = tx.DeletePointer("/missing")
+		if err != nil || removed {
+			t.Fatalf("delete missing: %v %v", removed, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	const want = `{"a/b":{"m~n":1},"arr":[20,{"x":true},30],"":{"":"empty"},"s":"str","new":[{"k/":true}]}`
+	assertDocEqual(t, d.Bytes(), want)
+
+	// Deleting the root and a bad set both fail the transaction and leave the
+	// document as it was.
+	for name, fn := range map[string]func(tx *Txn) error{
+		"delete root": func(tx *Txn) error {
+			_, err := tx.DeletePointer("")
+			return err
+		},
+		"missing intermediate": func(tx *Txn) error {
+			return tx.SetPointer("/none/x", Value{Type: TypeNil}, PointerCreateNone)
+		},
+		"out of range": func(tx *Txn) error {
+			return tx.SetPointer("/arr/9", Value{Type: TypeNil}, PointerCreateNone)
+		},
+	} {
+		before := d.Bytes()
+		err := d.Update(func(tx *Txn) error {
+			if err := fn(tx); err == nil {
+				t.Fatalf("%s: expected error", name)
+			}
+			// The transaction stays failed after the error.
+			return tx.SetPointer("/s", Value{Type: TypeNil}, PointerCreateNone)
+		})
+		if err == nil {
+			t.Fatalf("%s: update committed", name)
+		}
+		if !bytes.Equal(d.Bytes(), before) {
+			t.Fatalf("%s: document changed", name)
+		}
+	}
+	assertDocEqual(t, d.Bytes(), want)
+}
+
+func TestParsePointerIndex(t *testing.T) {
+	for _, tt := range []struct {
+		tok  string
+		want uint32
+	}{
+		{"0", 0},
+		{"7", 7},
+		{"10", 10},
+		{"-", 3},
+		{"4294967295", 4294967295},
+	} {
+		got, err := ParsePointerIndex(tt.tok, 3)
+		if err != nil || got != tt.want {
+			t.Fatalf("index %q = %d, %v; want %d", tt.tok, got, err, tt.want)
+		}
+	}
+	for _, tok := range []string{"", "00", "01", "-1", "+1", "1.0", "0x1", " 1", "a", "--", "4294967296"} {
+		if _, err := ParsePointerIndex(tok, 3); err == nil {
+			t.Fatalf("index %q: expected error", tok)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package tron
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// errStopRange is returned by range callbacks to end iteration early.
+var errStopRange = errors.New("tron: stop range")
+
+// MapRange returns an iterator over the key/value entries of the map node at off.
+// Entries are yielded in HAMT order. Key bytes alias doc.
+// Iteration stops silently on malformed nodes; use MapRangeErr or MapEach to
+// observe errors.
+func MapRange(doc []byte, off uint32) iter.Seq2[[]byte, Value] {
+	return func(yield func([]byte, Value) bool) {
+		_ = mapEach(doc, off, 0, func(key []byte, val Value) error {
+			if !yield(key, val) {
+				return errStopRange
+			}
+			return nil
+		})
+	}
+}
+
+// MapRangeErr is like MapRange but also returns a function reporting the
+// error that ended the most recent iteration, or nil when it completed or the
+// loop broke early.
+func MapRangeErr(doc []byte, off uint32) (iter.Seq2[[]byte, Value], func() error) {
+	var err error
+	seq := func(yield func([]byte, Value) bool) {
+		err = MapEach(doc, off, func(key []byte, val Value) error {
+			if !yield(key, val) {
+				return errStopRange
+			}
+			return nil
+		})
+	}
+	return seq, func() error { return err }
+}
+
+// ArrRange returns an iterator over the present elements of the array node at off.
+// Elements are yielded in index order together with their index.
+// Iteration stops silently on malformed nodes; use ArrRangeErr or ArrEach to
+// observe errors.
+func ArrRange(doc []byte, off uint32) iter.Seq2[uint32, Value] {
+	return func(yield func(uint32, Value) bool) {
+		_ = arrEach(doc, off, 0, -1, func(index uint32, val Value) error {
+			if !yield(index, val) {
+				return errStopRange
+			}
+			return nil
+		})
+	}
+}
+
+// ArrRangeErr is like ArrRange but also returns a function reporting the
+// error that ended the most recent iteration, or nil when it completed or the
+// loop broke early.
+func ArrRangeErr(doc []byte, off uint32) (iter.Seq2[uint32, Value], func() error) {
+	var err error
+	seq := func(yield func(uint32, Value) bool) {
+		err = ArrEach(doc, off, func(index uint32, val Value) error {
+			if !yield(index, val) {
+				return errStopRange
+			}
+			return nil
+		})
+	}
+	return seq, func() error { return err }
+}
+
+// MapEach calls fn for every key/value entry of the map node at off.
+// Iteration stops at the first error returned by fn or encountered while walking nodes.
+func MapEach(doc []byte, off uint32, fn func(key []byte, val Value) error) error {
+	err := mapEach(doc, off, 0, fn)
+	if errors.Is(err, errStopRange) {
+		return nil
+	}
+	return err
+}
+
+// ArrEach calls fn for every present element of the array node at off.
+// Iteration stops at the first error returned by fn or encountered while walking nodes.
+func ArrEach(doc []byte, off uint32, fn func(index uint32, val Value) error) error {
+	err := arrEach(doc, off, 0, -1, fn)
+	if errors.Is(err, errStopRange) {
+		return nil
+	}
+	return err
+}
+
+// MapLen returns the number of entries under the map node at off.
+// Keys and values are not decoded.
+func MapLen(doc []byte, off uint32) (int, error) {
+	return mapLen(doc, off, 0)
+}
+
+func mapEach(doc []byte, off uint32, depth int, fn func(key []byte, val Value) error) error {
+	if depth > maxDepth32 {
+		return fmt.Errorf("map depth exceeds max")
+	}
+	h, node, err := NodeSliceAt(doc, off)
+	if err != nil {
+		return err
+	}
+	if h.KeyType != KeyMap {
+		return fmt.Errorf("node is not a map")
+	}
+	p := 1 + h.LenBytes
+	if h.Kind == NodeLeaf {
+		if (int(h.NodeLen)-p)%8 != 0 {
+			return fmt.Errorf("map leaf payload misaligned")
+		}
+		for ; p+8 <= int(h.NodeLen); p += 8 {
+			keyVal, err := DecodeValueAt(doc, binary.LittleEndian.Uint32(node[p:p+4]))
+			if err != nil {
+				return fmt.Errorf("key decode failed: %w", err)
+			}
+			if keyVal.Type != TypeTxt {
+				return fmt.Errorf("map leaf key must be txt")
+			}
+			val, err := DecodeValueAt(doc, binary.LittleEndian.Uint32(node[p+4:p+8]))
+			if err != nil {
+				return fmt.Errorf("value decode failed: %w", err)
+			}
+			if err := fn(keyVal.Bytes, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if int(h.NodeLen) < p+4 {
+		return fmt.Errorf("map branch node too small: %d", h.NodeLen)
+	}
+	bitmap := binary.LittleEndian.Uint32(node[p : p+4])
+	if bitmap&0xFFFF0000 != 0 {
+		return fmt.Errorf("map branch bitmap high bits must be zero")
+	}
+	p += 4
+	count := popcount16(uint16(bitmap))
+	if int(h.NodeLen) < p+count*4 {
+		return fmt.Errorf("child address truncated")
+	}
+	for i := 0; i < count; i++ {
+		child := binary.LittleEndian.Uint32(node[p : p+4])
+		p += 4
+		if err := mapEach(doc, child, depth+1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mapLen(doc []byte, off uint32, depth int) (int, error) {
+	if depth > maxDepth32 {
+		return 0, fmt.Errorf("map depth exceeds max")
+	}
+	h, node, err := NodeSliceAt(doc, off)
+	if err != nil {
+		return 0, err
+	}
+	if h.KeyType != KeyMap {
+		return 0, fmt.Errorf("node is not a map")
+	}
+	p := 1 + h.LenBytes
+	if h.Kind == NodeLeaf {
+		payloadLen := int(h.NodeLen) - p
+		if payloadLen%8 != 0 {
+			return 0, fmt.Errorf("map leaf payload misaligned")
+		}
+		return payloadLen / 8, nil
+	}
+	if int(h.NodeLen) < p+4 {
+		return 0, fmt.Errorf("map branch node too small: %d", h.NodeLen)
+	}
+	bitmap := binary.LittleEndian.Uint32(node[p : p+4])
+	if bitmap&0xFFFF0000 != 0 {
+		return 0, fmt.Errorf("map branch bitmap high bits must be zero")
+	}
+	p += 4
+	count := popcount16(uint16(bitmap))
+	if int(h.NodeLen) < p+count*4 {
+		return 0, fmt.Errorf("child address truncated")
+	}
+	total := 0
+	for i := 0; i < count; i++ {
+		n, err := mapLen(doc, binary.LittleEndian.Uint32(node[p:p+4]), depth+1)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+		p += 4
+	}
+	return total, nil
+}
+
+// arrEach walks an array subtree rooted at off. base is the index of the
+// subtree's first slot; wantShift is the shift the node must carry, or -1 for
+// a root whose shift is read from the node itself.
+func arrEach(doc []byte, off uint32, base uint32, wantShift int, fn func(index uint32, val Value) error) error {
+	h, node, err := NodeSliceAt(doc, off)
+	if err != nil {
+		return err
+	}
+	if h.KeyType != KeyArr {
+		return fmt.Errorf("node is not an array")
+	}
+	isRoot := wantShift < 0
+	if !isRoot && h.IsRoot {
+		return fmt.Errorf("array non-root node marked as root")
+	}
+	p := 1 + h.LenBytes
+	if int(h.NodeLen) < p+3 {
+		return fmt.Errorf("array node too small: %d", h.NodeLen)
+	}
+	shift := node[p]
+	p++
+	if shift%4 != 0 || shift > 28 {
+		return fmt.Errorf("array node shift invalid: %d", shift)
+	}
+	if !isRoot && int(shift) != wantShift {
+		return fmt.Errorf("array child shift %d, want %d", shift, wantShift)
+	}
+	bitmap := binary.LittleEndian.Uint16(node[p : p+2])
+	p += 2
+	if h.IsRoot {
+		p += 4
+	}
+	count := popcount16(bitmap)
+	if int(h.NodeLen) < p+count*4 {
+		return fmt.Errorf("array node addresses truncated")
+	}
+	if h.Kind == NodeLeaf {
+		if shift != 0 {
+			return fmt.Errorf("array leaf shift must be 0")
+		}
+		for slot := uint32(0); slot < 16; slot++ {
+			if (bitmap>>slot)&1 == 0 {
+				continue
+			}
+			val, err := DecodeValueAt(doc, binary.LittleEndian.Uint32(node[p:p+4]))
+			if err != nil {
+				return err
+			}
+			p += 4
+			if err := fn(base+slot, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if shift == 0 {
+		return fmt.Errorf("array branch shift must be non-zero")
+	}
+	for slot := uint32(0); slot < 16; slot++ {
+		if (bitmap>>slot)&1 == 0 {
+			continue
+		}
+		child := binary.LittleEndian.Uint32(node[p : p+4])
+		p += 4
+		if err := arrEach(doc, child, base+(slot<<shift), int(shift)-4, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
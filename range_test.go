@@ -0,0 +1,156 @@
+package tron
+
+import (
+	"encoding/binary"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestMapRangeMatchesMapEach(t *testing.T) {
+	for _, n := range []int{0, 1, 15, 16, 17, 300} {
+		b := NewBuilder()
+		mb := NewMapBuilder()
+		for i := range n {
+			mb.SetString(string(rune('a'+i%26))+string(rune('0'+i/26)), Value{Type: TypeI64, I64: int64(i)})
+		}
+		root, err := mb.Build(b)
+		if err != nil {
+			t.Fatalf("build %d: %v", n, err)
+		}
+		doc := b.BytesWithTrailer(root, 0)
+		var want []string
+		err = MapEach(doc, root, func(key []byte, _ Value) error {
+			want = append(want, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("each %d: %v", n, err)
+		}
+		var got []string
+		seq, errf := MapRangeErr(doc, root)
+		for key := range seq {
+			got = append(got, string(key))
+		}
+		if err := errf(); err != nil {
+			t.Fatalf("range %d: %v", n, err)
+		}
+		if !slices.Equal(got, want) || len(got) != n {
+			t.Fatalf("range %d gave %d keys, each gave %d", n, len(got), len(want))
+		}
+		if count, err := MapLen(doc, root); err != nil || count != n {
+			t.Fatalf("len %d = %d, %v", n, count, err)
+		}
+		sort.Strings(got)
+		if len(slices.Compact(got)) != n {
+			t.Fatalf("range %d repeated keys", n)
+		}
+	}
+}
+
+func TestArrRangeSparse(t *testing.T) {
+	b := NewBuilder()
+	root, err := NewArrayBuilder().Build(b)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	present := []uint32{0, 3, 17, 256, 4097}
+	length := present[len(present)-1] + 10
+	for _, i := range present {
+		root, err = ArraySetNode(b, root, i, Value{Type: TypeI64, I64: int64(i) * 2}, length)
+		if err != nil {
+			t.Fatalf("set %d: %v", i, err)
+		}
+	}
+	doc := b.BytesWithTrailer(root, 0)
+	if got, err := ArrayRootLength(doc, root); err != nil || got != length {
+		t.Fatalf("length = %d, %v; want %d", got, err, length)
+	}
+	var got []uint32
+	seq, errf := ArrRangeErr(doc, root)
+	for i, v := range seq {
+		if v.I64 != int64(i)*2 {
+			t.Fatalf("index %d holds %d", i, v.I64)
+		}
+		got = append(got, i)
+	}
+	if err := errf(); err != nil {
+		t.Fatalf("range: %v", err)
+	}
+	if !slices.Equal(got, present) {
+		t.Fatalf("indices %v, want %v", got, present)
+	}
+}
+
+func TestRangeBreak(t *testing.T) {
+	doc := mustJSON(t, `{"a":[1,2,3,4,5],"b":2,"c":3,"d":4}`)
+	root := mustRoot(t, doc)
+	seen := 0
+	seq, errf := MapRangeErr(doc, root.Offset)
+	for range seq {
+		seen++
+		if seen == 2 {
+			break
+		}
+	}
+	if seen != 2 || errf() != nil {
+		t.Fatalf("map break after %d entries, err %v", seen, errf())
+	}
+	arr, ok, err := MapGet(doc, root.Offset, []byte("a"))
+	if err != nil || !ok {
+		t.Fatalf("get a: %v %v", ok, err)
+	}
+	var got []uint32
+	for i := range ArrRange(doc, arr.Offset) {
+		if i == 3 {
+			break
+		}
+		got = append(got, i)
+	}
+	if !slices.Equal(got, []uint32{0, 1, 2}) {
+		t.Fatalf("array break gave %v", got)
+	}
+}
+
+func TestRangeReportsMalformedNodes(t *testing.T) {
+	doc := mustJSON(t, `{"a":1,"b":[1,2]}`)
+	root := mustRoot(t, doc)
+	arr, _, err := MapGet(doc, root.Offset, []byte("b"))
+	if err != nil {
+		t.Fatalf("get b: %v", err)
+	}
+	bad := slices.Clone(doc)
+	// Point the first value address of the array leaf past the document.
+	h, _, err := NodeSliceAt(bad, arr.Offset)
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	addr := int(arr.Offset) + 1 + int(h.LenBytes) + 1 + 2 + 4
+	binary.LittleEndian.PutUint32(bad[addr:], uint32(len(bad)+100))
+
+	seq, errf := ArrRangeErr(bad, arr.Offset)
+	for range seq {
+		t.Fatalf("yielded a value from a malformed leaf")
+	}
+	if errf() == nil {
+		t.Fatalf("range over a malformed array reported no error")
+	}
+	for range ArrRange(bad, arr.Offset) {
+		t.Fatalf("yielded a value from a malformed leaf")
+	}
+
+	mseq, merrf := MapRangeErr(bad, root.Offset)
+	keys := 0
+	for range mseq {
+		keys++
+	}
+	if merrf() != nil || keys != 2 {
+		t.Fatalf("map range over intact nodes: %d keys, %v", keys, merrf())
+	}
+	mseq, merrf = MapRangeErr(bad, arr.Offset)
+	for range mseq {
+	}
+	if merrf() == nil {
+		t.Fatalf("map range over an array reported no error")
+	}
+}
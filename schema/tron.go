@@ -49,6 +49,11 @@ func (sch *Schema) ValidateTRON(doc []byte) error {
 	return sch.Validate(value)
 }
 
+// InstanceValue returns the value in doc at the error's instance location.
+func (ve *ValidationError) InstanceValue(doc []byte) (tron.Value, bool, error) {
+	return tron.GetPointer(doc, jsonPtr(ve.InstanceLocation))
+}
+
 type tronLoader struct{}
 
 func (tronLoader) Load(url string) (any, error) {
@@ -0,0 +1,70 @@
+package tron
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot is a committed version of a Shared document. Doc includes the
+// trailer and is never modified, so it can be read without locking for as
+// long as the caller holds it.
+type Snapshot struct {
+	Doc     []byte
+	Trailer Trailer
+}
+
+// Root returns the snapshot root value.
+func (s Snapshot) Root() (Value, error) {
+	return DecodeValueAt(s.Doc, s.Trailer.RootOffset)
+}
+
+// Shared is a document handle for many concurrent readers and one writer at
+// a time. Readers take snapshots without locking; writers are serialized and
+// publish each commit atomically.
+//
+// Commits only append after the last trailer, and a buffer that outgrows its
+// capacity is copied rather than resized in place, so a snapshot stays valid
+// and unchanged however far the document grows after it was taken.
+type Shared struct {
+	mu   sync.Mutex
+	doc  *Doc
+	snap atomic.Pointer[Snapshot]
+}
+
+// NewShared copies doc into a new shared handle.
+func NewShared(doc []byte) (*Shared, error) {
+	d, err := NewDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	s := &Shared{doc: d}
+	s.publish()
+	return s, nil
+}
+
+// Snapshot returns the latest committed version.
+func (s *Shared) Snapshot() Snapshot {
+	return *s.snap.Load()
+}
+
+// Update runs fn in a transaction and publishes the result when fn returns
+// nil. Updates are serialized; readers see either the previous snapshot or
+// the new one, never a partial commit. If fn panics the transaction is
+// rolled back and the lock released before the panic continues. fn must only
+// append through the transaction and must not keep the Txn after returning.
+func (s *Shared) Update(fn func(tx *Txn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.doc.committed
+	if err := s.doc.Update(fn); err != nil {
+		return err
+	}
+	if s.doc.committed != prev {
+		s.publish()
+	}
+	return nil
+}
+
+func (s *Shared) publish() {
+	s.snap.Store(&Snapshot{Doc: s.doc.Bytes(), Trailer: s.doc.Trailer()})
+}
@@ -0,0 +1,78 @@
+package tron
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSharedSnapshotsDuringUpdates(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"n":0,"log":[]}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	s, err := NewShared(doc)
+	if err != nil {
+		t.Fatalf("new shared: %v", err)
+	}
+	const updates = 200
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := int64(-1)
+			for !done.Load() {
+				snap := s.Snapshot()
+				if err := Verify(snap.Doc, VerifyLimits{}); err != nil {
+					errs <- err
+					return
+				}
+				c := NewCursor(snap.Doc)
+				n := c.Key("n").Int64()
+				if err := c.Err(); err != nil {
+					errs <- err
+					return
+				}
+				if n < last {
+					errs <- fmt.Errorf("snapshot n=%d after n=%d", n, last)
+					return
+				}
+				last = n
+			}
+		}()
+	}
+	for i := int64(1); i <= updates; i++ {
+		if i%50 == 0 {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("update %d did not panic", i)
+					}
+				}()
+				s.Update(func(tx *Txn) error {
+					tx.SetKey("n", Value{Type: TypeI64, I64: -1})
+					panic("boom")
+				})
+			}()
+		}
+		err := s.Update(func(tx *Txn) error {
+			return tx.SetKey("n", Value{Type: TypeI64, I64: i})
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	done.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("reader: %v", err)
+	}
+	if n := NewCursor(s.Snapshot().Doc).Key("n").Int64(); n != updates {
+		t.Fatalf("n = %d, want %d", n, updates)
+	}
+}
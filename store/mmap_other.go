@@ -0,0 +1,26 @@
+//go:build !(darwin || dragonfly || freebsd || linux || openbsd)
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the file into memory where mmap is unavailable. Commits are
+// then written to the file with WriteAt.
+func mapFile(f *os.File, size int) ([]byte, bool, error) {
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	return data, false, nil
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
+
+func syncMapping([]byte) error {
+	return nil
+}
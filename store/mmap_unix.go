@@ -0,0 +1,30 @@
+//go:build darwin || dragonfly || freebsd || linux || openbsd
+
+package store
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func mapFile(f *os.File, size int) ([]byte, bool, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, false, os.NewSyscallError("mmap", err)
+	}
+	return data, true, nil
+}
+
+func unmapFile(data []byte) error {
+	return os.NewSyscallError("munmap", syscall.Munmap(data))
+}
+
+// syncMapping writes the dirty pages of data back to the file.
+func syncMapping(data []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return os.NewSyscallError("msync", errno)
+	}
+	return nil
+}
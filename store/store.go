@@ -0,0 +1,343 @@
+// Package store keeps a TRON document in a file and commits updates by
+// appending nodes and a trailer, so every commit is a new root in the
+// document's history.
+//
+// The file is memory-mapped where the platform allows it: Bytes returns the
+// mapped document, and tron.MapGet, tron.ArrGet and friends read it without
+// copying. Each commit is flushed to disk before Update returns. Open recovers
+// from a crash mid-commit by scanning backwards for the last complete trailer
+// and truncating the torn tail.
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+// minMapSize is the smallest mapping made for a store file. Room beyond the
+// committed document lets transactions append in place.
+const minMapSize = 1 << 20
+
+// ErrClosed is returned by operations on a closed store.
+var ErrClosed = errors.New("store: closed")
+
+// Store is a TRON document file opened for reading and appending.
+// It is safe for concurrent use. Updates are serialized.
+type Store struct {
+	mu   sync.Mutex
+	f    *os.File
+	data []byte
+	// mapped reports whether data is a shared mapping of the file. When it
+	// is not, commits are written with WriteAt.
+	mapped bool
+	// retired holds earlier mappings, which stay valid for readers of
+	// earlier Bytes results until Close.
+	retired   [][]byte
+	doc       *tron.Doc
+	size      int64
+	recovered int64
+}
+
+// Create writes doc to a new file at path and opens it.
+// It fails if the file already exists.
+func Create(path string, doc []byte) (*Store, error) {
+	if _, err := tron.DetectDocType(doc); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteAt(doc, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return open(f)
+}
+
+// Open opens the document file at path, truncating any incomplete commit
+// left by a crash.
+func Open(path string) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return open(f)
+}
+
+func open(f *os.File) (*Store, error) {
+	s := &Store{f: f}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load maps the file, recovers the last complete commit and wraps it.
+func (s *Store) load() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+	if fileSize > math.MaxUint32 {
+		return fmt.Errorf("file too large: %d bytes", fileSize)
+	}
+	if err := s.remap(fileSize, fileSize); err != nil {
+		return err
+	}
+	size, err := lastCommit(s.data[:fileSize])
+	if err != nil {
+		return err
+	}
+	if size < fileSize {
+		s.recovered = tornBytes(s.data[:fileSize], size)
+		if err := s.f.Truncate(size); err != nil {
+			return err
+		}
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+		// Truncating cut the file short of the mapping; nothing reads the
+		// mapping yet, so replace it with one backed by the file again.
+		data := s.data
+		s.data = nil
+		if err := unmapFile(data); err != nil {
+			return err
+		}
+		if err := s.remap(size, size); err != nil {
+			return err
+		}
+	}
+	s.size = size
+	return s.wrap()
+}
+
+// remap maps the file with room for at least need bytes, keeping the current
+// mapping alive for earlier readers.
+func (s *Store) remap(fileSize, need int64) error {
+	mapSize := max(int64(minMapSize), need*2)
+	mapSize = min(mapSize, math.MaxUint32, math.MaxInt)
+	if mapSize > fileSize {
+		if err := s.f.Truncate(mapSize); err != nil {
+			return err
+		}
+	}
+	data, mapped, err := mapFile(s.f, int(mapSize))
+	if err != nil {
+		return err
+	}
+	if s.data != nil {
+		s.retired = append(s.retired, s.data)
+	}
+	s.data, s.mapped = data, mapped
+	return nil
+}
+
+func (s *Store) wrap() error {
+	doc, err := tron.WrapDoc(s.data[:s.size])
+	if err != nil {
+		return err
+	}
+	s.doc = doc
+	return nil
+}
+
+// Bytes returns the committed document. The slice stays valid, and its
+// contents unchanged, until Close, even as later commits are appended.
+func (s *Store) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.doc == nil {
+		return nil
+	}
+	return s.doc.Bytes()
+}
+
+// Root returns the root value of the committed document.
+func (s *Store) Root() (tron.Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.doc == nil {
+		return tron.Value{}, ErrClosed
+	}
+	return s.doc.Root()
+}
+
+// Recovered returns the number of bytes of incomplete commits truncated after
+// the last complete commit when the store was opened. Zero padding left by
+// the space reserved for the mapping is not counted.
+func (s *Store) Recovered() int64 {
+	return s.recovered
+}
+
+// Update runs fn in a transaction on the document. When fn returns nil the
+// new nodes and trailer are appended to the file and flushed to disk before
+// Update returns. When fn or the flush fails nothing is committed.
+func (s *Store) Update(fn func(tx *tron.Txn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.doc == nil {
+		return ErrClosed
+	}
+	if err := s.doc.Update(fn); err != nil {
+		return err
+	}
+	buf := s.doc.Bytes()
+	if int64(len(buf)) == s.size {
+		return nil
+	}
+	if err := s.flush(buf); err != nil {
+		// The commit may be partly on disk; clear its trailer so a reopen
+		// cannot recover it, and drop it from memory so the file and handle
+		// agree.
+		return errors.Join(err, s.discard(buf), s.wrap())
+	}
+	s.size = int64(len(buf))
+	if s.inData(buf) {
+		return nil
+	}
+	// The transaction outgrew the mapping and moved to the heap; map the
+	// file again so later reads are zero-copy.
+	if err := s.remap(s.size, s.size); err != nil {
+		return err
+	}
+	return s.wrap()
+}
+
+// flush makes buf[s.size:] durable. The new nodes reach the disk before the
+// trailer that names them, so a crash between the two leaves the previous
+// commit as the last one.
+func (s *Store) flush(buf []byte) error {
+	nodes := int64(len(buf)) - tron.TrailerSize
+	if s.mapped && s.inData(buf) {
+		// The transaction already wrote the trailer into the mapping; hold it
+		// back until the nodes are synced.
+		var trailer [tron.TrailerSize]byte
+		copy(trailer[:], s.data[nodes:len(buf)])
+		clear(s.data[nodes:len(buf)])
+		err := syncMapping(s.data[:nodes])
+		copy(s.data[nodes:], trailer[:])
+		if err != nil {
+			return err
+		}
+		if err := syncMapping(s.data[:len(buf)]); err != nil {
+			return err
+		}
+		return s.f.Sync()
+	}
+	if _, err := s.f.WriteAt(buf[s.size:nodes], s.size); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(buf[nodes:], nodes); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// discard zeroes the trailer of a commit whose flush failed, in the mapping
+// and in the file.
+func (s *Store) discard(buf []byte) error {
+	start := int64(len(buf)) - tron.TrailerSize
+	if s.inData(buf) {
+		clear(s.data[start:len(buf)])
+		if s.mapped {
+			return syncMapping(s.data[:len(buf)])
+		}
+	}
+	_, err := s.f.WriteAt(make([]byte, tron.TrailerSize), start)
+	return err
+}
+
+// inData reports whether buf starts at the current mapping, that is whether
+// the transaction appended in place.
+func (s *Store) inData(buf []byte) bool {
+	return len(buf) > 0 && &buf[0] == &s.data[0]
+}
+
+// Close truncates the file to the committed document and releases it.
+// Slices returned by Bytes must not be used afterwards.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.doc == nil {
+		return ErrClosed
+	}
+	s.doc = nil
+	errs := []error{s.f.Truncate(s.size), s.f.Sync()}
+	for _, data := range append(s.retired, s.data) {
+		errs = append(errs, unmapFile(data))
+	}
+	s.retired, s.data = nil, nil
+	errs = append(errs, s.f.Close())
+	return errors.Join(errs...)
+}
+
+// lastCommit returns the length of the longest prefix of data that ends with
+// a complete commit: a trailer directly after the root node it names, whose
+// graph verifies. The check catches commits whose trailer reached the disk
+// but whose nodes did not, for instance when the kernel wrote back a dirty
+// page of the mapping early; recovery then falls back to an earlier trailer.
+func lastCommit(data []byte) (int64, error) {
+	magic := len(tron.HeaderMagic)
+	if len(data) < magic || string(data[:magic]) != string(tron.HeaderMagic[:]) {
+		return 0, fmt.Errorf("missing TRON header magic")
+	}
+	for end := len(data); end >= magic+tron.TrailerSize; end-- {
+		if validTrailer(data[:end]) && tron.Verify(data[:end], recoverLimits) == nil {
+			return int64(end), nil
+		}
+	}
+	return 0, fmt.Errorf("no complete commit found")
+}
+
+// tornBytes returns how many bytes after the commit ending at size belong to
+// incomplete commits: up to the last nonzero byte, or to the end of a trailer
+// that failed verification when its high bytes are zero. The zero padding
+// reserved for the mapping is not counted.
+func tornBytes(data []byte, size int64) int64 {
+	end := int64(len(data))
+	for end > size && data[end-1] == 0 {
+		end--
+	}
+	for e := min(end+tron.TrailerSize-1, int64(len(data))); e > end; e-- {
+		if validTrailer(data[:e]) {
+			return e - size
+		}
+	}
+	return end - size
+}
+
+// recoverLimits lift the Verify defaults; any document the store committed
+// must be recoverable.
+var recoverLimits = tron.VerifyLimits{MaxDepth: math.MaxInt, MaxNodes: math.MaxInt}
+
+// validTrailer reports whether doc ends with a trailer whose root node parses
+// and ends where the trailer begins.
+func validTrailer(doc []byte) bool {
+	start := len(doc) - tron.TrailerSize
+	root := binary.LittleEndian.Uint32(doc[start:])
+	prev := binary.LittleEndian.Uint32(doc[start+4:])
+	if root < uint32(len(tron.HeaderMagic)) || int64(root) >= int64(start) || prev > root {
+		return false
+	}
+	h, _, err := tron.NodeSliceAt(doc[:start], root)
+	if err != nil {
+		return false
+	}
+	return int64(root)+int64(h.NodeLen) == int64(start)
+}
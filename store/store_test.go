@@ -0,0 +1,230 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tron "github.com/starfederation/tron-go"
+)
+
+func TestStoreRecoversTornCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.tron")
+	doc, err := tron.FromJSON([]byte(`{"count":0}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	s, err := Create(path, doc)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	first := s.Bytes()
+	for i := int64(1); i <= 3; i++ {
+		err := s.Update(func(tx *tron.Txn) error {
+			return tx.SetKey("count", tron.Value{Type: tron.TypeI64, I64: i})
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	if got := mustJSON(t, first); got != `{"count":0}` {
+		t.Fatalf("first snapshot changed: %s", got)
+	}
+	committed := s.Bytes()
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// Simulate a crash part way through the next commit.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := f.Write([]byte{0x2c, 0x05, 0x00, 0x00, 0x00, 0x10}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	if s.Recovered() != 6 {
+		t.Fatalf("recovered %d bytes, want 6", s.Recovered())
+	}
+	if got, want := mustJSON(t, s.Bytes()), mustJSON(t, committed); got != want {
+		t.Fatalf("recovered %s, want %s", got, want)
+	}
+	if got := mustJSON(t, s.Bytes()); got != `{"count":3}` {
+		t.Fatalf("recovered %s", got)
+	}
+}
+
+func TestStoreCommitsAfterRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.tron")
+	doc, err := tron.FromJSON([]byte(`{"count":0}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	if err := os.WriteFile(path, append(doc, 0x2c, 0x05, 0x01), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	if s.Recovered() != 3 {
+		t.Fatalf("recovered %d bytes, want 3", s.Recovered())
+	}
+	blob := make([]byte, 64<<10)
+	err = s.Update(func(tx *tron.Txn) error {
+		if err := tx.SetKey("count", tron.Value{Type: tron.TypeI64, I64: 1}); err != nil {
+			return err
+		}
+		return tx.SetKey("blob", tron.Value{Type: tron.TypeBin, Bytes: blob})
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// Reopen without closing, as after a crash.
+	again, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer again.Close()
+	if again.Recovered() != 0 {
+		t.Fatalf("recovered %d bytes of mapping padding", again.Recovered())
+	}
+	root, err := again.Root()
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	count, ok, err := tron.MapGet(again.Bytes(), root.Offset, []byte("count"))
+	if err != nil || !ok || count.I64 != 1 {
+		t.Fatalf("count = %v, ok=%v err=%v", count, ok, err)
+	}
+	v, ok, err := tron.MapGet(again.Bytes(), root.Offset, []byte("blob"))
+	if err != nil || !ok || len(v.Bytes) != len(blob) {
+		t.Fatalf("get blob: ok=%v err=%v len=%d", ok, err, len(v.Bytes))
+	}
+}
+
+func TestStoreSkipsTrailerWithoutNodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.tron")
+	doc, err := tron.FromJSON([]byte(`{"a":{"b":1}}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	s, err := Create(path, doc)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	before := int64(len(s.Bytes()))
+	err = s.Update(func(tx *tron.Txn) error {
+		return tx.SetPointer("/a/b", tron.Value{Type: tron.TypeI64, I64: 2}, tron.PointerCreateNone)
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	after := s.Bytes()
+	tr, err := tron.ParseTrailer(after)
+	if err != nil {
+		t.Fatalf("trailer: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// Simulate a crash where the trailer and root reached the disk but the
+	// nested nodes of the commit did not.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if int64(tr.RootOffset) <= before {
+		t.Fatalf("commit wrote no nodes before its root")
+	}
+	clear(data[before:tr.RootOffset])
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	if got := int64(len(s.Bytes())); got != before {
+		t.Fatalf("recovered %d bytes, want the %d byte first commit", got, before)
+	}
+	if got, want := s.Recovered(), int64(len(data))-before; got != want {
+		t.Fatalf("recovered %d bytes, want %d", got, want)
+	}
+	if got := mustJSON(t, s.Bytes()); got != `{"a":{"b":1}}` {
+		t.Fatalf("recovered %s", got)
+	}
+}
+
+func TestStoreGrowsPastMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.tron")
+	doc, err := tron.FromJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	s, err := Create(path, doc)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	first := s.Bytes()
+	blob := make([]byte, minMapSize/4)
+	for i := range 8 {
+		err := s.Update(func(tx *tron.Txn) error {
+			return tx.SetKey(string(rune('a'+i)), tron.Value{Type: tron.TypeBin, Bytes: blob})
+		})
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	if got := mustJSON(t, first); got != `{}` {
+		t.Fatalf("first snapshot changed: %s", got)
+	}
+	size := int64(len(s.Bytes()))
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size() != size {
+		t.Fatalf("file size %d, want %d", info.Size(), size)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	if s.Recovered() != 0 {
+		t.Fatalf("recovered %d bytes from a clean file", s.Recovered())
+	}
+	root, err := s.Root()
+	if err != nil {
+		t.Fatalf("root: %v", err)
+	}
+	v, ok, err := tron.MapGet(s.Bytes(), root.Offset, []byte("h"))
+	if err != nil || !ok || len(v.Bytes) != len(blob) {
+		t.Fatalf("get h: ok=%v err=%v len=%d", ok, err, len(v.Bytes))
+	}
+}
+
+func mustJSON(t *testing.T, doc []byte) string {
+	t.Helper()
+	out, err := tron.ToJSON(doc)
+	if err != nil {
+		t.Fatalf("to json: %v", err)
+	}
+	return out
+}
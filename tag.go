@@ -14,6 +14,30 @@ const (
 	TypeMap
 )
 
+// String returns the lowercase TRON name of the type.
+func (t ValueType) String() string {
+	switch t {
+	case TypeNil:
+		return "nil"
+	case TypeBit:
+		return "bit"
+	case TypeI64:
+		return "i64"
+	case TypeF64:
+		return "f64"
+	case TypeTxt:
+		return "txt"
+	case TypeBin:
+		return "bin"
+	case TypeArr:
+		return "arr"
+	case TypeMap:
+		return "map"
+	default:
+		return "unknown"
+	}
+}
+
 const (
 	TagNil      byte = 0x00 // 00000000
 	TagBitFalse byte = 0x01 // 00000001
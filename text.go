@@ -0,0 +1,504 @@
+package tron
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTextDepth bounds nesting in ParseText input.
+const maxTextDepth = 10000
+
+// TextOptions controls WriteText. The zero value writes the whole document on
+// one line with bin values in hex.
+type TextOptions struct {
+	// Indent puts each array element and map entry on its own line,
+	// indented by Indent once per level.
+	Indent string
+	// Base64 writes bin values as b64'..' instead of h'..'.
+	Base64 bool
+}
+
+// WriteText writes doc in TRON text notation, a JSON-like diagnostic format
+// that keeps every TRON type distinct:
+//
+//	{"id": 7, "score": 7.0, "name": "ada", "key": h'00ff', "tags": [1, undefined, 3]}
+//
+// Integers are i64 and numbers with a fraction or exponent are f64, so 1 and
+// 1.0 differ; NaN, Infinity and -Infinity are f64 too. Txt values are quoted
+// with Go escapes, bin values are h'..' hex or b64'..' standard base64, and
+// undefined marks an array index with no value.
+//
+// Map entries holding scalars come first in stored order, followed by those
+// holding arrays and maps in the order their nodes appear in doc. ParseText
+// writes nodes in text order, so parsing the output of a document encoded in
+// one pass, as FromJSON and ParseText produce, yields identical bytes.
+func WriteText(w io.Writer, doc []byte, opts TextOptions) error {
+	root, err := documentRoot(doc)
+	if err != nil {
+		return err
+	}
+	tw := textWriter{
+		w:    bufio.NewWriterSize(w, 32<<10),
+		doc:  doc,
+		opts: opts,
+	}
+	if err := tw.value(root, 0); err != nil {
+		return err
+	}
+	return tw.w.Flush()
+}
+
+type textWriter struct {
+	w    *bufio.Writer
+	doc  []byte
+	opts TextOptions
+}
+
+func (tw *textWriter) newline(depth int) {
+	if tw.opts.Indent == "" {
+		return
+	}
+	tw.w.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		tw.w.WriteString(tw.opts.Indent)
+	}
+}
+
+func (tw *textWriter) separator(depth int) {
+	tw.w.WriteByte(',')
+	if tw.opts.Indent == "" {
+		tw.w.WriteByte(' ')
+	}
+	tw.newline(depth)
+}
+
+func (tw *textWriter) value(v Value, depth int) error {
+	switch v.Type {
+	case TypeNil:
+		tw.w.WriteString("null")
+	case TypeBit:
+		if v.Bool {
+			tw.w.WriteString("true")
+		} else {
+			tw.w.WriteString("false")
+		}
+	case TypeI64:
+		tw.w.Write(strconv.AppendInt(tw.w.AvailableBuffer(), v.I64, 10))
+	case TypeF64:
+		tw.w.WriteString(formatTextFloat(v.F64))
+	case TypeTxt:
+		tw.w.Write(strconv.AppendQuote(tw.w.AvailableBuffer(), string(v.Bytes)))
+	case TypeBin:
+		if tw.opts.Base64 {
+			tw.w.WriteString("b64'")
+			tw.w.WriteString(base64.StdEncoding.EncodeToString(v.Bytes))
+		} else {
+			tw.w.WriteString("h'")
+			tw.w.WriteString(hex.EncodeToString(v.Bytes))
+		}
+		tw.w.WriteByte('\'')
+	case TypeArr:
+		return tw.array(v.Offset, depth)
+	case TypeMap:
+		return tw.object(v.Offset, depth)
+	default:
+		return fmt.Errorf("unknown value type %d", v.Type)
+	}
+	return nil
+}
+
+// formatTextFloat formats f so that it always parses back as an f64.
+func formatTextFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func (tw *textWriter) array(off uint32, depth int) error {
+	length, err := arrayRootLength(tw.doc, off)
+	if err != nil {
+		return err
+	}
+	if length == 0 {
+		tw.w.WriteString("[]")
+		return nil
+	}
+	tw.w.WriteByte('[')
+	tw.newline(depth + 1)
+	next := uint32(0)
+	err = ArrEach(tw.doc, off, func(index uint32, val Value) error {
+		for ; next < index; next++ {
+			if next > 0 {
+				tw.separator(depth + 1)
+			}
+			tw.w.WriteString("undefined")
+		}
+		if index > 0 {
+			tw.separator(depth + 1)
+		}
+		next = index + 1
+		return tw.value(val, depth+1)
+	})
+	if err != nil {
+		return err
+	}
+	for ; next < length; next++ {
+		if next > 0 {
+			tw.separator(depth + 1)
+		}
+		tw.w.WriteString("undefined")
+	}
+	tw.newline(depth)
+	tw.w.WriteByte(']')
+	return nil
+}
+
+func (tw *textWriter) object(off uint32, depth int) error {
+	var entries []MapLeafEntry
+	err := MapEach(tw.doc, off, func(key []byte, val Value) error {
+		entries = append(entries, MapLeafEntry{Key: key, Value: val})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		tw.w.WriteString("{}")
+		return nil
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Value, entries[j].Value
+		aNode := a.Type == TypeArr || a.Type == TypeMap
+		bNode := b.Type == TypeArr || b.Type == TypeMap
+		if aNode != bNode {
+			return bNode
+		}
+		return aNode && a.Offset < b.Offset
+	})
+	tw.w.WriteByte('{')
+	tw.newline(depth + 1)
+	for i, entry := range entries {
+		if i > 0 {
+			tw.separator(depth + 1)
+		}
+		tw.w.Write(strconv.AppendQuote(tw.w.AvailableBuffer(), string(entry.Key)))
+		tw.w.WriteString(": ")
+		if err := tw.value(entry.Value, depth+1); err != nil {
+			return err
+		}
+	}
+	tw.newline(depth)
+	tw.w.WriteByte('}')
+	return nil
+}
+
+// ParseText parses a value in the notation written by WriteText and returns
+// it as a TRON document. Whitespace may appear between tokens, and a trailing
+// comma is allowed before ] and }. Duplicate map keys are rejected.
+func ParseText(data []byte) ([]byte, error) {
+	p := textParser{
+		data:      data,
+		builder:   NewBuilder(),
+		workspace: newEncodeWorkspace(),
+	}
+	p.skipSpace()
+	if p.pos == len(data) {
+		return nil, fmt.Errorf("text input is empty")
+	}
+	val, err := p.value(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(data) {
+		return nil, p.errorf("invalid character %q after top-level value", data[p.pos])
+	}
+	switch val.Type {
+	case TypeArr, TypeMap:
+		return p.builder.BytesWithTrailer(val.Offset, 0), nil
+	default:
+		return EncodeScalarDocument(val)
+	}
+}
+
+type textParser struct {
+	data      []byte
+	pos       int
+	builder   *Builder
+	workspace *encodeWorkspace
+}
+
+func (p *textParser) errorf(format string, args ...any) error {
+	return fmt.Errorf(format+" at offset %d", append(args, p.pos)...)
+}
+
+func (p *textParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek skips whitespace and returns the next byte, or 0 at the end of input.
+func (p *textParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+// word consumes the run of letters and digits at the current position.
+func (p *textParser) word() string {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func (p *textParser) value(depth int) (Value, error) {
+	c := p.peek()
+	start := p.pos
+	switch {
+	case p.pos == len(p.data):
+		return Value{}, p.errorf("unexpected end of text")
+	case c == '{':
+		return p.object(depth + 1)
+	case c == '[':
+		return p.array(depth + 1)
+	case c == '"':
+		b, err := p.quoted()
+		if err != nil {
+			return Value{}, err
+		}
+		return Value{Type: TypeTxt, Bytes: b}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	}
+	switch word := p.word(); word {
+	case "null":
+		return Value{Type: TypeNil}, nil
+	case "true":
+		return Value{Type: TypeBit, Bool: true}, nil
+	case "false":
+		return Value{Type: TypeBit, Bool: false}, nil
+	case "NaN":
+		return Value{Type: TypeF64, F64: math.NaN()}, nil
+	case "Infinity":
+		return Value{Type: TypeF64, F64: math.Inf(1)}, nil
+	case "h", "b64":
+		return p.binary(word)
+	}
+	p.pos = start
+	return Value{}, p.errorf("invalid character %q looking for beginning of value", p.data[p.pos])
+}
+
+// quoted reads a Go-escaped string starting at the opening quote.
+func (p *textParser) quoted() ([]byte, error) {
+	start := p.pos
+	for i := start + 1; i < len(p.data); i++ {
+		switch p.data[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(string(p.data[start : i+1]))
+			if err != nil {
+				return nil, p.errorf("invalid string")
+			}
+			p.pos = i + 1
+			return []byte(s), nil
+		}
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *textParser) binary(encoding string) (Value, error) {
+	if p.pos == len(p.data) || p.data[p.pos] != '\'' {
+		return Value{}, p.errorf("expected ' after %s", encoding)
+	}
+	end := strings.IndexByte(string(p.data[p.pos+1:]), '\'')
+	if end < 0 {
+		return Value{}, p.errorf("unterminated %s'' literal", encoding)
+	}
+	body := string(p.data[p.pos+1 : p.pos+1+end])
+	var b []byte
+	var err error
+	if encoding == "h" {
+		b, err = hex.DecodeString(body)
+	} else {
+		b, err = base64.StdEncoding.DecodeString(body)
+	}
+	if err != nil {
+		return Value{}, p.errorf("invalid %s'' literal: %v", encoding, err)
+	}
+	p.pos += end + 2
+	return Value{Type: TypeBin, Bytes: b}, nil
+}
+
+func (p *textParser) number() (Value, error) {
+	start := p.pos
+	if p.data[p.pos] == '-' {
+		p.pos++
+		if p.word() == "Infinity" {
+			return Value{Type: TypeF64, F64: math.Inf(-1)}, nil
+		}
+		p.pos = start + 1
+	}
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-') {
+			break
+		}
+		p.pos++
+	}
+	b := p.data[start:p.pos]
+	if !validJSONNumber(b) {
+		p.pos = start
+		return Value{}, p.errorf("invalid number %q", b)
+	}
+	if strings.ContainsAny(string(b), ".eE") {
+		f, err := strconv.ParseFloat(string(b), 64)
+		if err != nil {
+			p.pos = start
+			return Value{}, p.errorf("number %s out of f64 range", b)
+		}
+		return Value{Type: TypeF64, F64: f}, nil
+	}
+	i, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		p.pos = start
+		return Value{}, p.errorf("integer %s overflows i64", b)
+	}
+	return Value{Type: TypeI64, I64: i}, nil
+}
+
+// listNext consumes the separator after a list element and reports whether
+// the list ended with close.
+func (p *textParser) listNext(close byte) (bool, error) {
+	c := p.peek()
+	if p.pos == len(p.data) {
+		return false, p.errorf("unexpected end of text")
+	}
+	switch c {
+	case ',':
+		p.pos++
+		if p.peek() == close {
+			p.pos++
+			return true, nil
+		}
+		return false, nil
+	case close:
+		p.pos++
+		return true, nil
+	default:
+		return false, p.errorf("invalid character %q, expected , or %c", p.data[p.pos], close)
+	}
+}
+
+func (p *textParser) array(depth int) (Value, error) {
+	if depth > maxTextDepth {
+		return Value{}, p.errorf("exceeded max depth")
+	}
+	p.pos++
+	var entries []arrayEntry
+	length := uint32(0)
+	done := p.peek() == ']'
+	if done {
+		p.pos++
+	}
+	for !done {
+		if length == math.MaxUint32 {
+			return Value{}, p.errorf("array length exceeds u32")
+		}
+		start := p.pos
+		if p.word() != "undefined" {
+			p.pos = start
+			val, err := p.value(depth)
+			if err != nil {
+				return Value{}, err
+			}
+			entries = append(entries, arrayEntry{index: length, value: val})
+		}
+		length++
+		var err error
+		if done, err = p.listNext(']'); err != nil {
+			return Value{}, err
+		}
+	}
+	root, err := buildArrayNode(entries, arrayRootShift(length), length, true, p.workspace)
+	if err != nil {
+		return Value{}, err
+	}
+	off, err := encodeArrayNode(p.builder, root, p.workspace)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeArr, Offset: off}, nil
+}
+
+func (p *textParser) object(depth int) (Value, error) {
+	if depth > maxTextDepth {
+		return Value{}, p.errorf("exceeded max depth")
+	}
+	p.pos++
+	mb := newMapBuilderWithWorkspace(p.workspace)
+	done := p.peek() == '}'
+	if done {
+		p.pos++
+	}
+	for !done {
+		if p.peek() != '"' {
+			return Value{}, p.errorf("expected quoted map key")
+		}
+		key, err := p.quoted()
+		if err != nil {
+			return Value{}, err
+		}
+		if mb.has(key) {
+			return Value{}, p.errorf("duplicate key %q", key)
+		}
+		if p.peek() != ':' {
+			return Value{}, p.errorf("expected : after map key")
+		}
+		p.pos++
+		val, err := p.value(depth)
+		if err != nil {
+			return Value{}, err
+		}
+		mb.Set(key, val)
+		if done, err = p.listNext('}'); err != nil {
+			return Value{}, err
+		}
+	}
+	off, err := mb.Build(p.builder)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Type: TypeMap, Offset: off}, nil
+}
@@ -0,0 +1,272 @@
+package tron
+
+import "fmt"
+
+// Doc is a mutable handle over a tree document. It owns a growable buffer and
+// tracks the current root, so a series of edits appends only the nodes they
+// change instead of copying the whole document for each one.
+//
+// Committed bytes are never modified: slices returned by Bytes stay valid and
+// unchanged after later transactions. A Doc is not safe for concurrent use.
+type Doc struct {
+	builder *Builder
+	tr      Trailer
+	// committed is the buffer length at the end of the last trailer.
+	committed int
+	txn       *Txn
+}
+
+// NewDoc copies doc into a new handle. The trailer of doc is kept in the
+// buffer, as is the trailer of every commit, so History can walk the result.
+func NewDoc(doc []byte) (*Doc, error) {
+	if _, err := DetectDocType(doc); err != nil {
+		return nil, err
+	}
+	tr, err := ParseTrailer(doc)
+	if err != nil {
+		return nil, err
+	}
+	buf := append([]byte{}, doc...)
+	return &Doc{builder: &Builder{buf: buf}, tr: tr, committed: len(buf)}, nil
+}
+
+// WrapDoc returns a handle that uses buf directly instead of copying it.
+// Commits append into the spare capacity of buf and move to a new buffer when
+// it runs out. The caller must not modify buf while the handle is in use.
+func WrapDoc(buf []byte) (*Doc, error) {
+	if _, err := DetectDocType(buf); err != nil {
+		return nil, err
+	}
+	tr, err := ParseTrailer(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Doc{builder: &Builder{buf: buf}, tr: tr, committed: len(buf)}, nil
+}
+
+// Bytes returns the document as of the last commit, including its trailer.
+func (d *Doc) Bytes() []byte {
+	return d.builder.buf[:d.committed:d.committed]
+}
+
+// Trailer returns the trailer written by the last commit.
+func (d *Doc) Trailer() Trailer {
+	return d.tr
+}
+
+// Root returns the committed root value.
+func (d *Doc) Root() (Value, error) {
+	return DecodeValueAt(d.builder.buf, d.tr.RootOffset)
+}
+
+// Update runs fn in a transaction. The transaction is committed when fn
+// returns nil and rolled back otherwise, including when fn panics.
+func (d *Doc) Update(fn func(tx *Txn) error) error {
+	tx, err := d.Txn()
+	if err != nil {
+		return err
+	}
+	// Rollback does nothing once Commit has closed the transaction.
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Txn starts a transaction. Only one transaction may be open at a time.
+func (d *Doc) Txn() (*Txn, error) {
+	if d.txn != nil {
+		return nil, fmt.Errorf("transaction already open")
+	}
+	d.txn = &Txn{doc: d, root: d.tr.RootOffset}
+	return d.txn, nil
+}
+
+// Txn batches mutations against a Doc. Nodes written by the transaction are
+// appended after the last committed trailer; Commit writes a single trailer
+// for the new root, and Rollback discards everything the transaction wrote.
+//
+// Values of type TypeArr or TypeMap passed to a Txn must refer to nodes in
+// the transaction buffer, for example offsets returned by earlier calls or
+// values copied in with CloneValueFromDoc(src, v, tx.Builder()).
+type Txn struct {
+	doc  *Doc
+	root uint32
+	err  error
+}
+
+// Builder returns the builder that transaction nodes are appended to.
+func (tx *Txn) Builder() *Builder {
+	return tx.doc.builder
+}
+
+// Buffer returns the transaction buffer for reading nodes written so far.
+func (tx *Txn) Buffer() []byte {
+	return tx.doc.builder.buf
+}
+
+// RootOffset returns the transaction root offset.
+func (tx *Txn) RootOffset() uint32 {
+	return tx.root
+}
+
+// Root returns the transaction root value.
+func (tx *Txn) Root() (Value, error) {
+	return DecodeValueAt(tx.doc.builder.buf, tx.root)
+}
+
+// SetRoot replaces the transaction root. Scalars are appended as new nodes.
+func (tx *Txn) SetRoot(v Value) error {
+	if err := tx.check(); err != nil {
+		return err
+	}
+	off, err := valueAddress(tx.doc.builder, v)
+	if err != nil {
+		return tx.fail(err)
+	}
+	tx.root = off
+	return nil
+}
+
+// MapSet sets key in the map node at mapOff and returns the new map offset.
+func (tx *Txn) MapSet(mapOff uint32, key []byte, val Value) (uint32, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	off, _, err := MapSetNode(tx.doc.builder, mapOff, key, val)
+	if err != nil {
+		return 0, tx.fail(err)
+	}
+	return off, nil
+}
+
+// MapDelete removes key from the map node at mapOff and returns the new map
+// offset and whether the key was present.
+func (tx *Txn) MapDelete(mapOff uint32, key []byte) (uint32, bool, error) {
+	if err := tx.check(); err != nil {
+		return 0, false, err
+	}
+	off, removed, err := MapDelNode(tx.doc.builder, mapOff, key)
+	if err != nil {
+		return 0, false, tx.fail(err)
+	}
+	return off, removed, nil
+}
+
+// ArrSet replaces the value at index in the array node at arrOff and returns
+// the new array offset.
+func (tx *Txn) ArrSet(arrOff uint32, index uint32, val Value) (uint32, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	length, err := arrayRootLength(tx.doc.builder.buf, arrOff)
+	if err != nil {
+		return 0, tx.fail(err)
+	}
+	if index >= length {
+		return 0, tx.fail(fmt.Errorf("array index %d out of range", index))
+	}
+	off, err := arrSet(tx.doc.builder, arrOff, index, val, length)
+	if err != nil {
+		return 0, tx.fail(err)
+	}
+	return off, nil
+}
+
+// ArrAppend appends values to the array node at arrOff and returns the new
+// array offset.
+func (tx *Txn) ArrAppend(arrOff uint32, values ...Value) (uint32, error) {
+	if err := tx.check(); err != nil {
+		return 0, err
+	}
+	length, err := arrayRootLength(tx.doc.builder.buf, arrOff)
+	if err != nil {
+		return 0, tx.fail(err)
+	}
+	off := arrOff
+	for _, v := range values {
+		off, err = arrSet(tx.doc.builder, off, length, v, length+1)
+		if err != nil {
+			return 0, tx.fail(err)
+		}
+		length++
+	}
+	return off, nil
+}
+
+// SetKey sets key on the root map.
+func (tx *Txn) SetKey(key string, val Value) error {
+	off, err := tx.MapSet(tx.root, []byte(key), val)
+	if err != nil {
+		return err
+	}
+	tx.root = off
+	return nil
+}
+
+// DeleteKey removes key from the root map and reports whether it was present.
+func (tx *Txn) DeleteKey(key string) (bool, error) {
+	off, removed, err := tx.MapDelete(tx.root, []byte(key))
+	if err != nil {
+		return false, err
+	}
+	tx.root = off
+	return removed, nil
+}
+
+// Commit writes a trailer for the transaction root and closes the
+// transaction. A transaction that left the root unchanged writes nothing.
+// If any mutation failed, Commit rolls back and returns that error.
+// The root node is copied to the end of the buffer when it is not already
+// there, so the trailer follows its root and History can walk back to it.
+func (tx *Txn) Commit() error {
+	d := tx.doc
+	if d.txn != tx {
+		return fmt.Errorf("transaction closed")
+	}
+	if tx.err != nil {
+		tx.Rollback()
+		return tx.err
+	}
+	d.txn = nil
+	if tx.root == d.tr.RootOffset {
+		d.builder.truncate(d.committed)
+		return nil
+	}
+	h, node, err := NodeSliceAt(d.builder.buf, tx.root)
+	if err != nil {
+		d.builder.truncate(d.committed)
+		return err
+	}
+	if uint64(tx.root)+uint64(h.NodeLen) != uint64(len(d.builder.buf)) {
+		tx.root = d.builder.appendNode(node)
+	}
+	d.tr = Trailer{RootOffset: tx.root, PrevRootOffset: d.tr.RootOffset}
+	d.builder.BytesWithTrailerInPlace(d.tr.RootOffset, d.tr.PrevRootOffset)
+	d.committed = len(d.builder.buf)
+	return nil
+}
+
+// Rollback discards the nodes written by the transaction and closes it.
+// It is a no-op on a closed transaction.
+func (tx *Txn) Rollback() {
+	d := tx.doc
+	if d.txn != tx {
+		return
+	}
+	d.builder.truncate(d.committed)
+	d.txn = nil
+}
+
+func (tx *Txn) check() error {
+	if tx.doc.txn != tx {
+		return fmt.Errorf("transaction closed")
+	}
+	return tx.err
+}
+
+func (tx *Txn) fail(err error) error {
+	tx.err = err
+	return err
+}
@@ -0,0 +1,39 @@
+package tron
+
+import "testing"
+
+func TestDocUpdateRollsBackOnPanic(t *testing.T) {
+	doc, err := FromJSON([]byte(`{"n":0}`))
+	if err != nil {
+		t.Fatalf("from json: %v", err)
+	}
+	d, err := NewDoc(doc)
+	if err != nil {
+		t.Fatalf("new doc: %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("update did not panic")
+			}
+		}()
+		d.Update(func(tx *Txn) error {
+			if err := tx.SetKey("n", Value{Type: TypeI64, I64: 1}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if len(d.builder.buf) != len(d.Bytes()) {
+		t.Fatalf("buffer holds %d uncommitted bytes", len(d.builder.buf)-len(d.Bytes()))
+	}
+	err = d.Update(func(tx *Txn) error {
+		return tx.SetKey("n", Value{Type: TypeI64, I64: 2})
+	})
+	if err != nil {
+		t.Fatalf("update after panic: %v", err)
+	}
+	if n := NewCursor(d.Bytes()).Key("n").Int64(); n != 2 {
+		t.Fatalf("n = %d, want 2", n)
+	}
+}
@@ -0,0 +1,383 @@
+package tron
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// VerifyLimits bounds the work done by Verify. Zero fields use the defaults.
+type VerifyLimits struct {
+	// MaxDepth is the maximum nesting depth of arrays and maps.
+	MaxDepth int
+	// MaxNodes is the maximum number of node visits.
+	MaxNodes int
+}
+
+// DefaultVerifyLimits are used for zero fields of VerifyLimits.
+var DefaultVerifyLimits = VerifyLimits{
+	MaxDepth: 1000,
+	MaxNodes: 1 << 24,
+}
+
+// VerifyError reports a structural problem found by Verify.
+type VerifyError struct {
+	// Offset is the offset of the offending node, or of the trailer.
+	Offset uint32
+	Err    error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("invalid node at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify checks the whole graph reachable from the current root of doc.
+// It validates node bounds, that children precede their parents (which rules
+// out cycles), bitmap and child counts, leaf key order, leaf key hashes
+// against their HAMT position, array shifts and lengths, and nesting depth.
+// Shared subtrees are checked once. Historical roots are not checked.
+func Verify(doc []byte, limits VerifyLimits) error {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultVerifyLimits.MaxDepth
+	}
+	if limits.MaxNodes <= 0 {
+		limits.MaxNodes = DefaultVerifyLimits.MaxNodes
+	}
+	trailerOff := uint32(0)
+	if len(doc) >= TrailerSize {
+		trailerOff = uint32(len(doc) - TrailerSize)
+	}
+	if _, err := DetectDocType(doc); err != nil {
+		return &VerifyError{Offset: trailerOff, Err: err}
+	}
+	tr, err := ParseTrailer(doc)
+	if err != nil {
+		return &VerifyError{Offset: trailerOff, Err: err}
+	}
+	v := verifier{
+		doc:    doc,
+		end:    trailerOff,
+		limits: limits,
+		values: make(map[uint32]int),
+		maps:   make(map[verifyMapKey]verifyMapInfo),
+		arrays: make(map[verifyArrKey]verifyArrInfo),
+	}
+	_, err = v.value(tr.RootOffset, trailerOff, 0)
+	return err
+}
+
+type verifyMapKey struct {
+	off   uint32
+	depth int
+}
+
+type verifyMapInfo struct {
+	hasKeys bool
+	prefix  uint32
+	height  int
+}
+
+type verifyArrKey struct {
+	off   uint32
+	shift int
+}
+
+type verifyArrInfo struct {
+	// maxIndex is the highest present index relative to the node's first slot,
+	// or -1 when the subtree holds no values.
+	maxIndex int64
+	height   int
+}
+
+type verifier struct {
+	doc    []byte
+	end    uint32
+	limits VerifyLimits
+	nodes  int
+	values map[uint32]int
+	maps   map[verifyMapKey]verifyMapInfo
+	arrays map[verifyArrKey]verifyArrInfo
+}
+
+func (v *verifier) fail(off uint32, format string, args ...any) error {
+	return &VerifyError{Offset: off, Err: fmt.Errorf(format, args...)}
+}
+
+// child checks that off lies after the header and before parent.
+func (v *verifier) child(off uint32, parent uint32) error {
+	if off < uint32(len(HeaderMagic)) || off >= parent {
+		return v.fail(parent, "child offset %d out of range", off)
+	}
+	return nil
+}
+
+// node returns the bounds-checked node at off, which must precede parent.
+func (v *verifier) node(off uint32, parent uint32) (NodeHeader, []byte, error) {
+	if err := v.child(off, parent); err != nil {
+		return NodeHeader{}, nil, err
+	}
+	h, err := ParseNodeHeader(v.doc[off:v.end])
+	if err != nil {
+		return NodeHeader{}, nil, &VerifyError{Offset: off, Err: err}
+	}
+	if uint64(off)+uint64(h.NodeLen) > uint64(v.end) {
+		return NodeHeader{}, nil, v.fail(off, "node length out of range: %d", h.NodeLen)
+	}
+	v.nodes++
+	if v.nodes > v.limits.MaxNodes {
+		return NodeHeader{}, nil, v.fail(off, "node count exceeds %d", v.limits.MaxNodes)
+	}
+	return h, v.doc[off : off+h.NodeLen], nil
+}
+
+// value verifies the value node at off and returns its nesting height.
+func (v *verifier) value(off uint32, parent uint32, depth int) (int, error) {
+	// Order is checked for every parent, since a cached value may be shared
+	// by a parent that comes before it.
+	if err := v.child(off, parent); err != nil {
+		return 0, err
+	}
+	if height, ok := v.values[off]; ok {
+		if depth+height > v.limits.MaxDepth {
+			return 0, v.fail(off, "nesting depth exceeds %d", v.limits.MaxDepth)
+		}
+		return height, nil
+	}
+	h, node, err := v.node(off, parent)
+	if err != nil {
+		return 0, err
+	}
+	var height int
+	switch h.Type {
+	case TypeMap:
+		if depth+1 > v.limits.MaxDepth {
+			return 0, v.fail(off, "nesting depth exceeds %d", v.limits.MaxDepth)
+		}
+		info, err := v.mapNode(off, h, node, 0, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		height = info.height + 1
+	case TypeArr:
+		if depth+1 > v.limits.MaxDepth {
+			return 0, v.fail(off, "nesting depth exceeds %d", v.limits.MaxDepth)
+		}
+		height, err = v.arrayRoot(off, h, node, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		height++
+	case TypeTxt, TypeBin:
+		if _, _, err := DecodeValue(node); err != nil {
+			return 0, &VerifyError{Offset: off, Err: err}
+		}
+	}
+	v.values[off] = height
+	return height, nil
+}
+
+// mapNode verifies a HAMT node at the given trie depth. valueDepth is the
+// nesting depth of the map's values.
+func (v *verifier) mapNode(off uint32, h NodeHeader, node []byte, depth int, valueDepth int) (verifyMapInfo, error) {
+	key := verifyMapKey{off: off, depth: depth}
+	if info, ok := v.maps[key]; ok {
+		if valueDepth+info.height > v.limits.MaxDepth {
+			return verifyMapInfo{}, v.fail(off, "nesting depth exceeds %d", v.limits.MaxDepth)
+		}
+		return info, nil
+	}
+	if h.KeyType != KeyMap {
+		return verifyMapInfo{}, v.fail(off, "node is not a map")
+	}
+	prefixMask := uint32(1)<<(uint(depth)*4) - 1
+	p := 1 + h.LenBytes
+	var info verifyMapInfo
+	if h.Kind == NodeLeaf {
+		payloadLen := int(h.NodeLen) - p
+		if payloadLen%8 != 0 {
+			return verifyMapInfo{}, v.fail(off, "map leaf payload misaligned")
+		}
+		count := payloadLen / 8
+		var prevKey []byte
+		for i := 0; i < count; i++ {
+			keyAddr := binary.LittleEndian.Uint32(node[p : p+4])
+			valAddr := binary.LittleEndian.Uint32(node[p+4 : p+8])
+			p += 8
+			kh, keyNode, err := v.node(keyAddr, off)
+			if err != nil {
+				return verifyMapInfo{}, err
+			}
+			if kh.Type != TypeTxt {
+				return verifyMapInfo{}, v.fail(keyAddr, "map leaf key must be txt")
+			}
+			keyVal, _, err := DecodeValue(keyNode)
+			if err != nil {
+				return verifyMapInfo{}, &VerifyError{Offset: keyAddr, Err: err}
+			}
+			if i > 0 && bytesCompare(prevKey, keyVal.Bytes) >= 0 {
+				return verifyMapInfo{}, v.fail(off, "map leaf keys must be sorted and unique")
+			}
+			prevKey = keyVal.Bytes
+			hash := XXH32(keyVal.Bytes, 0) & prefixMask
+			if !info.hasKeys {
+				info.hasKeys = true
+				info.prefix = hash
+			} else if hash != info.prefix {
+				return verifyMapInfo{}, v.fail(off, "map leaf key %q hash does not match its position", keyVal.Bytes)
+			}
+			height, err := v.value(valAddr, off, valueDepth)
+			if err != nil {
+				return verifyMapInfo{}, err
+			}
+			info.height = max(info.height, height)
+		}
+		v.maps[key] = info
+		return info, nil
+	}
+
+	if depth >= maxDepth32 {
+		return verifyMapInfo{}, v.fail(off, "map branch at depth %d exceeds max", depth)
+	}
+	if int(h.NodeLen) < p+4 {
+		return verifyMapInfo{}, v.fail(off, "map branch node too small: %d", h.NodeLen)
+	}
+	bitmap := binary.LittleEndian.Uint32(node[p : p+4])
+	if bitmap&0xFFFF0000 != 0 {
+		return verifyMapInfo{}, v.fail(off, "map branch bitmap high bits must be zero")
+	}
+	p += 4
+	count := popcount16(uint16(bitmap))
+	if int(h.NodeLen) != p+count*4 {
+		return verifyMapInfo{}, v.fail(off, "map branch has %d children, node length %d", count, h.NodeLen)
+	}
+	for slot := uint32(0); slot < hamtSlots; slot++ {
+		if (bitmap>>slot)&1 == 0 {
+			continue
+		}
+		child := binary.LittleEndian.Uint32(node[p : p+4])
+		p += 4
+		ch, childNode, err := v.node(child, off)
+		if err != nil {
+			return verifyMapInfo{}, err
+		}
+		childInfo, err := v.mapNode(child, ch, childNode, depth+1, valueDepth)
+		if err != nil {
+			return verifyMapInfo{}, err
+		}
+		info.height = max(info.height, childInfo.height)
+		if !childInfo.hasKeys {
+			continue
+		}
+		if (childInfo.prefix>>(uint(depth)*4))&hamtMask != slot {
+			return verifyMapInfo{}, v.fail(child, "map subtree keys do not hash to slot %d", slot)
+		}
+		prefix := childInfo.prefix & prefixMask
+		if !info.hasKeys {
+			info.hasKeys = true
+			info.prefix = prefix
+		} else if prefix != info.prefix {
+			return verifyMapInfo{}, v.fail(child, "map subtree keys do not share parent hash prefix")
+		}
+	}
+	v.maps[key] = info
+	return info, nil
+}
+
+func (v *verifier) arrayRoot(off uint32, h NodeHeader, node []byte, valueDepth int) (int, error) {
+	if !h.IsRoot {
+		return 0, v.fail(off, "array value node missing root flag")
+	}
+	p := 1 + h.LenBytes
+	if int(h.NodeLen) < p+7 {
+		return 0, v.fail(off, "array root node too small: %d", h.NodeLen)
+	}
+	shift := node[p]
+	length := binary.LittleEndian.Uint32(node[p+3 : p+7])
+	if shift%4 != 0 || shift > 28 {
+		return 0, v.fail(off, "array node shift invalid: %d", shift)
+	}
+	if shift < arrayRootShift(length) {
+		return 0, v.fail(off, "array root shift %d too small for length %d", shift, length)
+	}
+	info, err := v.arrayNode(off, h, node, int(shift), valueDepth)
+	if err != nil {
+		return 0, err
+	}
+	if info.maxIndex >= int64(length) {
+		return 0, v.fail(off, "array index %d beyond length %d", info.maxIndex, length)
+	}
+	return info.height, nil
+}
+
+// arrayNode verifies a vector trie node that must carry shift.
+func (v *verifier) arrayNode(off uint32, h NodeHeader, node []byte, shift int, valueDepth int) (verifyArrInfo, error) {
+	key := verifyArrKey{off: off, shift: shift}
+	if info, ok := v.arrays[key]; ok {
+		if valueDepth+info.height > v.limits.MaxDepth {
+			return verifyArrInfo{}, v.fail(off, "nesting depth exceeds %d", v.limits.MaxDepth)
+		}
+		return info, nil
+	}
+	if h.KeyType != KeyArr {
+		return verifyArrInfo{}, v.fail(off, "node is not an array")
+	}
+	p := 1 + h.LenBytes
+	if int(h.NodeLen) < p+3 {
+		return verifyArrInfo{}, v.fail(off, "array node too small: %d", h.NodeLen)
+	}
+	if int(node[p]) != shift {
+		return verifyArrInfo{}, v.fail(off, "array node shift %d, want %d", node[p], shift)
+	}
+	bitmap := binary.LittleEndian.Uint16(node[p+1 : p+3])
+	p += 3
+	if h.IsRoot {
+		p += 4
+	}
+	count := popcount16(bitmap)
+	if int(h.NodeLen) != p+count*4 {
+		return verifyArrInfo{}, v.fail(off, "array node has %d addresses, node length %d", count, h.NodeLen)
+	}
+	if h.Kind == NodeLeaf && shift != 0 {
+		return verifyArrInfo{}, v.fail(off, "array leaf shift must be 0")
+	}
+	if h.Kind == NodeBranch && shift == 0 {
+		return verifyArrInfo{}, v.fail(off, "array branch shift must be non-zero")
+	}
+	info := verifyArrInfo{maxIndex: -1}
+	for slot := uint32(0); slot < 16; slot++ {
+		if (bitmap>>slot)&1 == 0 {
+			continue
+		}
+		addr := binary.LittleEndian.Uint32(node[p : p+4])
+		p += 4
+		if h.Kind == NodeLeaf {
+			height, err := v.value(addr, off, valueDepth)
+			if err != nil {
+				return verifyArrInfo{}, err
+			}
+			info.height = max(info.height, height)
+			info.maxIndex = int64(slot)
+			continue
+		}
+		ch, childNode, err := v.node(addr, off)
+		if err != nil {
+			return verifyArrInfo{}, err
+		}
+		if ch.Type == TypeArr && ch.IsRoot {
+			return verifyArrInfo{}, v.fail(addr, "array non-root node marked as root")
+		}
+		childInfo, err := v.arrayNode(addr, ch, childNode, shift-4, valueDepth)
+		if err != nil {
+			return verifyArrInfo{}, err
+		}
+		info.height = max(info.height, childInfo.height)
+		if childInfo.maxIndex >= 0 {
+			info.maxIndex = int64(slot)<<uint(shift) + childInfo.maxIndex
+		}
+	}
+	v.arrays[key] = info
+	return info, nil
+}
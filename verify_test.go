@@ -0,0 +1,65 @@
+package tron
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyChildAfterSharingParent(t *testing.T) {
+	// The root holds [A, B] where B, written before A, also holds A. The
+	// result must not depend on which parent reaches A first.
+	for _, order := range [][2]int{{0, 1}, {1, 0}} {
+		builder := NewBuilder()
+		bNode, err := EncodeArrayLeafNode(ArrayLeafNode{
+			Header:     NodeHeader{Kind: NodeLeaf, KeyType: KeyArr, IsRoot: true},
+			Bitmap:     1,
+			Length:     1,
+			ValueAddrs: []uint32{17},
+		})
+		if err != nil {
+			t.Fatalf("encode b: %v", err)
+		}
+		b := builder.AppendNode(bNode)
+		a, err := appendValueNode(builder, Value{Type: TypeTxt, Bytes: []byte("a")})
+		if err != nil {
+			t.Fatalf("encode a: %v", err)
+		}
+		if b != 4 || a != 17 {
+			t.Fatalf("layout b=%d a=%d, want 4 and 17", b, a)
+		}
+		addrs := [2]uint32{a, b}
+		rootNode, err := EncodeArrayLeafNode(ArrayLeafNode{
+			Header:     NodeHeader{Kind: NodeLeaf, KeyType: KeyArr, IsRoot: true},
+			Bitmap:     3,
+			Length:     2,
+			ValueAddrs: []uint32{addrs[order[0]], addrs[order[1]]},
+		})
+		if err != nil {
+			t.Fatalf("encode root: %v", err)
+		}
+		root := builder.AppendNode(rootNode)
+		doc := builder.BytesWithTrailer(root, 0)
+
+		err = Verify(doc, VerifyLimits{})
+		var verr *VerifyError
+		if !errors.As(err, &verr) || verr.Offset != b {
+			t.Fatalf("order %v: Verify = %v, want error at offset %d", order, err, b)
+		}
+	}
+}
+
+func TestVerifyAcceptsEncodedDocuments(t *testing.T) {
+	for _, in := range []string{
+		`null`,
+		`{"a":1,"b":[true,{"c":"x"}],"d":{"e":[1,2,3]}}`,
+		`[0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,[18],{"19":19}]`,
+	} {
+		doc, err := FromJSON([]byte(in))
+		if err != nil {
+			t.Fatalf("from json %s: %v", in, err)
+		}
+		if err := Verify(doc, VerifyLimits{}); err != nil {
+			t.Fatalf("verify %s: %v", in, err)
+		}
+	}
+}